@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+// HTTPHandler registra una entrada por cada petición a next, con la acción
+// indicada. El propietario y el archivo se toman de los parámetros owner_id
+// y file_id, y la identidad del certificado de cliente o, igual que en gRPC
+// sin autenticarla, de la cabecera X-Principal.
+func HTTPHandler(l *Log, action string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		rw := &auditedResponse{ResponseWriter: w, status: http.StatusOK}
+		entry := Entry{
+			Principal: r.Header.Get(PrincipalHeader),
+			Action:    action,
+			OwnerID:   q.Get("owner_id"),
+			FileID:    q.Get("file_id"),
+			ClientIP:  httpClientIP(r),
+			RequestID: r.Header.Get("X-Request-Id"),
+		}
+		if r.TLS != nil {
+			if name := certPrincipal(r.TLS.VerifiedChains); name != "" {
+				entry.Principal = name
+			}
+		}
+		if entry.Principal == "" {
+			entry.Principal = anonymous
+		}
+		defer func() {
+			entry.Bytes = rw.bytes
+			entry.Result = httpResult(rw.status).String()
+			if v := recover(); v != nil {
+				// Respuesta cortada a la mitad (http.ErrAbortHandler)
+				entry.Result = codes.Aborted.String()
+				defer panic(v)
+			}
+			if _, err := l.Append(entry); err != nil {
+				slog.ErrorContext(r.Context(), "Failed to write audit entry", "action", action, "error", err)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// httpResult traduce el estado HTTP al código gRPC equivalente, para que las
+// entradas de HTTP y gRPC se puedan filtrar igual.
+func httpResult(status int) codes.Code {
+	switch {
+	case status < 400:
+		return codes.OK
+	case status == http.StatusBadRequest:
+		return codes.InvalidArgument
+	case status == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case status == http.StatusForbidden:
+		return codes.PermissionDenied
+	case status == http.StatusNotFound:
+		return codes.NotFound
+	case status == http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case status == http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case status < 500:
+		return codes.Unknown
+	}
+	return codes.Internal
+}
+
+func httpClientIP(r *http.Request) string {
+	if first, _, _ := strings.Cut(r.Header.Get("X-Forwarded-For"), ","); strings.TrimSpace(first) != "" {
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type auditedResponse struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *auditedResponse) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditedResponse) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
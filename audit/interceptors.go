@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+	"net"
+	"strings"
+	"unicode"
+
+	"github.com/Districorp-UPB/FileServer/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// PrincipalHeader es la clave de metadata con la identidad del usuario. El
+// servidor no la autentica: la debe agregar un gateway que autentique al
+// cliente y descarte la que este envíe. Sin ese gateway, el principal de las
+// entradas es lo que el cliente dice ser. Si la conexión trae un certificado
+// de cliente verificado, se usa el certificado en su lugar.
+const PrincipalHeader = "x-principal"
+
+// Principal usado cuando la petición no trae identidad
+const anonymous = "anonymous"
+
+// Campos que se extraen de los mensajes para la entrada de auditoría
+type (
+	ownedMessage  interface{ GetOwnerId() string }
+	fileMessage   interface{ GetFileId() string }
+	uploadChunk   interface{ GetBinaryFile() []byte }
+	downloadChunk interface{ GetBinaryFileResponse() []byte }
+)
+
+// actions traduce el nombre del método a la acción registrada. Los métodos
+// que no aparecen aquí se registran con su nombre en snake_case.
+var actions = map[string]string{
+	"Upload":   "upload",
+	"Download": "download",
+}
+
+// UnaryServerInterceptor registra una entrada por cada RPC unario.
+func UnaryServerInterceptor(l *Log) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !audited(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		rec := newRecorder(ctx, info.FullMethod)
+		rec.observe(req)
+		resp, err := handler(ctx, req)
+		rec.observe(resp)
+		rec.write(ctx, l, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor registra una entrada por cada RPC con streams.
+func StreamServerInterceptor(l *Log) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !audited(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		as := &auditedStream{ServerStream: ss, rec: newRecorder(ss.Context(), info.FullMethod)}
+		err := handler(srv, as)
+		as.rec.write(ss.Context(), l, err)
+		return err
+	}
+}
+
+// Solo se auditan los servicios propios (paquete proto), no health ni reflexión.
+func audited(fullMethod string) bool {
+	return strings.HasPrefix(fullMethod, "/proto.")
+}
+
+type recorder struct {
+	entry Entry
+}
+
+func newRecorder(ctx context.Context, fullMethod string) *recorder {
+	return &recorder{entry: Entry{
+		Principal: principal(ctx),
+		Action:    action(fullMethod),
+		ClientIP:  clientIP(ctx),
+		RequestID: logging.RequestID(ctx),
+	}}
+}
+
+func (r *recorder) observe(m any) {
+	if o, ok := m.(ownedMessage); ok && r.entry.OwnerID == "" {
+		r.entry.OwnerID = o.GetOwnerId()
+	}
+	if f, ok := m.(fileMessage); ok && r.entry.FileID == "" {
+		r.entry.FileID = f.GetFileId()
+	}
+	if c, ok := m.(uploadChunk); ok {
+		r.entry.Bytes += int64(len(c.GetBinaryFile()))
+	}
+	if c, ok := m.(downloadChunk); ok {
+		r.entry.Bytes += int64(len(c.GetBinaryFileResponse()))
+	}
+}
+
+func (r *recorder) write(ctx context.Context, l *Log, err error) {
+	r.entry.Result = codes.OK.String()
+	if err != nil {
+		r.entry.Result = status.Code(err).String()
+		r.entry.Error = err.Error()
+	}
+	// El RPC ya se ejecutó: un fallo no se informa al cliente, pero queda en
+	// la métrica, el health check y después en el propio registro (ver Check)
+	if _, err := l.Append(r.entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to write audit entry", "action", r.entry.Action, "error", err)
+	}
+}
+
+type auditedStream struct {
+	grpc.ServerStream
+	rec *recorder
+}
+
+func (s *auditedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.rec.observe(m)
+	return nil
+}
+
+func (s *auditedStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.rec.observe(m)
+	return nil
+}
+
+// principal retorna el sujeto del certificado de cliente verificado, o si no
+// hay, el de PrincipalHeader.
+func principal(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if name := certPrincipal(info.State.VerifiedChains); name != "" {
+				return name
+			}
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(PrincipalHeader); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return anonymous
+}
+
+// certPrincipal retorna el sujeto del certificado de cliente de una conexión
+// TLS verificada, o "" si no hay.
+func certPrincipal(chains [][]*x509.Certificate) string {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	cert := chains[0][0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	return cert.Subject.String()
+}
+
+// clientIP prefiere X-Forwarded-For cuando el servidor está detrás de un
+// balanceador; si no, usa la dirección del par.
+func clientIP(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-forwarded-for"); len(values) > 0 {
+			if first, _, _ := strings.Cut(values[0], ","); strings.TrimSpace(first) != "" {
+				return strings.TrimSpace(first)
+			}
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func action(fullMethod string) string {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	if a, ok := actions[method]; ok {
+		return a
+	}
+	var b strings.Builder
+	for i, r := range method {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,473 @@
+// Package audit mantiene un registro de auditoría de solo-anexar, encadenado
+// por hashes, de todas las operaciones sobre archivos.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metrics"
+)
+
+// La cadena de hashes detecta entradas modificadas o borradas en el medio,
+// pero quien puede escribir el archivo también puede reescribirlo entero y
+// recalcular los hashes. Con WithCheckpoints se agregan a la cadena puntos de
+// control firmados: reescribir cualquier entrada anterior a uno requiere la
+// clave privada. Las entradas posteriores al último punto de control solo
+// están protegidas por la cadena.
+
+// CheckpointAction es la acción de las entradas de punto de control.
+const CheckpointAction = "checkpoint"
+
+// Principal de las entradas que agrega el propio registro
+const systemPrincipal = "system"
+
+// LostAction es la acción de la entrada que deja Check al recuperarse de
+// fallos de escritura: marca dónde faltan entradas.
+const LostAction = "entries_lost"
+
+// Entry es una línea del registro de auditoría.
+type Entry struct {
+	Sequence  uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal"`
+	Action    string    `json:"action"`
+	OwnerID   string    `json:"owner_id,omitempty"`
+	FileID    string    `json:"file_id,omitempty"`
+	Bytes     int64     `json:"bytes"`
+	ClientIP  string    `json:"client_ip,omitempty"`
+	Result    string    `json:"result"`
+	Error     string    `json:"error,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Clave que firmó un punto de control
+	KeyID    string `json:"key_id,omitempty"`
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+	// Firma Ed25519 de Hash en base64, solo en los puntos de control
+	Signature string `json:"signature,omitempty"`
+}
+
+// computeHash calcula el hash de la entrada sin incluir sus campos Hash y
+// Signature. Como PrevHash forma parte del contenido, cada entrada depende de
+// todas las anteriores.
+func (e Entry) computeHash() (string, error) {
+	e.Hash = ""
+	e.Signature = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Log es un registro de auditoría respaldado por un archivo JSON lines.
+type Log struct {
+	mu       sync.Mutex
+	file     *os.File
+	path     string
+	lastSeq  uint64
+	lastHash string
+	// Bytes escritos hasta la última entrada completa
+	size int64
+
+	// Puntos de control (opcionales) y entradas escritas desde el último
+	signer          *Signer
+	checkpointEvery int
+	unsigned        int
+
+	// Entradas que no se pudieron escribir desde la última vez que Check
+	// registró la pérdida, y el último error
+	lost    int
+	lostErr error
+}
+
+// Option configura un Log.
+type Option func(*Log)
+
+// WithCheckpoints agrega un punto de control firmado por signer cada every
+// entradas y al cerrar el registro.
+func WithCheckpoints(signer *Signer, every int) Option {
+	return func(l *Log) {
+		l.signer = signer
+		l.checkpointEvery = max(1, every)
+	}
+}
+
+// Open abre (o crea) el registro en path y continúa la cadena existente. Una
+// última línea incompleta, que deja una caída en medio de Append, se descarta.
+func Open(path string, opts ...Option) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	l := &Log{path: path}
+	for _, opt := range opts {
+		opt(l)
+	}
+	discarded, err := truncatePartial(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover audit log: %w", err)
+	}
+	if discarded > 0 {
+		slog.Warn("Discarded incomplete last audit entry", "path", path, "bytes", discarded)
+	}
+	err = scan(path, -1, func(e Entry) error {
+		l.lastSeq = e.Sequence
+		l.lastHash = e.Hash
+		l.unsigned++
+		if e.Action == CheckpointAction {
+			l.unsigned = 0
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	l.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := l.file.Stat()
+	if err != nil {
+		l.file.Close()
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l.size = info.Size()
+	return l, nil
+}
+
+// truncatePartial corta el archivo después de su último salto de línea y
+// retorna cuántos bytes descartó. Append escribe cada entrada con su salto de
+// línea al final, así que lo que sigue al último es una entrada que no se
+// terminó de escribir.
+func truncatePartial(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	keep := int64(0)
+	buf := make([]byte, 64*1024)
+	for end := size; end > 0; {
+		start := max(0, end-int64(len(buf)))
+		chunk := buf[:end-start]
+		if _, err := f.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			keep = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+	if keep == size {
+		return 0, nil
+	}
+	if err := f.Truncate(keep); err != nil {
+		return 0, err
+	}
+	return size - keep, f.Sync()
+}
+
+// Append encadena la entrada con la anterior y la escribe al final del
+// registro. Sequence, PrevHash y Hash se asignan aquí. Si corresponde, agrega
+// después un punto de control.
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, err := l.append(e)
+	if err != nil {
+		l.lost++
+		l.lostErr = err
+		metrics.AuditWriteError()
+		return Entry{}, err
+	}
+	if l.signer != nil && l.unsigned >= l.checkpointEvery {
+		// La entrada ya quedó escrita: si el punto de control falla se
+		// intenta con la siguiente
+		if err := l.checkpoint(); err != nil {
+			slog.Error("Failed to write audit checkpoint", "error", err)
+		}
+	}
+	return e, nil
+}
+
+// Check es el health check del registro: falla mientras haya entradas que no
+// se pudieron escribir. Para recuperarse agrega una entrada LostAction con
+// cuántas se perdieron, así que la pérdida queda en el registro y no solo en
+// las métricas.
+func (l *Log) Check(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost == 0 {
+		return nil
+	}
+	_, err := l.append(Entry{
+		Principal: systemPrincipal,
+		Action:    LostAction,
+		Result:    "DataLoss",
+		Error:     fmt.Sprintf("%d entries could not be written: %v", l.lost, l.lostErr),
+	})
+	if err != nil {
+		return fmt.Errorf("%d audit entries could not be written: %w", l.lost, err)
+	}
+	l.lost, l.lostErr = 0, nil
+	return nil
+}
+
+// checkpoint agrega un punto de control que firma el hash de la cadena hasta
+// él.
+func (l *Log) checkpoint() error {
+	_, err := l.append(Entry{Principal: systemPrincipal, Action: CheckpointAction, Result: "OK", KeyID: l.signer.KeyID()})
+	return err
+}
+
+func (l *Log) append(e Entry) (Entry, error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.Sequence = l.lastSeq + 1
+	e.PrevHash = l.lastHash
+
+	hash, err := e.computeHash()
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to hash audit entry: %w", err)
+	}
+	e.Hash = hash
+	if e.Action == CheckpointAction {
+		e.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(l.signer.key, []byte(e.Hash)))
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	// Si la escritura falla a la mitad (disco lleno), se descarta lo escrito
+	// para que la entrada siguiente no quede pegada a una incompleta
+	line = append(line, '\n')
+	if _, err := l.file.Write(line); err != nil {
+		l.file.Truncate(l.size)
+		return Entry{}, fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		l.file.Truncate(l.size)
+		return Entry{}, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+	l.size += int64(len(line))
+
+	l.lastSeq = e.Sequence
+	l.lastHash = e.Hash
+	l.unsigned++
+	if e.Action == CheckpointAction {
+		l.unsigned = 0
+	}
+	return e, nil
+}
+
+// Close firma las últimas entradas con un punto de control y cierra el
+// registro.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.signer != nil && l.unsigned > 0 {
+		err = l.checkpoint()
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Filter selecciona entradas del registro. Los campos vacíos no filtran.
+type Filter struct {
+	Since     time.Time
+	Until     time.Time
+	Principal string
+	OwnerID   string
+	FileID    string
+	Action    string
+	// Limit es el máximo de entradas a retornar (0 = sin límite)
+	Limit int
+}
+
+func (f Filter) matches(e Entry) bool {
+	switch {
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	case f.Principal != "" && e.Principal != f.Principal:
+		return false
+	case f.OwnerID != "" && e.OwnerID != f.OwnerID:
+		return false
+	case f.FileID != "" && e.FileID != f.FileID:
+		return false
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	}
+	return true
+}
+
+// Query retorna las entradas que cumplen el filtro, en orden.
+func (l *Log) Query(f Filter) ([]Entry, error) {
+	// Solo se leen las entradas completas al empezar: Append puede estar
+	// escribiendo la siguiente, o descartándola si falló
+	l.mu.Lock()
+	size := l.size
+	l.mu.Unlock()
+
+	var entries []Entry
+	errLimit := errors.New("limit reached")
+	err := scan(l.path, size, func(e Entry) error {
+		if !f.matches(e) {
+			return nil
+		}
+		entries = append(entries, e)
+		if f.Limit > 0 && len(entries) >= f.Limit {
+			return errLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimit) {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// VerifyError indica la primera entrada en la que se rompe la cadena.
+type VerifyError struct {
+	Line   int
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("audit chain broken at line %d: %s", e.Line, e.Reason)
+}
+
+// Verification es el resultado de Verify.
+type Verification struct {
+	// Entradas válidas, incluidos los puntos de control
+	Entries int
+	// Puntos de control con firma válida
+	Checkpoints int
+	// Entradas posteriores al último punto de control, protegidas solo por
+	// la cadena de hashes
+	Unsigned int
+}
+
+// Verify recorre el registro en path y comprueba secuencia, enlaces y hashes.
+// Con key también comprueba la firma de los puntos de control; sin ella, se
+// cuentan como entradas sin firmar.
+func Verify(path string, key ed25519.PublicKey) (Verification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Verification{}, err
+	}
+	defer f.Close()
+	return verify(f, key)
+}
+
+func verify(r io.Reader, key ed25519.PublicKey) (Verification, error) {
+	var prev Entry
+	var v Verification
+	err := decodeLines(r, func(line int, e Entry, decodeErr error) error {
+		if decodeErr != nil {
+			return &VerifyError{Line: line, Reason: decodeErr.Error()}
+		}
+		if e.Sequence != prev.Sequence+1 {
+			return &VerifyError{Line: line, Reason: fmt.Sprintf("sequence %d follows %d", e.Sequence, prev.Sequence)}
+		}
+		if e.PrevHash != prev.Hash {
+			return &VerifyError{Line: line, Reason: "prev_hash does not match previous entry"}
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return &VerifyError{Line: line, Reason: err.Error()}
+		}
+		if hash != e.Hash {
+			return &VerifyError{Line: line, Reason: "entry hash mismatch"}
+		}
+		if (e.Action == CheckpointAction) != (e.Signature != "") {
+			return &VerifyError{Line: line, Reason: "signature on an entry that is not a checkpoint, or checkpoint without signature"}
+		}
+		signed := e.Action == CheckpointAction && key != nil
+		if signed {
+			signature, err := base64.StdEncoding.DecodeString(e.Signature)
+			if err != nil || !ed25519.Verify(key, []byte(e.Hash), signature) {
+				return &VerifyError{Line: line, Reason: "invalid checkpoint signature"}
+			}
+		}
+		prev = e
+		v.Entries++
+		v.Unsigned++
+		if signed {
+			v.Checkpoints++
+			v.Unsigned = 0
+		}
+		return nil
+	})
+	return v, err
+}
+
+// scan decodifica cada entrada de los primeros size bytes del archivo (todo
+// el archivo si size es negativo) y llama a fn en orden.
+func scan(path string, size int64, fn func(Entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if size >= 0 {
+		r = io.LimitReader(f, size)
+	}
+	return decodeLines(r, func(line int, e Entry, err error) error {
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		return fn(e)
+	})
+}
+
+func decodeLines(r io.Reader, fn func(line int, e Entry, err error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e Entry
+		err := json.Unmarshal(scanner.Bytes(), &e)
+		if err := fn(line, e, err); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
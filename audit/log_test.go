@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func openTestLog(t *testing.T) *Log {
+	t.Helper()
+	l, err := Open(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// Query no lee una entrada que Append todavía está escribiendo.
+func TestQueryIgnoresPartialEntry(t *testing.T) {
+	l := openTestLog(t)
+	for _, action := range []string{"upload", "download"} {
+		if _, err := l.Append(Entry{Principal: "p", Action: action, Result: "OK"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Lo que deja en el archivo una escritura a medias
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString(`{"seq":3,"time":"20`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	entries, err := l.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Action != "download" {
+		t.Errorf("Query = %+v, want the 2 complete entries", entries)
+	}
+}
+
+func TestQueryDuringAppend(t *testing.T) {
+	l := openTestLog(t)
+	const n = 200
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < n; i++ {
+			if _, err := l.Append(Entry{Principal: "p", Action: "upload", Result: "OK"}); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		entries, err := l.Query(Filter{})
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		for i, e := range entries {
+			if e.Sequence != uint64(i+1) {
+				t.Fatalf("entry %d has sequence %d", i, e.Sequence)
+			}
+		}
+	}
+}
+
+// writeTestLog escribe un registro de 7 líneas: las entradas 1-3, un punto
+// de control, las entradas 5-6 y el punto de control de Close.
+func writeTestLog(t *testing.T, signer *Signer) []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, WithCheckpoints(signer, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := l.Append(Entry{Principal: "p", Action: "upload", FileID: fmt.Sprint("f", i), Result: "OK"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("test log has %d lines, want 7", len(lines))
+	}
+	return lines
+}
+
+func TestVerify(t *testing.T) {
+	signer, err := LoadSigner(filepath.Join(t.TempDir(), "signing.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := LoadSigner(filepath.Join(t.TempDir(), "other.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := writeTestLog(t, signer)
+
+	tests := []struct {
+		name string
+		// Modifica una copia de las líneas
+		tamper func(lines []string) []string
+		key    ed25519.PublicKey
+		// Línea de VerifyError (0 = válido)
+		wantLine int
+	}{
+		{name: "intact", tamper: func(l []string) []string { return l }, key: signer.PublicKey()},
+		{name: "intact without key", tamper: func(l []string) []string { return l }},
+		{name: "edited", tamper: func(l []string) []string {
+			l[2] = strings.Replace(l[2], `"principal":"p"`, `"principal":"q"`, 1)
+			return l
+		}, key: signer.PublicKey(), wantLine: 3},
+		{name: "dropped", tamper: func(l []string) []string { return slices.Delete(l, 2, 3) }, key: signer.PublicKey(), wantLine: 3},
+		{name: "reordered", tamper: func(l []string) []string {
+			l[4], l[5] = l[5], l[4]
+			return l
+		}, key: signer.PublicKey(), wantLine: 5},
+		{name: "not json", tamper: func(l []string) []string {
+			l[1] = l[1][:len(l[1])/2]
+			return l
+		}, key: signer.PublicKey(), wantLine: 2},
+		{name: "other key", tamper: func(l []string) []string { return l }, key: other.PublicKey(), wantLine: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			content := strings.Join(tt.tamper(slices.Clone(lines)), "\n") + "\n"
+			if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			v, err := Verify(path, tt.key)
+			if tt.wantLine == 0 {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if v.Entries != 7 {
+					t.Errorf("Entries = %d, want 7", v.Entries)
+				}
+				return
+			}
+			var verr *VerifyError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Verify error = %v, want a VerifyError", err)
+			}
+			if verr.Line != tt.wantLine {
+				t.Errorf("VerifyError line = %d, want %d (%s)", verr.Line, tt.wantLine, verr.Reason)
+			}
+			if v.Entries != tt.wantLine-1 {
+				t.Errorf("Entries = %d, want %d", v.Entries, tt.wantLine-1)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Signer firma comprobantes (por ejemplo, el de un borrado de datos) y los
+// puntos de control del registro de auditoría con una clave Ed25519, para que
+// cualquiera con la clave pública pueda verificar que los emitió este
+// servidor y que no se modificaron.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// LoadSigner carga la clave privada PKCS#8 en PEM de path. Si no existe, la
+// genera y la guarda, legible solo por el usuario del servidor.
+func LoadSigner(path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newSigner(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("invalid signing key %s: expected a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing key %s: %w", path, err)
+	}
+	ed, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("invalid signing key %s: not an Ed25519 key", path)
+	}
+	return &Signer{key: ed}, nil
+}
+
+// LoadPublicKey carga una clave pública Ed25519 en PEM de path, para
+// verificar firmas. Acepta también la clave privada de LoadSigner.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key %s: expected PEM", path)
+	}
+	var key any
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("invalid public key %s: unexpected PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k.Public().(ed25519.PublicKey), nil
+	}
+	return nil, fmt.Errorf("invalid public key %s: not an Ed25519 key", path)
+}
+
+func newSigner(path string) (*Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create signing key directory: %w", err)
+	}
+	// O_EXCL: dos procesos no pueden generar claves distintas para el mismo
+	// archivo
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write signing key: %w", err)
+	}
+	return &Signer{key: key}, nil
+}
+
+// PublicKey retorna la clave pública con la que se verifican las firmas.
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// KeyID identifica la clave pública: los primeros 8 bytes de su SHA-256 en
+// hexadecimal.
+func (s *Signer) KeyID() string {
+	sum := sha256.Sum256(s.PublicKey())
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign serializa v en JSON y lo firma. Se firman exactamente los bytes
+// retornados, que son los que se deben entregar junto con la firma.
+func (s *Signer) Sign(v any) (payload, signature []byte, err error) {
+	payload, err = json.Marshal(v)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode signed payload: %w", err)
+	}
+	return payload, ed25519.Sign(s.key, payload), nil
+}
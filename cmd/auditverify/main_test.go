@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/audit"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "signing.pem")
+	signer, err := audit.LoadSigner(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logPath := filepath.Join(dir, "audit.log")
+	l, err := audit.Open(logPath, audit.WithCheckpoints(signer, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"upload", "download", "delete"} {
+		if _, err := l.Append(audit.Entry{Principal: "p", Action: action, Result: "OK"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// upload, download, punto de control, delete, punto de control
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		code    int
+		// Texto esperado en la salida
+		want string
+	}{
+		{"valid", string(data), []string{"-key", keyPath}, 0, "5 entries verified, 2 signed checkpoints"},
+		{"valid without key", string(data), nil, 0, "hash chain only"},
+		{"edited", strings.Replace(string(data), `"action":"delete"`, `"action":"rename"`, 1), []string{"-key", keyPath}, 1, "broken at line 4"},
+		{"dropped", lines[0] + lines[2] + lines[3] + lines[4], nil, 1, "broken at line 2"},
+		{"reordered", lines[1] + lines[0] + strings.Join(lines[2:], ""), nil, 1, "broken at line 1"},
+		{"missing key", string(data), []string{"-key", filepath.Join(dir, "missing.pem")}, 2, "failed to read public key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			code := run(append([]string{"-log", path}, tt.args...), &stdout, &stderr)
+			if code != tt.code {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.code, stderr.String())
+			}
+			if out := stdout.String() + stderr.String(); !strings.Contains(out, tt.want) {
+				t.Errorf("output %q does not contain %q", out, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+// fssync mantiene un directorio local sincronizado en los dos sentidos con
+// los archivos de un propietario en el servidor.
+//
+// Los cambios de cada lado se aplican en el otro comparando con el último
+// estado sincronizado, que se guarda en <dir>/.fssync para sobrevivir a los
+// reinicios. Los archivos con el mismo hash no se transfieren, y si un
+// archivo cambió en los dos lados se conservan las dos versiones: la local
+// se renombra con el sufijo "(conflict <fecha>)".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/logging"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "FileService address")
+	owner := flag.String("owner", "", "owner whose files are synced")
+	dir := flag.String("dir", "", "local directory to keep in sync")
+	remote := flag.String("remote", "/", "remote folder to sync with the local directory")
+	interval := flag.Duration("interval", 5*time.Minute, "interval between full sync passes, in addition to the ones triggered by changes")
+	debounce := flag.Duration("debounce", time.Second, "quiet period after a change before syncing")
+	once := flag.Bool("once", false, "run a single sync pass and exit")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	flag.Parse()
+
+	if _, err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		fatal("Invalid log configuration", err)
+	}
+	if *owner == "" || *dir == "" {
+		fmt.Fprintln(os.Stderr, "usage: fssync -owner <owner_id> -dir <directory> [-remote /folder]")
+		os.Exit(2)
+	}
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		fatal("Invalid directory", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		fatal("Failed to create directory", err)
+	}
+
+	st, err := openState(filepath.Join(root, stateDir, "state.db"), *owner, path.Clean("/"+*remote))
+	if err != nil {
+		fatal("Failed to open sync state", err)
+	}
+	defer st.Close()
+
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		fatal("Failed to create client", err)
+	}
+	defer conn.Close()
+
+	s := &syncer{
+		client: pb.NewFileServiceClient(conn),
+		owner:  *owner,
+		remote: path.Clean("/" + *remote),
+		dir:    root,
+		state:  st,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		// Una pasada más para subir las copias de los conflictos
+		for pass := 0; pass < 3; pass++ {
+			again, err := s.reconcile(ctx)
+			if err != nil {
+				fatal("Sync failed", err)
+			}
+			if !again {
+				break
+			}
+		}
+		return
+	}
+	slog.Info("Sync started", "dir", root, "owner", *owner, "remote", s.remote)
+	if err := s.run(ctx, *interval, *debounce); err != nil {
+		fatal("Sync failed", err)
+	}
+	slog.Info("Sync stopped")
+}
+
+// fatal registra el error y termina el proceso.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+)
+
+// Directorio del estado y de las descargas en curso, excluido de la
+// sincronización
+const stateDir = ".fssync"
+
+// localItem es un archivo o carpeta del directorio local.
+type localItem struct {
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+	Hash    string
+}
+
+// remoteItem es un archivo o carpeta del servidor.
+type remoteItem struct {
+	Dir  bool
+	ID   string
+	Size int64
+	// SHA-256 calculado por el servidor; vacío si su pipeline no tiene la
+	// etapa hash
+	Hash     string
+	Modified time.Time
+}
+
+// scanLocal recorre el directorio local. Los archivos con el mismo tamaño y
+// fecha que en el último estado sincronizado reutilizan su hash.
+func (s *syncer) scanLocal(base map[string]*entry) (map[string]*localItem, error) {
+	items := make(map[string]*localItem)
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if p == s.dir {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == stateDir {
+			return filepath.SkipDir
+		}
+		// Los enlaces y archivos especiales no se sincronizan
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		item := &localItem{Dir: d.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+		if !item.Dir {
+			if b := base[rel]; b != nil && !b.Dir && b.Size == item.Size && b.ModTime.Equal(item.ModTime) {
+				item.Hash = b.Hash
+			} else if item.Hash, err = hashFile(p); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+		}
+		items[rel] = item
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", s.dir, err)
+	}
+	return items, nil
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// listRemote recorre la carpeta remota y retorna su contenido por ruta
+// relativa, junto con el id de la carpeta raíz.
+func (s *syncer) listRemote(ctx context.Context) (map[string]*remoteItem, string, error) {
+	items := make(map[string]*remoteItem)
+	root, err := s.client.ListFolder(ctx, &pb.ListFolderRequest{OwnerId: s.owner, Path: s.remote})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list remote folder %s: %w", s.remote, err)
+	}
+	var walk func(rel string, resp *pb.ListFolderResponse) error
+	walk = func(rel string, resp *pb.ListFolderResponse) error {
+		for _, f := range resp.Files {
+			items[path.Join(rel, f.Name)] = &remoteItem{
+				ID:       f.FileId,
+				Size:     f.Size,
+				Hash:     f.Sha256,
+				Modified: f.ModifiedAt.AsTime(),
+			}
+		}
+		for _, f := range resp.Folders {
+			child := path.Join(rel, f.Name)
+			items[child] = &remoteItem{Dir: true, ID: f.FolderId}
+			resp, err := s.client.ListFolder(ctx, &pb.ListFolderRequest{OwnerId: s.owner, FolderId: f.FolderId})
+			if err != nil {
+				return fmt.Errorf("failed to list remote folder %s: %w", f.Path, err)
+			}
+			if err := walk(child, resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("", root); err != nil {
+		return nil, "", err
+	}
+	return items, root.Folder.FolderId, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	entriesBucket = []byte("entries")
+	// Propietario y carpeta remota con los que se creó el estado
+	configBucket = []byte("config")
+)
+
+// entry es el último estado sincronizado de una ruta, cuando el contenido
+// local y el remoto coincidían. Sirve de base para decidir qué lado cambió.
+type entry struct {
+	Dir bool `json:"dir,omitempty"`
+	// file_id o folder_id remoto
+	RemoteID string `json:"remote_id"`
+	// SHA-256 del contenido local, con el tamaño y la fecha con que se
+	// calculó para no volver a leer archivos sin cambios
+	Hash    string    `json:"hash,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"mod_time,omitempty"`
+	// Fecha de modificación remota; si cambia, el archivo remoto cambió
+	RemoteModified time.Time `json:"remote_modified,omitempty"`
+}
+
+// state guarda las entradas sincronizadas en <dir>/.fssync/state.db, así
+// que sobrevive a los reinicios del daemon.
+type state struct {
+	db *bolt.DB
+}
+
+func openState(path, owner, remote string) (*state, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sync state: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(entriesBucket); err != nil {
+			return err
+		}
+		config, err := tx.CreateBucketIfNotExists(configBucket)
+		if err != nil {
+			return err
+		}
+		// Un estado creado para otra carpeta remota haría creer que todos
+		// los archivos se borraron de un lado
+		for key, value := range map[string]string{"owner": owner, "remote": remote} {
+			saved := config.Get([]byte(key))
+			if saved == nil {
+				if err := config.Put([]byte(key), []byte(value)); err != nil {
+					return err
+				}
+			} else if string(saved) != value {
+				return fmt.Errorf("directory is already synced with %s %q", key, saved)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &state{db: db}, nil
+}
+
+func (s *state) Close() error {
+	return s.db.Close()
+}
+
+// entries retorna todas las entradas por ruta relativa.
+func (s *state) entries() (map[string]*entry, error) {
+	entries := make(map[string]*entry)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).ForEach(func(k, v []byte) error {
+			e := new(entry)
+			if err := json.Unmarshal(v, e); err != nil {
+				return fmt.Errorf("corrupt sync state for %q: %w", k, err)
+			}
+			entries[string(k)] = e
+			return nil
+		})
+	})
+	return entries, err
+}
+
+func (s *state) put(rel string, e *entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Put([]byte(rel), data)
+	})
+}
+
+func (s *state) forget(rel string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(entriesBucket).Delete([]byte(rel))
+	})
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Tamaño de cada mensaje de Upload
+const chunkSize = 1024 * 1024
+
+// syncer mantiene un directorio local sincronizado en los dos sentidos con
+// una carpeta remota de un propietario.
+type syncer struct {
+	client pb.FileServiceClient
+	owner  string
+	// Carpeta remota, por ejemplo "/" o "/fotos"
+	remote string
+	dir    string
+	state  *state
+}
+
+// reconcile compara el directorio local y la carpeta remota con el último
+// estado sincronizado y aplica en cada lado los cambios del otro. Retorna
+// true si quedó trabajo para otra pasada, por ejemplo subir la copia local
+// de un conflicto.
+func (s *syncer) reconcile(ctx context.Context) (bool, error) {
+	base, err := s.state.entries()
+	if err != nil {
+		return false, err
+	}
+	local, err := s.scanLocal(base)
+	if err != nil {
+		return false, err
+	}
+	remote, rootID, err := s.listRemote(ctx)
+	if err != nil {
+		return false, err
+	}
+	r := &round{
+		syncer: s,
+		ctx:    ctx,
+		base:   base,
+		local:  local,
+		remote: remote,
+		rootID: rootID,
+		byHash: make(map[string]string),
+		moved:  make(map[string]bool),
+	}
+	return r.run(), nil
+}
+
+// round es una pasada de reconcile sobre una foto de los dos lados. Las
+// acciones actualizan local y remote para que las siguientes vean el
+// resultado.
+type round struct {
+	*syncer
+	ctx    context.Context
+	base   map[string]*entry
+	local  map[string]*localItem
+	remote map[string]*remoteItem
+	rootID string
+
+	// Ruta local de cada contenido, para copiar en lugar de descargar
+	byHash map[string]string
+	// Rutas cuyo archivo remoto se movió a otra ruta
+	moved map[string]bool
+	// Borrados pendientes, que se aplican al final de los hijos a los padres
+	deletes []string
+
+	again    bool
+	failures int
+}
+
+func (r *round) run() bool {
+	paths := make(map[string]bool)
+	for p := range r.base {
+		paths[p] = true
+	}
+	for p, l := range r.local {
+		paths[p] = true
+		if !l.Dir {
+			r.byHash[l.Hash] = p
+		}
+	}
+	for p := range r.remote {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	// Los padres antes que los hijos
+	slices.Sort(sorted)
+
+	renames := r.localRenames()
+	for _, p := range sorted {
+		r.check(p, r.sync(p, renames))
+	}
+	for i := len(r.deletes) - 1; i >= 0; i-- {
+		r.check(r.deletes[i], r.delete(r.deletes[i]))
+	}
+	if r.failures > 0 {
+		slog.Warn("Sync pass finished with errors", "failed", r.failures)
+	}
+	return r.again
+}
+
+func (r *round) check(p string, err error) {
+	if err != nil {
+		r.failures++
+		slog.Warn("Failed to sync path", "path", p, "error", err)
+	}
+}
+
+// sync decide qué hacer con una ruta según qué lado cambió desde el último
+// estado sincronizado.
+func (r *round) sync(p string, renames map[string]string) error {
+	l, rem, b := r.local[p], r.remote[p], r.base[p]
+	if l != nil && rem != nil && l.Dir != rem.Dir {
+		// Un archivo de un lado y una carpeta del otro
+		return r.conflict(p)
+	}
+	if b != nil && (l != nil && l.Dir != b.Dir || rem != nil && rem.Dir != b.Dir) {
+		b = nil
+	}
+	if (l != nil && l.Dir) || (rem != nil && rem.Dir) {
+		return r.syncDir(p, l, rem, b)
+	}
+
+	switch {
+	case l != nil && rem != nil:
+		if rem.Hash != "" && rem.Hash == l.Hash {
+			// Mismo contenido: no hay nada que transferir
+			if b == nil || b.Hash != l.Hash || b.RemoteID != rem.ID || !b.RemoteModified.Equal(rem.Modified) {
+				return r.record(p)
+			}
+			return nil
+		}
+		localChanged, remoteChanged := r.localChanged(l, b), r.remoteChanged(rem, b)
+		switch {
+		case localChanged && remoteChanged:
+			return r.conflict(p)
+		case localChanged:
+			return r.upload(p, rem.ID)
+		case remoteChanged:
+			return r.download(p)
+		}
+		return nil
+
+	case l != nil:
+		if from, ok := renames[p]; ok {
+			return r.moveRemote(from, p)
+		}
+		if b == nil || r.localChanged(l, b) {
+			return r.upload(p, "")
+		}
+		// Se borró del servidor y no cambió localmente
+		r.deletes = append(r.deletes, p)
+		return nil
+
+	case rem != nil:
+		if b == nil || r.remoteChanged(rem, b) {
+			return r.download(p)
+		}
+		// Se borró localmente y no cambió en el servidor
+		r.deletes = append(r.deletes, p)
+		return nil
+	}
+	// Borrado en los dos lados
+	return r.state.forget(p)
+}
+
+func (r *round) localChanged(l *localItem, b *entry) bool {
+	return b == nil || l.Hash != b.Hash
+}
+
+func (r *round) remoteChanged(rem *remoteItem, b *entry) bool {
+	return b == nil || rem.ID != b.RemoteID || !rem.Modified.Equal(b.RemoteModified)
+}
+
+func (r *round) syncDir(p string, l *localItem, rem *remoteItem, b *entry) error {
+	switch {
+	case l != nil && rem != nil:
+		if b == nil || b.RemoteID != rem.ID {
+			return r.record(p)
+		}
+		return nil
+	case l != nil:
+		if b == nil {
+			_, err := r.remoteDir(p)
+			return err
+		}
+	case rem != nil:
+		if b == nil {
+			return r.localDir(p)
+		}
+	default:
+		return r.state.forget(p)
+	}
+	// Borrada de un lado: se decide al final, después de sincronizar su
+	// contenido
+	r.deletes = append(r.deletes, p)
+	return nil
+}
+
+// localRenames empareja los archivos locales nuevos con los que
+// desaparecieron localmente sin cambiar en el servidor y tienen el mismo
+// contenido: son movimientos, que se aplican en el servidor sin volver a
+// subir el archivo.
+func (r *round) localRenames() map[string]string {
+	gone := make(map[string][]string)
+	for p, b := range r.base {
+		rem := r.remote[p]
+		if b.Dir || r.local[p] != nil || rem == nil || rem.Dir || r.remoteChanged(rem, b) {
+			continue
+		}
+		gone[b.Hash] = append(gone[b.Hash], p)
+	}
+	renames := make(map[string]string)
+	for p, l := range r.local {
+		if l.Dir || r.base[p] != nil || r.remote[p] != nil || len(gone[l.Hash]) == 0 {
+			continue
+		}
+		renames[p] = gone[l.Hash][0]
+		gone[l.Hash] = gone[l.Hash][1:]
+	}
+	return renames
+}
+
+// record guarda como sincronizado el estado actual de los dos lados.
+func (r *round) record(p string) error {
+	l, rem := r.local[p], r.remote[p]
+	return r.state.put(p, &entry{
+		Dir:            l.Dir,
+		RemoteID:       rem.ID,
+		Hash:           l.Hash,
+		Size:           l.Size,
+		ModTime:        l.ModTime,
+		RemoteModified: rem.Modified,
+	})
+}
+
+// remoteDir retorna el id de la carpeta remota p y la crea, junto con sus
+// padres, si no existe.
+func (r *round) remoteDir(p string) (string, error) {
+	if p == "." || p == "" {
+		return r.rootID, nil
+	}
+	if rem := r.remote[p]; rem != nil && rem.Dir {
+		return rem.ID, nil
+	}
+	parentID, err := r.remoteDir(path.Dir(p))
+	if err != nil {
+		return "", err
+	}
+	folder, err := r.client.CreateFolder(r.ctx, &pb.CreateFolderRequest{
+		OwnerId:  r.owner,
+		ParentId: parentID,
+		Name:     path.Base(p),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create remote folder: %w", err)
+	}
+	slog.Info("Created remote folder", "path", p)
+	r.remote[p] = &remoteItem{Dir: true, ID: folder.FolderId}
+	if l := r.local[p]; l != nil && l.Dir {
+		return folder.FolderId, r.record(p)
+	}
+	return folder.FolderId, nil
+}
+
+// localDir crea la carpeta local p y sus padres.
+func (r *round) localDir(p string) error {
+	if p == "." || p == "" {
+		return nil
+	}
+	if l := r.local[p]; l != nil && l.Dir {
+		return nil
+	}
+	if err := r.localDir(path.Dir(p)); err != nil {
+		return err
+	}
+	full := r.localPath(p)
+	if err := os.Mkdir(full, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return err
+	}
+	r.local[p] = &localItem{Dir: true, ModTime: info.ModTime()}
+	if rem := r.remote[p]; rem != nil && rem.Dir {
+		return r.record(p)
+	}
+	return nil
+}
+
+// upload sube el archivo local p. Con id vacío crea un archivo remoto nuevo;
+// si no, sube una versión nueva del existente.
+func (r *round) upload(p, id string) error {
+	folderID, err := r.remoteDir(path.Dir(p))
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		id = newFileID()
+	}
+	f, err := os.Open(r.localPath(p))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// La fecha se toma antes de leer: si el archivo cambia mientras se sube,
+	// la próxima pasada lo detecta y lo vuelve a subir
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Cancelar el stream descarta la subida; cerrarlo la confirmaría
+	// truncada
+	ctx, cancel := context.WithCancel(r.ctx)
+	defer cancel()
+	stream, err := r.client.Upload(ctx)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	buf := make([]byte, chunkSize)
+	req := &pb.FileUploadRequest{FileId: id, OwnerId: r.owner, FileName: path.Base(p), FolderId: folderID}
+	for first := true; ; first = false {
+		n, readErr := io.ReadFull(f, buf)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return readErr
+		}
+		if n == 0 && !first {
+			break
+		}
+		h.Write(buf[:n])
+		req.BinaryFile = buf[:n]
+		if err := stream.Send(req); err != nil {
+			break // CloseAndRecv retorna el error del servidor
+		}
+		req = &pb.FileUploadRequest{}
+		if n < chunkSize {
+			break
+		}
+	}
+	if _, err := stream.CloseAndRecv(); err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+
+	// El servidor puede cambiar el contenido (por ejemplo al quitar los
+	// metadatos de una imagen), así que el estado remoto se toma de StatFile
+	entry, err := r.client.StatFile(r.ctx, &pb.StatFileRequest{OwnerId: r.owner, FileId: id})
+	if err != nil {
+		return fmt.Errorf("failed to stat uploaded file: %w", err)
+	}
+	slog.Info("Uploaded file", "path", p, "file_id", id, "size", info.Size())
+	r.local[p] = &localItem{Size: info.Size(), ModTime: info.ModTime(), Hash: hex.EncodeToString(h.Sum(nil))}
+	r.remote[p] = &remoteItem{ID: id, Size: entry.Size, Hash: entry.Sha256, Modified: entry.ModifiedAt.AsTime()}
+	return r.record(p)
+}
+
+// download trae el archivo remoto p. Si ya hay un archivo local con el mismo
+// contenido lo copia en lugar de descargarlo.
+func (r *round) download(p string) error {
+	rem := r.remote[p]
+	tmp, err := os.CreateTemp(filepath.Join(r.dir, stateDir), "download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	w := io.MultiWriter(tmp, h)
+	copied := false
+	if src, ok := r.byHash[rem.Hash]; ok && rem.Hash != "" {
+		copied, err = copyLocal(r.localPath(src), w, rem.Hash)
+		if err != nil {
+			return err
+		}
+		if !copied {
+			tmp.Truncate(0)
+			tmp.Seek(0, io.SeekStart)
+			h.Reset()
+		}
+	}
+	if !copied {
+		if err := r.fetch(rem.ID, w); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	// No pisar un archivo local que cambió durante la descarga
+	target := r.localPath(p)
+	if info, err := os.Stat(target); err == nil {
+		l := r.local[p]
+		if l == nil || l.Dir || info.Size() != l.Size || !info.ModTime().Equal(l.ModTime) {
+			r.again = true
+			return nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := r.localDir(path.Dir(p)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	if copied {
+		slog.Info("Copied file from identical local file", "path", p, "file_id", rem.ID)
+	} else {
+		slog.Info("Downloaded file", "path", p, "file_id", rem.ID, "size", info.Size())
+	}
+	r.local[p] = &localItem{Size: info.Size(), ModTime: info.ModTime(), Hash: hex.EncodeToString(h.Sum(nil))}
+	r.byHash[r.local[p].Hash] = p
+	return r.record(p)
+}
+
+func (r *round) fetch(id string, w io.Writer) error {
+	stream, err := r.client.Download(r.ctx, &pb.FileDownloadRequest{OwnerId: r.owner, FileId: id})
+	if err != nil {
+		return err
+	}
+	for {
+		msg, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+		if _, err := w.Write(msg.BinaryFileResponse); err != nil {
+			return err
+		}
+	}
+}
+
+// copyLocal copia src en w si su contenido sigue teniendo el hash esperado.
+func copyLocal(src string, w io.Writer, hash string) (bool, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), f); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)) == hash, nil
+}
+
+// moveRemote aplica en el servidor un movimiento local de from a p.
+func (r *round) moveRemote(from, p string) error {
+	rem := r.remote[from]
+	var resp *pb.ItemResponse
+	var err error
+	if path.Base(from) != path.Base(p) {
+		resp, err = r.client.Rename(r.ctx, &pb.RenameRequest{
+			OwnerId: r.owner,
+			Item:    &pb.RenameRequest_FileId{FileId: rem.ID},
+			NewName: path.Base(p),
+		})
+	}
+	if err == nil && path.Dir(from) != path.Dir(p) {
+		var folderID string
+		if folderID, err = r.remoteDir(path.Dir(p)); err == nil {
+			resp, err = r.client.Move(r.ctx, &pb.MoveRequest{
+				OwnerId:      r.owner,
+				Item:         &pb.MoveRequest_FileId{FileId: rem.ID},
+				DestFolderId: folderID,
+			})
+		}
+	}
+	if err != nil {
+		// Por ejemplo, si el nombre ya existe en el destino: se sube como
+		// archivo nuevo y el original se borra en la pasada siguiente
+		slog.Warn("Failed to move remote file, uploading instead", "from", from, "path", p, "error", err)
+		return r.upload(p, "")
+	}
+	slog.Info("Moved remote file", "from", from, "path", p, "file_id", rem.ID)
+	f := resp.GetFile()
+	r.remote[p] = &remoteItem{ID: rem.ID, Size: f.Size, Hash: f.Sha256, Modified: f.ModifiedAt.AsTime()}
+	delete(r.remote, from)
+	r.moved[from] = true
+	if err := r.state.forget(from); err != nil {
+		return err
+	}
+	return r.record(p)
+}
+
+// conflict conserva las dos versiones: la local se renombra con un sufijo de
+// conflicto (y se sube en la pasada siguiente) y la remota ocupa la ruta
+// original.
+func (r *round) conflict(p string) error {
+	now := time.Now()
+	name := conflictName(p, now, 1)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(r.localPath(name)); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		name = conflictName(p, now, n)
+	}
+	if err := os.Rename(r.localPath(p), r.localPath(name)); err != nil {
+		return err
+	}
+	slog.Warn("Sync conflict, kept both copies", "path", p, "local_copy", name)
+	// La copia local y su contenido se suben en la pasada siguiente
+	for q := range r.local {
+		if q == p || strings.HasPrefix(q, p+"/") {
+			delete(r.local, q)
+		}
+	}
+	r.again = true
+
+	if r.remote[p].Dir {
+		return r.localDir(p)
+	}
+	return r.download(p)
+}
+
+// conflictName agrega el sufijo de conflicto antes de la extensión:
+// "informe.txt" pasa a "informe (conflict 2024-05-01 153000).txt", o a
+// "informe (conflict 2024-05-01 153000 2).txt" si n es 2.
+func conflictName(p string, t time.Time, n int) string {
+	ext := path.Ext(p)
+	if ext == path.Base(p) {
+		// Archivos como ".env", sin nombre antes de la extensión
+		ext = ""
+	}
+	suffix := " (conflict " + t.Format("2006-01-02 150405")
+	if n > 1 {
+		suffix += fmt.Sprintf(" %d", n)
+	}
+	return strings.TrimSuffix(p, ext) + suffix + ")" + ext
+}
+
+// delete aplica un borrado pendiente en el lado donde la ruta sigue
+// existiendo.
+func (r *round) delete(p string) error {
+	l, rem := r.local[p], r.remote[p]
+	switch {
+	case r.moved[p]:
+		return nil
+	case l != nil && rem != nil:
+		// Volvió a aparecer en los dos lados durante la pasada
+		return r.record(p)
+	case l != nil && l.Dir:
+		// Solo se borra si quedó vacía. Si conserva archivos que no se
+		// pudieron sincronizar, se vuelve a crear en el servidor.
+		if err := os.Remove(r.localPath(p)); err != nil {
+			_, err := r.remoteDir(p)
+			return err
+		}
+		slog.Info("Removed local folder deleted on the server", "path", p)
+	case l != nil:
+		info, err := os.Stat(r.localPath(p))
+		if err != nil || info.Size() != l.Size || !info.ModTime().Equal(l.ModTime) {
+			// Cambió durante la pasada: se decide en la siguiente
+			r.again = true
+			return nil
+		}
+		if err := os.Remove(r.localPath(p)); err != nil {
+			return err
+		}
+		slog.Info("Removed local file deleted on the server", "path", p)
+	case rem != nil:
+		req := &pb.DeleteRequest{OwnerId: r.owner, Item: &pb.DeleteRequest_FileId{FileId: rem.ID}}
+		if rem.Dir {
+			req.Item = &pb.DeleteRequest_FolderId{FolderId: rem.ID}
+		}
+		if _, err := r.client.Delete(r.ctx, req); err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("failed to delete remote item: %w", err)
+		}
+		slog.Info("Moved remote item to trash", "path", p)
+	}
+	delete(r.local, p)
+	delete(r.remote, p)
+	return r.state.forget(p)
+}
+
+func (s *syncer) localPath(rel string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(rel))
+}
+
+func newFileID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
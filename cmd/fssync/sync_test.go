@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/server"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(servertest.Main(m))
+}
+
+// testServer es un FileService en memoria que cuenta las transferencias.
+type testServer struct {
+	client             pb.FileServiceClient
+	uploads, downloads atomic.Int32
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	store := servertest.OpenStore(t)
+	ts := &testServer{}
+	count := func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		switch info.FullMethod {
+		case pb.FileService_Upload_FullMethodName:
+			ts.uploads.Add(1)
+		case pb.FileService_Download_FullMethodName:
+			ts.downloads.Add(1)
+		}
+		return handler(srv, ss)
+	}
+	conn := servertest.Dial(t, func(s *grpc.Server) {
+		pb.RegisterFileServiceServer(s, server.NewFileService(store))
+	}, grpc.StreamInterceptor(count))
+	ts.client = pb.NewFileServiceClient(conn)
+	return ts
+}
+
+// replica es un directorio local sincronizado con el servidor.
+type replica struct {
+	owner, dir string
+	syncer     *syncer
+}
+
+func (r *replica) open(t *testing.T, client pb.FileServiceClient) {
+	t.Helper()
+	st, err := openState(filepath.Join(r.dir, stateDir, "state.db"), r.owner, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.syncer = &syncer{client: client, owner: r.owner, remote: "/", dir: r.dir, state: st}
+}
+
+func (r *replica) close(t *testing.T) {
+	t.Helper()
+	if err := r.syncer.state.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sync repite reconcile como fssync -once.
+func (r *replica) sync(t *testing.T) {
+	t.Helper()
+	for pass := 0; pass < 3; pass++ {
+		again, err := r.syncer.reconcile(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !again {
+			return
+		}
+	}
+	t.Fatal("sync did not settle after 3 passes")
+}
+
+// Sufijo de conflicto sin la fecha, para comparar
+var conflictSuffix = regexp.MustCompile(` \(conflict [0-9-]+ [0-9]+( [0-9]+)?\)`)
+
+// files retorna el contenido del directorio: los archivos con su contenido y
+// las carpetas terminadas en "/".
+func (r *replica) files(t *testing.T) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(r.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == r.dir {
+			return err
+		}
+		rel, _ := filepath.Rel(r.dir, p)
+		rel = conflictSuffix.ReplaceAllString(filepath.ToSlash(rel), " (conflict)")
+		switch {
+		case rel == stateDir:
+			return filepath.SkipDir
+		case d.IsDir():
+			files[rel+"/"] = ""
+		default:
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			files[rel] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// step es una acción sobre una de las dos réplicas, "a" o "b".
+type step struct {
+	replica string
+	// write, remove, rename, sync o restart
+	action string
+	path   string
+	// Contenido de write o destino de rename
+	arg string
+}
+
+func TestSync(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []step
+		// Contenido final de las dos réplicas
+		want                       map[string]string
+		wantUploads, wantDownloads int32
+	}{
+		{
+			name: "new files both ways",
+			steps: []step{
+				{"a", "write", "x.txt", "one"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"b", "write", "y.txt", "two"},
+				{"b", "sync", "", ""},
+				{"a", "sync", "", ""},
+			},
+			want:        map[string]string{"x.txt": "one", "y.txt": "two"},
+			wantUploads: 2, wantDownloads: 2,
+		},
+		{
+			name: "folders",
+			steps: []step{
+				{"a", "write", "docs/2024/report.txt", "numbers"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+			},
+			want:        map[string]string{"docs/": "", "docs/2024/": "", "docs/2024/report.txt": "numbers"},
+			wantUploads: 1, wantDownloads: 1,
+		},
+		{
+			name: "unchanged files are not transferred again",
+			steps: []step{
+				{"a", "write", "x.txt", "one"},
+				{"a", "sync", "", ""},
+				{"a", "sync", "", ""},
+				{"a", "restart", "", ""},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"b", "restart", "", ""},
+				{"b", "sync", "", ""},
+			},
+			want:        map[string]string{"x.txt": "one"},
+			wantUploads: 1, wantDownloads: 1,
+		},
+		{
+			name: "same content on both sides",
+			steps: []step{
+				{"a", "write", "x.txt", "same"},
+				{"b", "write", "x.txt", "same"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+			},
+			want:        map[string]string{"x.txt": "same"},
+			wantUploads: 1, wantDownloads: 0,
+		},
+		{
+			name: "deletions propagate",
+			steps: []step{
+				{"a", "write", "x.txt", "one"},
+				{"a", "write", "keep.txt", "two"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"a", "remove", "x.txt", ""},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+			},
+			want:        map[string]string{"keep.txt": "two"},
+			wantUploads: 2, wantDownloads: 2,
+		},
+		{
+			name: "renames move the remote file",
+			steps: []step{
+				{"a", "write", "x.txt", "content"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"a", "rename", "x.txt", "z.txt"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+			},
+			// b copia el contenido de su x.txt en lugar de descargarlo
+			want:        map[string]string{"z.txt": "content"},
+			wantUploads: 1, wantDownloads: 1,
+		},
+		{
+			name: "conflict keeps both copies",
+			steps: []step{
+				{"a", "write", "x.txt", "base"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"a", "write", "x.txt", "edited in a"},
+				{"b", "write", "x.txt", "edited in b!"},
+				{"a", "sync", "", ""},
+				{"b", "sync", "", ""},
+				{"a", "sync", "", ""},
+			},
+			want:        map[string]string{"x.txt": "edited in a", "x (conflict).txt": "edited in b!"},
+			wantUploads: 3, wantDownloads: 3,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			// Cada caso usa su propio propietario: el NFS es compartido
+			owner := "owner" + strconv.Itoa(i)
+			replicas := map[string]*replica{
+				"a": {owner: owner, dir: t.TempDir()},
+				"b": {owner: owner, dir: t.TempDir()},
+			}
+			for _, r := range replicas {
+				r.open(t, ts.client)
+				defer r.close(t)
+			}
+
+			for _, s := range tt.steps {
+				r := replicas[s.replica]
+				p := filepath.Join(r.dir, filepath.FromSlash(s.path))
+				var err error
+				switch s.action {
+				case "write":
+					if err = os.MkdirAll(filepath.Dir(p), 0755); err == nil {
+						err = os.WriteFile(p, []byte(s.arg), 0644)
+					}
+				case "remove":
+					err = os.Remove(p)
+				case "rename":
+					err = os.Rename(p, filepath.Join(r.dir, filepath.FromSlash(s.arg)))
+				case "sync":
+					r.sync(t)
+				case "restart":
+					r.close(t)
+					r.open(t, ts.client)
+				default:
+					t.Fatalf("unknown action %q", s.action)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for name, r := range replicas {
+				if got := r.files(t); !maps.Equal(got, tt.want) {
+					t.Errorf("replica %s = %v, want %v", name, got, tt.want)
+				}
+			}
+			if got := ts.uploads.Load(); got != tt.wantUploads {
+				t.Errorf("uploads = %d, want %d", got, tt.wantUploads)
+			}
+			if got := ts.downloads.Load(); got != tt.wantDownloads {
+				t.Errorf("downloads = %d, want %d", got, tt.wantDownloads)
+			}
+		})
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	now, err := time.Parse(time.DateTime, "2024-05-01 15:30:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		n    int
+		want string
+	}{
+		{"informe.txt", 1, "informe (conflict 2024-05-01 153000).txt"},
+		{"informe.txt", 2, "informe (conflict 2024-05-01 153000 2).txt"},
+		{"docs/a.tar.gz", 1, "docs/a.tar (conflict 2024-05-01 153000).gz"},
+		{".env", 1, ".env (conflict 2024-05-01 153000)"},
+		{"Makefile", 1, "Makefile (conflict 2024-05-01 153000)"},
+	}
+	for _, tt := range tests {
+		if got := conflictName(tt.path, now, tt.n); got != tt.want {
+			t.Errorf("conflictName(%q, %d) = %q, want %q", tt.path, tt.n, got, tt.want)
+		}
+	}
+}
+
+// El estado guarda la carpeta remota: abrirlo para otra es un error.
+func TestStateRemoteMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), stateDir, "state.db")
+	st, err := openState(path, "o", "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Close()
+
+	tests := []struct {
+		owner, remote string
+		wantErr       bool
+	}{
+		{"o", "/", false},
+		{"o", "/photos", true},
+		{"other", "/", true},
+	}
+	for _, tt := range tests {
+		st, err := openState(path, tt.owner, tt.remote)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("openState(%q, %q) error = %v, wantErr %v", tt.owner, tt.remote, err, tt.wantErr)
+		}
+		if err == nil {
+			st.Close()
+		}
+	}
+}
+
+// Con run, los cambios locales de una réplica llegan a la otra sin pasadas
+// manuales: fsnotify los detecta en a y WatchFiles avisa a b.
+func TestRunFollowsChanges(t *testing.T) {
+	ts := newTestServer(t)
+	replicas := []*replica{
+		{owner: "watcher", dir: t.TempDir()},
+		{owner: "watcher", dir: t.TempDir()},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var running sync.WaitGroup
+	for _, r := range replicas {
+		r.open(t, ts.client)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			if err := r.syncer.run(ctx, time.Hour, 20*time.Millisecond); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		running.Wait()
+		for _, r := range replicas {
+			r.close(t)
+		}
+	}()
+	a, b := replicas[0], replicas[1]
+
+	tests := []struct {
+		name   string
+		change func(dir string) error
+		want   map[string]string
+	}{
+		{
+			name:   "new file",
+			change: func(dir string) error { return os.WriteFile(filepath.Join(dir, "x.txt"), []byte("one"), 0644) },
+			want:   map[string]string{"x.txt": "one"},
+		},
+		{
+			name: "file in a new folder",
+			change: func(dir string) error {
+				if err := os.MkdirAll(filepath.Join(dir, "docs", "2024"), 0755); err != nil {
+					return err
+				}
+				return os.WriteFile(filepath.Join(dir, "docs", "2024", "r.txt"), []byte("report"), 0644)
+			},
+			want: map[string]string{"x.txt": "one", "docs/": "", "docs/2024/": "", "docs/2024/r.txt": "report"},
+		},
+		{
+			name:   "modified file",
+			change: func(dir string) error { return os.WriteFile(filepath.Join(dir, "x.txt"), []byte("one, edited"), 0644) },
+			want:   map[string]string{"x.txt": "one, edited", "docs/": "", "docs/2024/": "", "docs/2024/r.txt": "report"},
+		},
+		{
+			name:   "deleted file",
+			change: func(dir string) error { return os.Remove(filepath.Join(dir, "x.txt")) },
+			want:   map[string]string{"docs/": "", "docs/2024/": "", "docs/2024/r.txt": "report"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(a.dir); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				got := b.files(t)
+				if maps.Equal(got, tt.want) {
+					return
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("replica b = %v, want %v", got, tt.want)
+				}
+				time.Sleep(20 * time.Millisecond)
+			}
+		})
+	}
+}
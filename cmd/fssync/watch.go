@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Los cambios locales se detectan con inotify y los remotos con WatchFiles.
+// Ninguno de los dos se aplica directamente: solo agendan una pasada de
+// reconcile, que compara el estado completo. Así un evento perdido (por
+// desborde de la cola de inotify o una reconexión) no deja nada sin
+// sincronizar.
+
+// run sincroniza hasta que se cancele el contexto. Cada cambio agenda una
+// pasada después de debounce sin cambios nuevos; además se hace una cada
+// interval.
+func (s *syncer) run(ctx context.Context, interval, debounce time.Duration) error {
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	watcher, err := s.watchLocal(ctx, notify)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	go s.watchRemote(ctx, notify)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		again, err := s.reconcile(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Sync pass failed", "error", err)
+		}
+		if again {
+			notify()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			continue
+		case <-changed:
+		}
+		// Esperar a que los cambios se calmen, por ejemplo mientras se
+		// copia un archivo grande
+		quiet := time.NewTimer(debounce)
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				quiet.Stop()
+				return nil
+			case <-changed:
+				quiet.Reset(debounce)
+			case <-quiet.C:
+				break wait
+			}
+		}
+	}
+}
+
+// watchLocal observa el directorio local y sus subcarpetas, incluidas las que
+// se creen después.
+func (s *syncer) watchLocal(ctx context.Context, notify func()) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	add := func(root string) {
+		filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.IsDir() {
+				return nil
+			}
+			if p == filepath.Join(s.dir, stateDir) {
+				return filepath.SkipDir
+			}
+			if err := watcher.Add(p); err != nil {
+				slog.Warn("Failed to watch local folder", "path", p, "error", err)
+			}
+			return nil
+		})
+	}
+	add(s.dir)
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Name == filepath.Join(s.dir, stateDir) {
+					continue
+				}
+				if event.Has(fsnotify.Create) {
+					if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+						add(event.Name)
+					}
+				}
+				notify()
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Por ejemplo, eventos perdidos: la pasada completa los recupera
+				slog.Warn("Local watcher error", "error", err)
+				notify()
+			}
+		}
+	}()
+	return watcher, nil
+}
+
+// Espera máxima entre reconexiones a WatchFiles
+const maxReconnectDelay = time.Minute
+
+// watchRemote sigue los cambios de la carpeta remota y se reconecta con el
+// último cursor si se corta la conexión.
+func (s *syncer) watchRemote(ctx context.Context, notify func()) {
+	var cursor string
+	delay := time.Second
+	for {
+		connected, err := s.followRemote(ctx, &cursor, notify)
+		if ctx.Err() != nil {
+			return
+		}
+		switch status.Code(err) {
+		case codes.Unimplemented:
+			slog.Warn("Server does not support WatchFiles, relying on periodic sync")
+			return
+		case codes.OutOfRange:
+			// El cursor expiró: se sigue desde ahora y la pasada completa
+			// recupera lo perdido
+			cursor = ""
+		}
+		if connected {
+			delay = time.Second
+		}
+		slog.Warn("Remote watch interrupted, reconnecting", "error", err, "retry_in", delay.String())
+		// Pudo haber cambios mientras no se observaba
+		notify()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxReconnectDelay)
+	}
+}
+
+// followRemote recibe eventos hasta que se corte el stream. connected indica
+// si llegó a recibir alguno.
+func (s *syncer) followRemote(ctx context.Context, cursor *string, notify func()) (connected bool, err error) {
+	stream, err := s.client.WatchFiles(ctx, &pb.WatchFilesRequest{
+		OwnerId:     s.owner,
+		FolderPath:  s.remote,
+		SinceCursor: *cursor,
+	})
+	if err != nil {
+		return false, err
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			return connected, err
+		}
+		connected = true
+		*cursor = event.Cursor
+		if event.Type != "heartbeat" {
+			notify()
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algoritmos de compresión
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+// codec comprime los frames y envuelve los bloques de la tabla de búsqueda
+// de un algoritmo.
+type codec interface {
+	compress(dst, src []byte) ([]byte, error)
+	// decompress agrega a dst el contenido de un frame, que no puede tener
+	// más de FrameSize bytes
+	decompress(dst, src []byte) ([]byte, error)
+	// wrapTable agrega a dst un bloque de la tabla envuelto de forma que
+	// los descompresores lo ignoren
+	wrapTable(dst, block []byte) []byte
+	// checkWrapper comprueba los bytes que wrapTable puso antes y después
+	// de un bloque de blockLen bytes
+	checkWrapper(header, trailer []byte, blockLen int) bool
+	headerSize() int
+	trailerSize() int
+}
+
+// Supported indica si name es un algoritmo conocido.
+func Supported(name string) bool {
+	_, err := codecFor(name)
+	return err == nil
+}
+
+// ContentType retorna el tipo MIME de un stream comprimido con name.
+func ContentType(name string) string {
+	switch name {
+	case Zstd:
+		return "application/zstd"
+	case Gzip:
+		return "application/gzip"
+	}
+	return "application/octet-stream"
+}
+
+func codecFor(name string) (codec, error) {
+	switch name {
+	case Zstd:
+		return zstdCodec{}, nil
+	case Gzip:
+		return gzipCodec{}, nil
+	}
+	return nil, fmt.Errorf("unknown compression %q", name)
+}
+
+// Ratio comprime sample como un frame y retorna cuántas veces más chico
+// queda. Sirve para decidir si vale la pena comprimir un archivo a partir
+// de su comienzo.
+func Ratio(name string, sample []byte) (float64, error) {
+	c, err := codecFor(name)
+	if err != nil {
+		return 0, err
+	}
+	out, err := c.compress(nil, sample)
+	if err != nil {
+		return 0, err
+	}
+	return float64(len(sample)) / float64(len(out)), nil
+}
+
+// zstd: la tabla va en un frame skippable, que los descompresores saltan
+type zstdCodec struct{}
+
+const zstdSkippableMagic = 0x184D2A5A
+
+// El codificador y el decodificador admiten EncodeAll y DecodeAll
+// concurrentes
+var (
+	zstdEncoder = sync.OnceValue(func() *zstd.Encoder {
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			panic(err)
+		}
+		return enc
+	})
+	zstdDecoder = sync.OnceValue(func() *zstd.Decoder {
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(FrameSize))
+		if err != nil {
+			panic(err)
+		}
+		return dec
+	})
+)
+
+func (zstdCodec) compress(dst, src []byte) ([]byte, error) {
+	return zstdEncoder().EncodeAll(src, dst), nil
+}
+
+func (zstdCodec) decompress(dst, src []byte) ([]byte, error) {
+	return zstdDecoder().DecodeAll(src, dst)
+}
+
+func (zstdCodec) wrapTable(dst, block []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, zstdSkippableMagic)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(block)))
+	return append(dst, block...)
+}
+
+func (zstdCodec) checkWrapper(header, _ []byte, blockLen int) bool {
+	return binary.LittleEndian.Uint32(header) == zstdSkippableMagic &&
+		binary.LittleEndian.Uint32(header[4:]) == uint32(blockLen)
+}
+
+func (zstdCodec) headerSize() int  { return 8 }
+func (zstdCodec) trailerSize() int { return 0 }
+
+// gzip: cada frame es un miembro y la tabla va en el campo extra (FEXTRA)
+// de un miembro vacío
+type gzipCodec struct{}
+
+// Encabezado de miembro gzip: deflate, FEXTRA, sin fecha, SO desconocido
+var gzipTableHeader = []byte{0x1f, 0x8b, 8, 4, 0, 0, 0, 0, 0, 0xff}
+
+// Deflate vacío, CRC-32 e ISIZE de un miembro sin contenido
+var gzipTableTrailer = []byte{3, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+// Identificador del subcampo de FEXTRA con la tabla
+const gzipSubfield = "FS"
+
+func (gzipCodec) compress(dst, src []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) decompress(dst, src []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	r.Multistream(false)
+	buf := bytes.NewBuffer(dst)
+	n, err := io.Copy(buf, io.LimitReader(r, FrameSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > FrameSize {
+		return nil, ErrCorrupt
+	}
+	return buf.Bytes(), nil
+}
+
+func (gzipCodec) wrapTable(dst, block []byte) []byte {
+	dst = append(dst, gzipTableHeader...)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(4+len(block)))
+	dst = append(dst, gzipSubfield...)
+	dst = binary.LittleEndian.AppendUint16(dst, uint16(len(block)))
+	dst = append(dst, block...)
+	return append(dst, gzipTableTrailer...)
+}
+
+func (gzipCodec) checkWrapper(header, trailer []byte, blockLen int) bool {
+	return bytes.Equal(header[:10], gzipTableHeader) &&
+		binary.LittleEndian.Uint16(header[10:]) == uint16(4+blockLen) &&
+		string(header[12:14]) == gzipSubfield &&
+		binary.LittleEndian.Uint16(header[14:]) == uint16(blockLen) &&
+		bytes.Equal(trailer, gzipTableTrailer)
+}
+
+func (gzipCodec) headerSize() int  { return 16 }
+func (gzipCodec) trailerSize() int { return len(gzipTableTrailer) }
@@ -0,0 +1,93 @@
+// Package grpczstd registra un compresor zstd para gRPC, equivalente a
+// google.golang.org/grpc/encoding/gzip. Basta con importarlo.
+package grpczstd
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/encoding"
+)
+
+// Name es el nombre del compresor en grpc-encoding y grpc-accept-encoding
+const Name = "zstd"
+
+// Ventana máxima que se acepta al descomprimir, para que un mensaje no pueda
+// reservar más memoria. Los compresores usan ventanas de hasta 8 MiB salvo
+// en modo --long.
+const maxWindow = 16 << 20
+
+func init() {
+	encoding.RegisterCompressor(&compressor{})
+}
+
+// compressor reutiliza los codificadores y decodificadores, que son caros de
+// crear. Con concurrencia 1 trabajan sin goroutines propias.
+type compressor struct {
+	encoders sync.Pool
+	decoders sync.Pool
+}
+
+func (c *compressor) Name() string {
+	return Name
+}
+
+func (c *compressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	enc, ok := c.encoders.Get().(*zstd.Encoder)
+	if !ok {
+		var err error
+		enc, err = zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithEncoderLevel(zstd.SpeedFastest))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		enc.Reset(w)
+	}
+	return &writer{Encoder: enc, pool: &c.encoders}, nil
+}
+
+type writer struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (w *writer) Close() error {
+	err := w.Encoder.Close()
+	w.pool.Put(w.Encoder)
+	return err
+}
+
+func (c *compressor) Decompress(r io.Reader) (io.Reader, error) {
+	dec, ok := c.decoders.Get().(*zstd.Decoder)
+	if !ok {
+		var err error
+		dec, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxWindow))
+		if err != nil {
+			return nil, err
+		}
+	} else if err := dec.Reset(r); err != nil {
+		c.decoders.Put(dec)
+		return nil, err
+	}
+	return &reader{dec: dec, pool: &c.decoders}, nil
+}
+
+// reader devuelve el decodificador al pool al terminar el mensaje. Si el
+// mensaje no se lee completo, el decodificador simplemente no se reutiliza.
+type reader struct {
+	dec  *zstd.Decoder
+	pool *sync.Pool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.dec == nil {
+		return 0, io.EOF
+	}
+	n, err := r.dec.Read(p)
+	if err == io.EOF {
+		r.pool.Put(r.dec)
+		r.dec = nil
+	}
+	return n, err
+}
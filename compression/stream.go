@@ -0,0 +1,293 @@
+// Package compression comprime el contenido guardado en frames
+// independientes, con una tabla de búsqueda al final para leer cualquier
+// rango sin descomprimir lo anterior. El resultado es un stream zstd o gzip
+// estándar: cualquier descompresor lo lee completo e ignora la tabla, así que
+// se puede entregar tal cual a un cliente que acepte ese algoritmo.
+package compression
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// Formato del contenido comprimido:
+//
+//	frames: cada FrameSize bytes del contenido, comprimidos por separado
+//	tabla:  uno o más bloques, cada uno envuelto según el algoritmo (ver codec)
+//
+// Cada bloque de la tabla tiene los tamaños comprimidos de sus frames
+// (uint32), en orden, y termina con su cantidad de frames (uint32), "FSZ1" y
+// el tamaño del contenido sin comprimir (uint64), en little endian. Los
+// bloques se leen desde el final del archivo hacia atrás hasta completar los
+// frames que corresponden al tamaño. Todos los frames salvo el último tienen
+// FrameSize bytes sin comprimir; siempre hay al menos uno, aunque esté vacío.
+
+// FrameSize es el contenido sin comprimir de cada frame
+const FrameSize = 1 << 20
+
+const (
+	footerSize = 16
+	// Frames por bloque de la tabla, para que un bloque entre en el campo
+	// extra de gzip (64 KiB)
+	maxBlockFrames = 16000
+)
+
+var footerMagic = []byte("FSZ1")
+
+// ErrCorrupt indica que el contenido comprimido está dañado o incompleto.
+var ErrCorrupt = errors.New("compressed content is corrupt")
+
+// frames retorna cuántos frames tiene un contenido de size bytes.
+func frames(size int64) int64 {
+	return max(1, (size+FrameSize-1)/FrameSize)
+}
+
+// Writer comprime lo que se le escribe. Close escribe el último frame y la
+// tabla y es obligatorio; no cierra el destino.
+type Writer struct {
+	w      io.Writer
+	codec  codec
+	buf    []byte
+	out    []byte
+	sizes  []uint32
+	size   int64
+	closed bool
+}
+
+// NewWriter comprime hacia w con el algoritmo name (Zstd o Gzip).
+func NewWriter(w io.Writer, name string) (*Writer, error) {
+	c, err := codecFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, codec: c, buf: make([]byte, 0, FrameSize)}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write on closed compression writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close comprime el último frame, si quedó contenido o no hubo ninguno, y
+// escribe la tabla.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) > 0 || len(w.sizes) == 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	for start := 0; start < len(w.sizes); start += maxBlockFrames {
+		sizes := w.sizes[start:min(start+maxBlockFrames, len(w.sizes))]
+		block := make([]byte, 0, 4*len(sizes)+footerSize)
+		for _, size := range sizes {
+			block = binary.LittleEndian.AppendUint32(block, size)
+		}
+		block = binary.LittleEndian.AppendUint32(block, uint32(len(sizes)))
+		block = append(block, footerMagic...)
+		block = binary.LittleEndian.AppendUint64(block, uint64(w.size))
+		if _, err := w.w.Write(w.codec.wrapTable(nil, block)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *Writer) flush() error {
+	out, err := w.codec.compress(w.out[:0], w.buf)
+	if err != nil {
+		return err
+	}
+	if int64(len(out)) > 1<<32-1 {
+		return errors.New("compressed frame is too large")
+	}
+	w.out = out
+	w.sizes = append(w.sizes, uint32(len(out)))
+	w.size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	_, err = w.w.Write(out)
+	return err
+}
+
+// Reader descomprime contenido con lecturas aleatorias. Es seguro para
+// lecturas concurrentes.
+type Reader struct {
+	r     io.ReaderAt
+	codec codec
+	// offsets[i] es el inicio del frame i; el último elemento es el fin de
+	// los frames
+	offsets []int64
+	size    int64
+
+	// Último frame descomprimido, para lecturas secuenciales pequeñas
+	mu      sync.Mutex
+	cached  int64
+	frame   []byte
+	scratch []byte
+}
+
+// NewReader descomprime el contenido de r, de size bytes, comprimido con
+// el algoritmo name.
+func NewReader(r io.ReaderAt, size int64, name string) (*Reader, error) {
+	c, err := codecFor(name)
+	if err != nil {
+		return nil, err
+	}
+	var blocks [][]uint32
+	var total, found int64
+	want := int64(-1)
+	pos := size
+	for want < 0 || found < want {
+		sizes, blockSize, start, err := readBlock(r, c, pos)
+		if err != nil {
+			return nil, err
+		}
+		if want < 0 {
+			total, want = blockSize, frames(blockSize)
+		}
+		if blockSize != total || found+int64(len(sizes)) > want {
+			return nil, ErrCorrupt
+		}
+		blocks = append(blocks, sizes)
+		found += int64(len(sizes))
+		pos = start
+	}
+
+	// Los bloques se leyeron del último al primero
+	offsets := make([]int64, 1, want+1)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		for _, size := range blocks[i] {
+			offsets = append(offsets, offsets[len(offsets)-1]+int64(size))
+		}
+	}
+	if offsets[len(offsets)-1] != pos {
+		return nil, ErrCorrupt
+	}
+	return &Reader{r: r, codec: c, offsets: offsets, size: total, cached: -1}, nil
+}
+
+// readBlock lee el bloque de la tabla que termina en end y retorna los
+// tamaños de sus frames, el tamaño sin comprimir que indica y dónde empieza.
+func readBlock(r io.ReaderAt, c codec, end int64) (sizes []uint32, size, start int64, err error) {
+	footerEnd := end - int64(c.trailerSize())
+	if footerEnd-footerSize-int64(c.headerSize()) < 0 {
+		return nil, 0, 0, ErrCorrupt
+	}
+	footer := make([]byte, footerSize)
+	if err := readFull(r, footer, footerEnd-footerSize); err != nil {
+		return nil, 0, 0, err
+	}
+	count := int64(binary.LittleEndian.Uint32(footer))
+	size = int64(binary.LittleEndian.Uint64(footer[8:]))
+	if string(footer[4:8]) != string(footerMagic) || count == 0 || count > maxBlockFrames || size < 0 {
+		return nil, 0, 0, ErrCorrupt
+	}
+
+	blockLen := 4*count + footerSize
+	start = footerEnd - blockLen - int64(c.headerSize())
+	if start < 0 {
+		return nil, 0, 0, ErrCorrupt
+	}
+	buf := make([]byte, end-start)
+	if err := readFull(r, buf, start); err != nil {
+		return nil, 0, 0, err
+	}
+	header, block, trailer := buf[:c.headerSize()], buf[c.headerSize():len(buf)-c.trailerSize()], buf[len(buf)-c.trailerSize():]
+	if !c.checkWrapper(header, trailer, int(blockLen)) {
+		return nil, 0, 0, ErrCorrupt
+	}
+	sizes = make([]uint32, count)
+	for i := range sizes {
+		sizes[i] = binary.LittleEndian.Uint32(block[4*i:])
+	}
+	return sizes, size, start, nil
+}
+
+func readFull(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		return ErrCorrupt
+	}
+	return err
+}
+
+// Size retorna el tamaño del contenido sin comprimir.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		i := off / FrameSize
+		frame, err := r.frameAt(i)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], frame[off-i*FrameSize:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// frameAt retorna el contenido de un frame. El resultado es válido hasta la
+// siguiente llamada.
+func (r *Reader) frameAt(i int64) ([]byte, error) {
+	if i == r.cached {
+		return r.frame, nil
+	}
+	length := r.offsets[i+1] - r.offsets[i]
+	if int64(cap(r.scratch)) < length {
+		r.scratch = make([]byte, length)
+	}
+	compressed := r.scratch[:length]
+	if err := readFull(r.r, compressed, r.offsets[i]); err != nil {
+		return nil, err
+	}
+	r.cached = -1
+	frame, err := r.codec.decompress(r.frame[:0], compressed)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	// Todos los frames salvo el último están llenos
+	want := min(FrameSize, r.size-i*FrameSize)
+	if int64(len(frame)) != want {
+		return nil, ErrCorrupt
+	}
+	r.frame, r.cached = frame, i
+	return frame, nil
+}
+
+var _ io.ReaderAt = (*Reader)(nil)
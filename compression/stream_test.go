@@ -0,0 +1,263 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var codecs = []string{Zstd, Gzip}
+
+// content retorna size bytes comprimibles en los que cada posición es
+// distinguible, para notar un frame leído en el lugar equivocado.
+func content(size int) []byte {
+	var buf bytes.Buffer
+	for i := 0; buf.Len() < size; i++ {
+		fmt.Fprintf(&buf, "line %d\n", i)
+	}
+	return buf.Bytes()[:size]
+}
+
+func compress(t *testing.T, name string, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Trozos que no coinciden con los frames
+	for p := plain; len(p) > 0; {
+		n := min(100_000, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decompress lee todo el contenido a través de la tabla.
+func decompress(data []byte, name string) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), int64(len(data)), name)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+}
+
+// standardDecompress lee el stream con un descompresor estándar, que
+// ignora la tabla.
+func standardDecompress(data []byte, name string) ([]byte, error) {
+	switch name {
+	case Zstd:
+		dec, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer dec.Close()
+		return io.ReadAll(dec)
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	return nil, fmt.Errorf("unknown compression %q", name)
+}
+
+// build arma un stream a mano: comprime cada frame y escribe la tabla en
+// bloques de las cantidades de frames dadas, con size como tamaño sin
+// comprimir y sumando extra al tamaño comprimido de cada frame.
+func build(t *testing.T, name string, frames [][]byte, blocks []int, size int64, extra uint32) []byte {
+	t.Helper()
+	c, err := codecFor(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []byte
+	var sizes []uint32
+	for _, frame := range frames {
+		start := len(out)
+		if out, err = c.compress(out, frame); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, uint32(len(out)-start)+extra)
+	}
+	for _, n := range blocks {
+		var block []byte
+		for _, s := range sizes[:n] {
+			block = binary.LittleEndian.AppendUint32(block, s)
+		}
+		block = binary.LittleEndian.AppendUint32(block, uint32(n))
+		block = append(block, footerMagic...)
+		block = binary.LittleEndian.AppendUint64(block, uint64(size))
+		out = c.wrapTable(out, block)
+		sizes = sizes[n:]
+	}
+	return out
+}
+
+func TestRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, FrameSize - 1, FrameSize, FrameSize + 1, 2*FrameSize + 123}
+	for _, name := range codecs {
+		for _, size := range sizes {
+			t.Run(fmt.Sprint(name, "/", size), func(t *testing.T) {
+				plain := content(size)
+				data := compress(t, name, plain)
+				r, err := NewReader(bytes.NewReader(data), int64(len(data)), name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.Size() != int64(size) {
+					t.Errorf("Size = %d, want %d", r.Size(), size)
+				}
+				if got := int64(len(r.offsets) - 1); got != frames(int64(size)) {
+					t.Errorf("%d frames, want %d", got, frames(int64(size)))
+				}
+				got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, plain) {
+					t.Error("content differs")
+				}
+
+				got, err = standardDecompress(data, name)
+				if err != nil {
+					t.Fatalf("standard decompressor: %v", err)
+				}
+				if !bytes.Equal(got, plain) {
+					t.Error("standard decompressor returned different content")
+				}
+			})
+		}
+	}
+}
+
+func TestReadAtRanges(t *testing.T) {
+	plain := content(3*FrameSize + 100)
+	tests := []struct {
+		name     string
+		off, len int
+	}{
+		{"inside first frame", 10, 100},
+		{"crossing one boundary", FrameSize - 10, 20},
+		{"crossing two boundaries", FrameSize - 1, FrameSize + 2},
+		{"whole frame unaligned", 2*FrameSize - 7, FrameSize},
+		{"last partial frame", 3 * FrameSize, 100},
+	}
+	for _, name := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data := compress(t, name, plain)
+			r, err := NewReader(bytes.NewReader(data), int64(len(data)), name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, tt := range tests {
+				p := make([]byte, tt.len)
+				n, err := r.ReadAt(p, int64(tt.off))
+				if err != nil && !(err == io.EOF && tt.off+tt.len == len(plain)) {
+					t.Fatalf("%s: ReadAt: %v", tt.name, err)
+				}
+				if n != tt.len || !bytes.Equal(p, plain[tt.off:tt.off+tt.len]) {
+					t.Errorf("%s: ReadAt(%d, %d) returned different content (n = %d)", tt.name, tt.off, tt.len, n)
+				}
+			}
+
+			p := make([]byte, 200)
+			n, err := r.ReadAt(p, int64(len(plain)-50))
+			if n != 50 || err != io.EOF || !bytes.Equal(p[:n], plain[len(plain)-50:]) {
+				t.Errorf("ReadAt past the end = %d, %v", n, err)
+			}
+		})
+	}
+}
+
+// Una tabla partida en varios bloques se lee igual que una de un bloque, y
+// los descompresores estándar saltan todos los bloques.
+func TestMultiBlockTable(t *testing.T) {
+	plain := content(3*FrameSize + 100)
+	frames := [][]byte{plain[:FrameSize], plain[FrameSize : 2*FrameSize], plain[2*FrameSize : 3*FrameSize], plain[3*FrameSize:]}
+	for _, name := range codecs {
+		t.Run(name, func(t *testing.T) {
+			data := build(t, name, frames, []int{1, 2, 1}, int64(len(plain)), 0)
+			got, err := decompress(data, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Error("content differs")
+			}
+			if got, err := standardDecompress(data, name); err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("standard decompressor: %v", err)
+			}
+		})
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	plain := content(2*FrameSize + 100)
+	frames := [][]byte{plain[:FrameSize], plain[FrameSize : 2*FrameSize], plain[2*FrameSize:]}
+	size := int64(len(plain))
+
+	for _, name := range codecs {
+		t.Run(name, func(t *testing.T) {
+			c, _ := codecFor(name)
+			data := compress(t, name, plain)
+			// Inicio de la tabla (un solo bloque) y de su pie
+			table := len(data) - c.trailerSize() - footerSize - 4*len(frames) - c.headerSize()
+			footer := len(data) - c.trailerSize() - footerSize
+			modify := func(i int, f func(b []byte)) []byte {
+				b := bytes.Clone(data)
+				f(b[i:])
+				return b
+			}
+			flip := func(i int) []byte { return modify(i, func(b []byte) { b[0] ^= 1 }) }
+			// Dos bloques en los que el último indica otro tamaño
+			disagree := build(t, name, frames, []int{2, 1}, size, 0)
+			binary.LittleEndian.PutUint64(disagree[len(disagree)-c.trailerSize()-8:], uint64(size+1))
+
+			tests := []struct {
+				name string
+				data []byte
+			}{
+				{"empty", nil},
+				{"frames without table", data[:table]},
+				{"truncated", data[:len(data)-1]},
+				{"frame data flipped", flip(table / 2)},
+				{"wrapper flipped", flip(table)},
+				{"footer magic flipped", flip(footer + 4)},
+				{"no frames", modify(footer, func(b []byte) { binary.LittleEndian.PutUint32(b, 0) })},
+				{"too many frames in block", modify(footer, func(b []byte) { binary.LittleEndian.PutUint32(b, maxBlockFrames+1) })},
+				{"frame size changed", modify(table+c.headerSize(), func(b []byte) { binary.LittleEndian.PutUint32(b, binary.LittleEndian.Uint32(b)+1) })},
+				{"size of fewer frames", build(t, name, frames, []int{3}, FrameSize, 0)},
+				{"size of more frames", build(t, name, frames, []int{3}, 4*FrameSize, 0)},
+				{"blocks disagree on size", disagree},
+				{"frame sizes past the table", build(t, name, frames, []int{3}, size, 1)},
+				{"short frame", build(t, name, [][]byte{plain[:100], plain[100:200]}, []int{2}, FrameSize+100, 0)},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					got, err := decompress(tt.data, name)
+					if !errors.Is(err, ErrCorrupt) {
+						t.Errorf("err = %v, want ErrCorrupt (read %d bytes)", err, len(got))
+					}
+				})
+			}
+		})
+	}
+
+	if _, err := NewReader(bytes.NewReader(nil), 0, "lz4"); err == nil || errors.Is(err, ErrCorrupt) {
+		t.Errorf("NewReader with unknown compression = %v", err)
+	}
+}
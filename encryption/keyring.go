@@ -0,0 +1,188 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Keyring es un KMS local con las claves maestras en un archivo JSON:
+//
+//	{
+//	  "active": "20240501-3f2a9c1e",
+//	  "keys": [{"id": "20240501-3f2a9c1e", "key": "<base64>", "created_at": "..."}]
+//	}
+//
+// Rotate agrega una clave y la activa; las anteriores se conservan para
+// desenvolver las claves de datos que todavía no se volvieron a envolver.
+// Una clave se puede quitar del archivo cuando ya no quedan claves de datos
+// envueltas con ella.
+type Keyring struct {
+	path string
+
+	mu   sync.RWMutex
+	file keyringFile
+	keys map[string][]byte
+}
+
+type keyringFile struct {
+	Active string       `json:"active"`
+	Keys   []keyringKey `json:"keys"`
+}
+
+type keyringKey struct {
+	ID        string    `json:"id"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpenKeyring carga el archivo de claves. Si no existe, lo crea con una
+// clave nueva: sin ese archivo los archivos cifrados no se pueden recuperar.
+func OpenKeyring(path string) (*Keyring, error) {
+	k := &Keyring{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := k.Rotate(context.Background()); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	if err := json.Unmarshal(data, &k.file); err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: %w", path, err)
+	}
+	k.keys = make(map[string][]byte, len(k.file.Keys))
+	for _, key := range k.file.Keys {
+		if len(key.Key) != KeySize {
+			return nil, fmt.Errorf("invalid keyring %s: key %q is not %d bytes", path, key.ID, KeySize)
+		}
+		k.keys[key.ID] = key.Key
+	}
+	if _, ok := k.keys[k.file.Active]; !ok {
+		return nil, fmt.Errorf("invalid keyring %s: active key %q not found", path, k.file.Active)
+	}
+	return k, nil
+}
+
+func (k *Keyring) KeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.file.Active
+}
+
+// WrapKey cifra la clave de datos con AES-256-GCM y la clave maestra activa.
+// El resultado es nonce | texto cifrado, con el id de la clave como dato
+// adicional autenticado.
+func (k *Keyring) WrapKey(ctx context.Context, key []byte) (*WrappedKey, error) {
+	k.mu.RLock()
+	id := k.file.Active
+	master := k.keys[id]
+	k.mu.RUnlock()
+
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return &WrappedKey{KeyID: id, Ciphertext: aead.Seal(nonce, nonce, key, []byte(id))}, nil
+}
+
+func (k *Keyring) UnwrapKey(ctx context.Context, wrapped *WrappedKey) ([]byte, error) {
+	k.mu.RLock()
+	master, ok := k.keys[wrapped.KeyID]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, wrapped.KeyID)
+	}
+
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped.Ciphertext) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	nonce, ct := wrapped.Ciphertext[:aead.NonceSize()], wrapped.Ciphertext[aead.NonceSize():]
+	key, err := aead.Open(nil, nonce, ct, []byte(wrapped.KeyID))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return key, nil
+}
+
+// Rotate genera una clave maestra, la activa y guarda el archivo.
+func (k *Keyring) Rotate(ctx context.Context) (string, error) {
+	master, err := NewKey()
+	if err != nil {
+		return "", err
+	}
+	var suffix [4]byte
+	rand.Read(suffix[:])
+	now := time.Now().UTC()
+	id := now.Format("20060102") + "-" + hex.EncodeToString(suffix[:])
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	file := keyringFile{
+		Active: id,
+		Keys:   append(append([]keyringKey(nil), k.file.Keys...), keyringKey{ID: id, Key: master, CreatedAt: now}),
+	}
+	if err := writeKeyring(k.path, file); err != nil {
+		return "", err
+	}
+	k.file = file
+	if k.keys == nil {
+		k.keys = make(map[string][]byte)
+	}
+	k.keys[id] = master
+	return id, nil
+}
+
+// writeKeyring reemplaza el archivo de forma atómica, legible solo por el
+// usuario del servidor.
+func writeKeyring(path string, file keyringFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create keyring directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+var (
+	_ KMS     = (*Keyring)(nil)
+	_ Rotator = (*Keyring)(nil)
+)
@@ -0,0 +1,95 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyringRotate(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys", "keyring.json")
+	k, err := OpenKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("keyring file not created private: %v", err)
+	}
+
+	key := testKey(t)
+	old, err := k.WrapKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old.KeyID != k.KeyID() {
+		t.Errorf("wrapped with %q, active key is %q", old.KeyID, k.KeyID())
+	}
+
+	active, err := k.Rotate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active == old.KeyID || k.KeyID() != active {
+		t.Fatalf("Rotate activated %q, KeyID = %q, previous %q", active, k.KeyID(), old.KeyID)
+	}
+	rewrapped, err := k.WrapKey(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrapped.KeyID != active {
+		t.Errorf("wrapped after rotating with %q, want %q", rewrapped.KeyID, active)
+	}
+
+	// Las claves anteriores se conservan, también al volver a abrir el
+	// archivo
+	reopened, err := OpenKeyring(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.KeyID() != active {
+		t.Errorf("reopened KeyID = %q, want %q", reopened.KeyID(), active)
+	}
+	for _, kms := range []*Keyring{k, reopened} {
+		for _, wrapped := range []*WrappedKey{old, rewrapped} {
+			got, err := kms.UnwrapKey(ctx, wrapped)
+			if err != nil || !bytes.Equal(got, key) {
+				t.Errorf("UnwrapKey(%q) = %v", wrapped.KeyID, err)
+			}
+		}
+	}
+}
+
+func TestKeyringUnwrapErrors(t *testing.T) {
+	ctx := context.Background()
+	k, err := OpenKeyring(filepath.Join(t.TempDir(), "keyring.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := k.WrapKey(ctx, testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	flipped := bytes.Clone(wrapped.Ciphertext)
+	flipped[len(flipped)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		wrapped *WrappedKey
+		want    error
+	}{
+		{"unknown key", &WrappedKey{KeyID: "missing", Ciphertext: wrapped.Ciphertext}, ErrUnknownKey},
+		{"tampered", &WrappedKey{KeyID: wrapped.KeyID, Ciphertext: flipped}, ErrCorrupt},
+		{"too short", &WrappedKey{KeyID: wrapped.KeyID, Ciphertext: wrapped.Ciphertext[:4]}, ErrCorrupt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := k.UnwrapKey(ctx, tt.wrapped); !errors.Is(err, tt.want) {
+				t.Errorf("UnwrapKey err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnknownKey indica que el KMS no tiene la clave maestra con la que se
+// envolvió una clave de datos.
+var ErrUnknownKey = errors.New("unknown master key")
+
+// WrappedKey es una clave de datos envuelta, con el id de la clave maestra
+// que la envolvió.
+type WrappedKey struct {
+	KeyID      string `json:"key_id"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KMS envuelve claves de datos con claves maestras que nunca salen de él.
+// Keyring guarda las claves maestras en un archivo local; un KMS externo se
+// integra implementando esta interfaz.
+type KMS interface {
+	// KeyID retorna el id de la clave maestra activa, con la que WrapKey
+	// envuelve las claves nuevas.
+	KeyID() string
+	WrapKey(ctx context.Context, key []byte) (*WrappedKey, error)
+	// UnwrapKey debe aceptar claves envueltas con claves maestras
+	// anteriores mientras no se retiren.
+	UnwrapKey(ctx context.Context, wrapped *WrappedKey) ([]byte, error)
+}
+
+// Rotator es un KMS que puede crear una clave maestra nueva y activarla. Los
+// KMS externos suelen rotar por su cuenta y no lo implementan.
+type Rotator interface {
+	Rotate(ctx context.Context) (keyID string, err error)
+}
@@ -0,0 +1,267 @@
+// Package encryption cifra el contenido guardado con envoltura de claves
+// (envelope encryption): cada archivo tiene una clave de datos aleatoria con
+// la que se cifra su contenido, y esa clave se guarda envuelta con una clave
+// maestra de un KMS. Rotar la clave maestra solo requiere volver a envolver
+// las claves de datos, sin reescribir el contenido.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Formato del contenido cifrado:
+//
+//	encabezado: "FSE1" | tamaño de segmento (uint32) | prefijo del nonce (7 bytes) | 0
+//	segmentos:  AES-256-GCM de cada segmento de texto plano, más su tag
+//
+// Todos los segmentos salvo el último tienen el tamaño indicado en el
+// encabezado. El nonce de cada segmento es el prefijo, su número (uint32) y
+// un byte que vale 1 solo en el último, así que los segmentos no se pueden
+// reordenar ni quitar del final sin que falle la autenticación. El
+// encabezado es el dato adicional autenticado de cada segmento.
+//
+// Como cada segmento se descifra por separado, se puede leer cualquier rango
+// del archivo sin descifrar lo anterior.
+
+const (
+	// KeySize es el tamaño de las claves de datos y maestras (AES-256)
+	KeySize = 32
+	// DefaultSegmentSize es el texto plano de cada segmento
+	DefaultSegmentSize = 64 * 1024
+
+	headerSize = 16
+	prefixSize = 7
+	tagSize    = 16
+	// Límite del tamaño de segmento al leer un encabezado
+	maxSegmentSize = 16 << 20
+)
+
+var magic = []byte("FSE1")
+
+// ErrCorrupt indica que el contenido no se pudo autenticar: está dañado,
+// fue modificado o la clave no corresponde.
+var ErrCorrupt = errors.New("encrypted content is corrupt or the key is wrong")
+
+// NewKey genera una clave aleatoria.
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(prefix []byte, segment int64, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], uint32(segment))
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// Writer cifra lo que se le escribe. Close escribe el último segmento y es
+// obligatorio; no cierra el destino.
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	out     []byte
+	segment int64
+	closed  bool
+}
+
+// NewWriter cifra hacia w con la clave de datos key.
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	binary.BigEndian.PutUint32(header[4:], DefaultSegmentSize)
+	if _, err := rand.Read(header[8 : 8+prefixSize]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce prefix: %w", err)
+	}
+	return &Writer{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, DefaultSegmentSize),
+		out:    make([]byte, 0, DefaultSegmentSize+tagSize),
+	}, nil
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write on closed encryption writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		// Un segmento lleno solo se cifra cuando llegan más datos: hasta
+		// entonces podría ser el último
+		if len(w.buf) == cap(w.buf) {
+			if err := w.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close cifra el último segmento, aunque esté vacío.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.seal(true)
+}
+
+func (w *Writer) seal(last bool) error {
+	if w.segment == 0 {
+		if _, err := w.w.Write(w.header); err != nil {
+			return err
+		}
+	}
+	if w.segment > 1<<32-1 {
+		return errors.New("encrypted content is too large")
+	}
+	w.out = w.aead.Seal(w.out[:0], segmentNonce(w.header[8:8+prefixSize], w.segment, last), w.buf, w.header)
+	w.segment++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(w.out)
+	return err
+}
+
+// Reader descifra contenido con lecturas aleatorias. Es seguro para
+// lecturas concurrentes.
+type Reader struct {
+	r        io.ReaderAt
+	aead     cipher.AEAD
+	header   []byte
+	segSize  int64
+	segments int64
+	// Tamaño del contenido cifrado y del texto plano
+	cipherSize int64
+	size       int64
+
+	// Último segmento descifrado, para lecturas secuenciales pequeñas
+	mu      sync.Mutex
+	cached  int64
+	plain   []byte
+	scratch []byte
+}
+
+// NewReader descifra el contenido de r, de size bytes, con la clave de
+// datos key.
+func NewReader(r io.ReaderAt, size int64, key []byte) (*Reader, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, headerSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		if err == io.EOF {
+			return nil, ErrCorrupt
+		}
+		return nil, err
+	}
+	segSize := int64(binary.BigEndian.Uint32(header[4:]))
+	if string(header[:4]) != string(magic) || segSize == 0 || segSize > maxSegmentSize {
+		return nil, ErrCorrupt
+	}
+	// Siempre hay al menos un segmento, aunque el texto plano esté vacío
+	body := size - headerSize
+	segments := (body + segSize + tagSize - 1) / (segSize + tagSize)
+	if body < tagSize || body-(segments-1)*(segSize+tagSize) < tagSize {
+		return nil, ErrCorrupt
+	}
+	return &Reader{
+		r:          r,
+		aead:       aead,
+		header:     header,
+		segSize:    segSize,
+		segments:   segments,
+		cipherSize: size,
+		size:       body - segments*tagSize,
+		cached:     -1,
+	}, nil
+}
+
+// Size retorna el tamaño del texto plano.
+func (r *Reader) Size() int64 {
+	return r.size
+}
+
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+		segment := off / r.segSize
+		plain, err := r.segment(segment)
+		if err != nil {
+			return n, err
+		}
+		c := copy(p[n:], plain[off-segment*r.segSize:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// segment retorna el texto plano de un segmento. El resultado es válido
+// hasta la siguiente llamada.
+func (r *Reader) segment(i int64) ([]byte, error) {
+	if i == r.cached {
+		return r.plain, nil
+	}
+	start := headerSize + i*(r.segSize+tagSize)
+	length := min(r.segSize+tagSize, r.cipherSize-start)
+	if cap(r.scratch) < int(length) {
+		r.scratch = make([]byte, r.segSize+tagSize)
+	}
+	ct := r.scratch[:length]
+	if _, err := r.r.ReadAt(ct, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	last := i == r.segments-1
+	plain, err := r.aead.Open(r.plain[:0], segmentNonce(r.header[8:8+prefixSize], i, last), ct, r.header)
+	if err != nil {
+		r.cached = -1
+		return nil, ErrCorrupt
+	}
+	r.plain, r.cached = plain, i
+	return plain, nil
+}
+
+var _ io.ReaderAt = (*Reader)(nil)
@@ -0,0 +1,191 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+const seg = DefaultSegmentSize
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	t.Helper()
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// seal cifra plain escribiéndolo en trozos de chunk bytes.
+func seal(t *testing.T, key, plain []byte, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := plain; len(p) > 0; {
+		n := min(chunk, len(p))
+		if _, err := w.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// open descifra todo el contenido de sealed.
+func open(sealed, key []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(sealed), int64(len(sealed)), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+	sizes := []int{0, 1, seg - 1, seg, seg + 1, 2 * seg, 3*seg + 17}
+	for _, size := range sizes {
+		plain := randomBytes(t, size)
+		// Trozos que no coinciden con los segmentos y uno solo con todo
+		for _, chunk := range []int{1000, max(size, 1)} {
+			sealed := seal(t, key, plain, chunk)
+			segments := max((size+seg-1)/seg, 1)
+			if want := headerSize + size + segments*tagSize; len(sealed) != want {
+				t.Errorf("size %d: sealed %d bytes, want %d", size, len(sealed), want)
+			}
+			r, err := NewReader(bytes.NewReader(sealed), int64(len(sealed)), key)
+			if err != nil {
+				t.Fatalf("size %d: NewReader: %v", size, err)
+			}
+			if r.Size() != int64(size) {
+				t.Errorf("size %d: Size = %d", size, r.Size())
+			}
+			got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+			if err != nil {
+				t.Fatalf("size %d: read: %v", size, err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Errorf("size %d, chunk %d: content differs", size, chunk)
+			}
+		}
+	}
+}
+
+func TestReadAtRanges(t *testing.T) {
+	key := testKey(t)
+	plain := randomBytes(t, 3*seg+100)
+	sealed := seal(t, key, plain, len(plain))
+	r, err := NewReader(bytes.NewReader(sealed), int64(len(sealed)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		off, len int
+	}{
+		{"inside first segment", 10, 100},
+		{"crossing one boundary", seg - 10, 20},
+		{"crossing two boundaries", seg - 1, seg + 2},
+		{"whole segment unaligned", seg + 1, seg},
+		{"last partial segment", 3 * seg, 100},
+		{"everything", 0, len(plain)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := make([]byte, tt.len)
+			n, err := r.ReadAt(p, int64(tt.off))
+			if err != nil && !(err == io.EOF && tt.off+tt.len == len(plain)) {
+				t.Fatalf("ReadAt: %v", err)
+			}
+			if n != tt.len || !bytes.Equal(p, plain[tt.off:tt.off+tt.len]) {
+				t.Errorf("ReadAt(%d, %d) returned different content (n = %d)", tt.off, tt.len, n)
+			}
+		})
+	}
+
+	// Una lectura que pasa del final retorna lo que hay y io.EOF
+	p := make([]byte, 200)
+	n, err := r.ReadAt(p, int64(len(plain)-50))
+	if n != 50 || err != io.EOF || !bytes.Equal(p[:n], plain[len(plain)-50:]) {
+		t.Errorf("ReadAt past the end = %d, %v", n, err)
+	}
+	if n, err := r.ReadAt(p, int64(len(plain))); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt at the end = %d, %v, want 0, EOF", n, err)
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	key := testKey(t)
+	plain := randomBytes(t, 3*seg+100)
+	sealed := seal(t, key, plain, len(plain))
+	segEnd := func(i int) int { return headerSize + i*(seg+tagSize) }
+
+	flip := func(i int) []byte {
+		b := bytes.Clone(sealed)
+		b[i] ^= 1
+		return b
+	}
+	// Intercambia los segmentos 0 y 1, del mismo tamaño
+	swapped := bytes.Clone(sealed)
+	copy(swapped[segEnd(0):], sealed[segEnd(1):segEnd(2)])
+	copy(swapped[segEnd(1):], sealed[segEnd(0):segEnd(1)])
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		key    []byte
+	}{
+		{"wrong key", sealed, testKey(t)},
+		{"bad magic", flip(0), key},
+		{"segment size changed", flip(7), key},
+		{"nonce prefix changed", flip(9), key},
+		{"ciphertext flipped", flip(segEnd(1) + 5), key},
+		{"tag flipped", flip(len(sealed) - 1), key},
+		{"segments swapped", swapped, key},
+		{"last segment dropped", sealed[:segEnd(3)], key},
+		{"truncated inside a segment", sealed[:segEnd(2)+seg/2], key},
+		{"truncated tag", sealed[:len(sealed)-tagSize/2], key},
+		{"header only", sealed[:headerSize], key},
+		{"truncated header", sealed[:headerSize-1], key},
+		{"empty", nil, key},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := open(tt.sealed, tt.key)
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("err = %v, want ErrCorrupt (read %d bytes)", err, len(got))
+			}
+		})
+	}
+
+	// Un segmento dañado no impide leer los demás
+	r, err := NewReader(bytes.NewReader(flip(segEnd(1)+5)), int64(len(sealed)), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 100)
+	if _, err := r.ReadAt(p, 2*seg); err != nil || !bytes.Equal(p, plain[2*seg:2*seg+100]) {
+		t.Errorf("ReadAt of an intact segment = %v", err)
+	}
+	if _, err := r.ReadAt(p, seg); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadAt of the damaged segment = %v, want ErrCorrupt", err)
+	}
+}
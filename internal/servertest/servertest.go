@@ -0,0 +1,107 @@
+// Package servertest levanta los servicios gRPC del servidor en memoria para
+// las pruebas.
+package servertest
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// Main ejecuta las pruebas del paquete en un directorio temporal, porque el
+// servidor guarda los archivos en ./nfs/files. Se usa desde TestMain:
+//
+//	func TestMain(m *testing.M) { os.Exit(servertest.Main(m)) }
+func Main(m *testing.M) int {
+	dir, err := os.MkdirTemp("", "fileserver-test-")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	return m.Run()
+}
+
+// Dial levanta un servidor gRPC con los servicios que registra register,
+// sobre una conexión en memoria, y retorna un cliente conectado. Los dos se
+// cierran al terminar la prueba.
+func Dial(t testing.TB, register func(*grpc.Server), opts ...grpc.ServerOption) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(opts...)
+	register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Upload sube un archivo. El primer mensaje lleva los campos de first y el
+// primer bloque; cada bloque siguiente va en su propio mensaje.
+func Upload(ctx context.Context, c pb.FileServiceClient, first *pb.FileUploadRequest, chunks ...[]byte) (*pb.FileUploadResponse, error) {
+	stream, err := c.Upload(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := proto.Clone(first).(*pb.FileUploadRequest)
+	for i := 0; i == 0 || i < len(chunks); i++ {
+		if i < len(chunks) {
+			req.BinaryFile = chunks[i]
+		}
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		req = &pb.FileUploadRequest{}
+	}
+	return stream.CloseAndRecv()
+}
+
+// Download retorna el contenido completo de un archivo.
+func Download(ctx context.Context, c pb.FileServiceClient, req *pb.FileDownloadRequest) ([]byte, error) {
+	stream, err := c.Download(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var content []byte
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return content, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, resp.BinaryFileResponse...)
+	}
+}
+
+// OpenStore abre una base de metadatos vacía que se cierra al terminar t.
+func OpenStore(t testing.TB) *metadata.Store {
+	t.Helper()
+	store, err := metadata.Open(filepath.Join(t.TempDir(), "metadata.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
@@ -0,0 +1,158 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"path"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader es la clave de metadata de la que se toma el identificador
+// de petición y en la que se retorna al cliente.
+const RequestIDHeader = "x-request-id"
+
+// Campos que se extraen de los mensajes para el log de acceso
+type (
+	ownedMessage  interface{ GetOwnerId() string }
+	fileMessage   interface{ GetFileId() string }
+	uploadChunk   interface{ GetBinaryFile() []byte }
+	downloadChunk interface{ GetBinaryFileResponse() []byte }
+)
+
+// UnaryServerInterceptor asigna el identificador de petición y escribe una
+// línea de log de acceso por RPC.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, id := requestContext(ctx)
+		grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+
+		entry := accessEntry{method: path.Base(info.FullMethod), start: time.Now()}
+		entry.observe(req)
+		resp, err := handler(ctx, req)
+		entry.observe(resp)
+		entry.log(ctx, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor hace lo mismo para los RPC con streams, contando los
+// bytes de archivo transferidos.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, id := requestContext(ss.Context())
+		ss.SetHeader(metadata.Pairs(RequestIDHeader, id))
+
+		ls := &loggedStream{
+			ServerStream: ss,
+			ctx:          ctx,
+			entry:        accessEntry{method: path.Base(info.FullMethod), start: time.Now()},
+		}
+		err := handler(srv, ls)
+		ls.entry.log(ctx, err)
+		return err
+	}
+}
+
+// requestContext toma el identificador de la metadata entrante o genera uno.
+func requestContext(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDHeader); len(values) > 0 && values[0] != "" {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = newRequestID()
+	}
+	return WithRequestID(ctx, id), id
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+type accessEntry struct {
+	method string
+	start  time.Time
+	owner  string
+	fileID string
+	bytes  int64
+}
+
+func (e *accessEntry) observe(m any) {
+	if o, ok := m.(ownedMessage); ok && e.owner == "" {
+		e.owner = o.GetOwnerId()
+	}
+	if f, ok := m.(fileMessage); ok && e.fileID == "" {
+		e.fileID = f.GetFileId()
+	}
+	if c, ok := m.(uploadChunk); ok {
+		e.bytes += int64(len(c.GetBinaryFile()))
+	}
+	if c, ok := m.(downloadChunk); ok {
+		e.bytes += int64(len(c.GetBinaryFileResponse()))
+	}
+}
+
+func (e *accessEntry) log(ctx context.Context, err error) {
+	code := status.Code(err)
+	attrs := []slog.Attr{
+		slog.String("method", e.method),
+		slog.String("owner_id", e.owner),
+		slog.String("file_id", e.fileID),
+		slog.Int64("bytes", e.bytes),
+		slog.Float64("duration_ms", float64(time.Since(e.start).Microseconds())/1000),
+		slog.String("code", code.String()),
+	}
+	level := slog.LevelInfo
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		level = serverErrorLevel(code)
+	}
+	slog.LogAttrs(ctx, level, "rpc completed", attrs...)
+}
+
+// Los errores causados por el cliente se registran como advertencias.
+func serverErrorLevel(code codes.Code) slog.Level {
+	switch code {
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists,
+		codes.PermissionDenied, codes.Unauthenticated, codes.FailedPrecondition, codes.OutOfRange:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+type loggedStream struct {
+	grpc.ServerStream
+	ctx   context.Context
+	entry accessEntry
+}
+
+func (s *loggedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *loggedStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.entry.observe(m)
+	return nil
+}
+
+func (s *loggedStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	s.entry.observe(m)
+	return nil
+}
@@ -1,20 +1,287 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/Districorp-UPB/FileServer/audit"
+	"github.com/Districorp-UPB/FileServer/compression"
+	// Compresores gRPC: el cliente puede comprimir sus mensajes y las
+	// descargas se comprimen con el que anuncie
+	_ "github.com/Districorp-UPB/FileServer/compression/grpczstd"
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/logging"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
 	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"github.com/Districorp-UPB/FileServer/scan"
+	"github.com/Districorp-UPB/FileServer/search"
 	"github.com/Districorp-UPB/FileServer/server"
+	"github.com/Districorp-UPB/FileServer/thumbnail"
+	"github.com/Districorp-UPB/FileServer/tracing"
+	"github.com/Districorp-UPB/FileServer/webhook"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
 	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
+	// Tiempo máximo para esperar a que terminen las transferencias en curso
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "maximum time to wait for in-flight transfers before forcing shutdown")
+	partialGrace := flag.Duration("partial-upload-grace", time.Hour, "age after which temporary upload files left by a crash are removed at startup")
+	healthInterval := flag.Duration("health-interval", 10*time.Second, "interval between health checks")
+	minFreeBytes := flag.Uint64("min-free-bytes", 1<<30, "minimum free disk space on the storage root to report SERVING")
+	requireMount := flag.Bool("require-mount", false, "report NOT_SERVING unless the storage root is a mount point")
+	httpAddr := flag.String("http-addr", ":8080", "address for HTTP archive downloads at /archive (empty to disable)")
+	metricsAddr := flag.String("metrics-addr", ":9090", "address for the Prometheus /metrics endpoint (empty to disable)")
+	storageSampleInterval := flag.Duration("storage-sample-interval", 30*time.Second, "interval between storage usage samples")
+	ownerMetrics := flag.Bool("metrics-owner-labels", false, "export per-owner transfer counters")
+	maxOwnerLabels := flag.Int("metrics-max-owners", 100, "maximum distinct owner labels before grouping the rest as __other__")
+	traceExporter := flag.String("trace-exporter", tracing.ExporterNone, "trace exporter: none, stdout or otlp")
+	traceEndpoint := flag.String("trace-endpoint", "", "OTLP gRPC collector endpoint (host:port); defaults to OTEL_EXPORTER_OTLP_ENDPOINT")
+	traceInsecure := flag.Bool("trace-insecure", false, "disable TLS to the OTLP collector")
+	traceSampleRatio := flag.Float64("trace-sample-ratio", 1, "fraction of root traces to sample")
+	metadataPath := flag.String("metadata-db", "./data/metadata.db", "path to the metadata database")
+	searchPath := flag.String("search-db", "./data/search.db", "path to the full-text search index (empty to disable)")
+	thumbnailSizes := flag.String("thumbnail-sizes", "128,256,512", "comma-separated thumbnail sizes in pixels (empty to disable)")
+	thumbnailMaxPixels := flag.Int("thumbnail-max-pixels", thumbnail.DefaultLimits.MaxPixels, "largest image (width*height) that will be decoded for thumbnails")
+	stripImageMetadata := flag.Bool("strip-image-metadata", false, "remove EXIF, XMP and GPS data from JPEG and PNG uploads before storing them")
+	scanner := flag.String("scanner", "none", "malware scanner for uploads: none, clamd or eicar (test signature only)")
+	clamdAddr := flag.String("clamd-addr", "tcp://127.0.0.1:3310", "clamd address (tcp://host:port or unix:///path/to/clamd.sock)")
+	scanTimeout := flag.Duration("scan-timeout", 2*time.Minute, "maximum time to wait for a malware scan")
+	pipelineStages := flag.String("pipeline", server.DefaultPipeline, "comma-separated upload processing stages (validate, sniff, hash, scan, media, index, thumbnail); append :async to run a stage in the background")
+	pipelineWorkers := flag.Int("pipeline-workers", 2, "number of workers for asynchronous processing stages")
+	jobsPath := flag.String("jobs-db", "./data/jobs.db", "path to the durable job queue for asynchronous processing stages")
+	maxUploadSize := flag.Int64("max-upload-size", 0, "largest file accepted by the validate stage, in bytes (0 for no limit)")
+	blockedExtensions := flag.String("blocked-extensions", "", "comma-separated file extensions rejected by the validate stage (e.g. .exe,.bat)")
+	ownerQuota := flag.Int64("owner-quota", 0, "bytes each owner may store, including trashed files (0 for no limit)")
+	extractMaxEntries := flag.Int("extract-max-entries", server.DefaultExtractLimits.MaxEntries, "most entries ExtractArchive accepts in one archive (0 for no limit)")
+	extractMaxSize := flag.Int64("extract-max-size", server.DefaultExtractLimits.MaxTotalSize, "largest archive and total extracted size accepted by ExtractArchive, in bytes (0 for no limit)")
+	extractMaxRatio := flag.Int64("extract-max-ratio", server.DefaultExtractLimits.MaxRatio, "largest compression ratio accepted by ExtractArchive (0 for no limit)")
+	encryptionKeyfile := flag.String("encryption-keyfile", "", "JSON keyring with the master keys for encryption at rest (created if missing); empty stores new files in plaintext")
+	compressionCodec := flag.String("compression", "none", "compression at rest for uploads that benefit from it: none, zstd or gzip")
+	compressionMinRatio := flag.Float64("compression-min-ratio", server.DefaultCompressionPolicy.MinRatio, "smallest trial compression ratio for an upload to be stored compressed")
+	responseCompression := flag.Bool("response-compression", true, "compress download responses with zstd or gzip when the client supports it and the content is not already compressed")
+	webhooksConfig := flag.String("webhooks-config", "", "JSON file with webhook endpoints ([{\"url\", \"secret\", \"events\"}]); empty disables webhooks")
+	webhooksPath := flag.String("webhooks-db", "./data/webhooks.db", "path to the durable webhook outbox")
+	webhookWorkers := flag.Int("webhook-workers", 4, "number of concurrent webhook deliveries")
+	webhookAttempts := flag.Int("webhook-max-attempts", webhook.RetryOptions.MaxAttempts, "delivery attempts before a webhook event is moved to the failed list")
+	watchHeartbeat := flag.Duration("watch-heartbeat", server.DefaultWatchHeartbeat, "interval between WatchFiles heartbeats when there are no changes")
+	changeRetention := flag.Duration("change-retention", 30*24*time.Hour, "how long the change log behind WatchFiles cursors is kept")
+	auditPath := flag.String("audit-log", "./data/audit.log", "path to the append-only audit log")
+	auditCheckpoints := flag.Int("audit-checkpoint-every", 100, "entries between signed audit log checkpoints (0 to disable)")
+	erasuresPath := flag.String("erasures-db", "./data/erasures.db", "path to the durable queue that deletes the data of erased owners")
+	erasureKey := flag.String("erasure-signing-key", "./data/erasure-signing.pem", "Ed25519 private key (PEM, created if missing) that signs owner erasure receipts and audit log checkpoints")
+	adminToken := flag.String("admin-token", os.Getenv("FILESERVER_ADMIN_TOKEN"), "bearer token for AdminService RPCs (empty disables them)")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn or error")
+	flag.Parse()
+
+	// Logging estructurado en JSON
+	if _, err := logging.Setup(os.Stderr, *logLevel); err != nil {
+		fatal("Invalid log configuration", err)
+	}
+
+	// Configurar el exportador de trazas
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    *traceExporter,
+		Endpoint:    *traceEndpoint,
+		Insecure:    *traceInsecure,
+		SampleRatio: *traceSampleRatio,
+	})
+	if err != nil {
+		fatal("Failed to set up tracing", err)
+	}
+
+	if err := server.EnsureStorageRoot(); err != nil {
+		fatal("Failed to create storage root", err)
+	}
+	// Temporales de subidas que una caída dejó a medias
+	removed, err := server.RemoveStalePartialUploads(*partialGrace)
+	if err != nil {
+		slog.Warn("Failed to remove stale partial uploads", "error", err)
+	}
+	if removed > 0 {
+		slog.Info("Removed stale partial uploads", "count", removed)
+	}
+
+	// Almacén de metadatos (árbol de carpetas y registros de archivos)
+	store, err := metadata.Open(*metadataPath)
+	if err != nil {
+		fatal("Failed to open metadata store", err)
+	}
+	defer store.Close()
+
+	serviceOpts := []server.Option{server.WithWatchHeartbeat(*watchHeartbeat)}
+
+	// Índice de búsqueda de texto completo
+	if *searchPath != "" {
+		index, err := search.Open(*searchPath)
+		if err != nil {
+			fatal("Failed to open search index", err)
+		}
+		defer index.Close()
+		serviceOpts = append(serviceOpts, server.WithSearchIndex(index))
+	}
+
+	// Generación de miniaturas
+	sizes, err := parseSizes(*thumbnailSizes)
+	if err != nil {
+		fatal("Invalid thumbnail sizes", err)
+	}
+	if len(sizes) > 0 {
+		limits := thumbnail.DefaultLimits
+		limits.MaxPixels = *thumbnailMaxPixels
+		serviceOpts = append(serviceOpts, server.WithThumbnails(thumbnail.NewGenerator(sizes, limits)))
+	}
+	if *stripImageMetadata {
+		serviceOpts = append(serviceOpts, server.WithMetadataStripping())
+	}
+
+	// Análisis de malware de las subidas
+	var clamd *scan.Clamd
+	switch *scanner {
+	case "none":
+	case "eicar":
+		serviceOpts = append(serviceOpts, server.WithScanner(scan.EICAR{}))
+	case "clamd":
+		clamd, err = scan.NewClamd(*clamdAddr, *scanTimeout)
+		if err != nil {
+			fatal("Invalid clamd address", err)
+		}
+		serviceOpts = append(serviceOpts, server.WithScanner(clamd))
+	default:
+		fatal("Invalid malware scanner", fmt.Errorf("unknown scanner %q", *scanner))
+	}
+
+	// Pipeline de procesamiento de las subidas. Las etapas asíncronas se
+	// agendan en una cola durable que sobrevive a reinicios.
+	stages, err := server.ParsePipeline(*pipelineStages)
+	if err != nil {
+		fatal("Invalid processing pipeline", err)
+	}
+	var jobs *queue.Queue
+	if slices.ContainsFunc(stages, func(st server.StageConfig) bool { return st.Async }) {
+		jobs, err = queue.Open(*jobsPath, queue.DefaultOptions)
+		if err != nil {
+			fatal("Failed to open job queue", err)
+		}
+		defer jobs.Close()
+	}
+	serviceOpts = append(serviceOpts,
+		server.WithPipeline(stages, jobs),
+		server.WithValidation(server.ValidationRules{
+			MaxSize:           *maxUploadSize,
+			BlockedExtensions: parseExtensions(*blockedExtensions),
+		}),
+		server.WithQuota(*ownerQuota),
+		server.WithExtractLimits(server.ExtractLimits{
+			MaxEntries:   *extractMaxEntries,
+			MaxTotalSize: *extractMaxSize,
+			MaxRatio:     *extractMaxRatio,
+		}),
+	)
+
+	// Cifrado en reposo con las claves maestras en un archivo local
+	if *encryptionKeyfile != "" {
+		keyring, err := encryption.OpenKeyring(*encryptionKeyfile)
+		if err != nil {
+			fatal("Failed to open encryption keyring", err)
+		}
+		serviceOpts = append(serviceOpts, server.WithEncryption(keyring))
+	}
+
+	// Compresión en reposo de los archivos que lo valen
+	if *compressionCodec != "none" {
+		if !compression.Supported(*compressionCodec) {
+			fatal("Invalid compression", fmt.Errorf("unknown compression %q", *compressionCodec))
+		}
+		serviceOpts = append(serviceOpts, server.WithCompression(server.CompressionPolicy{
+			Codec:    *compressionCodec,
+			MinRatio: *compressionMinRatio,
+		}))
+	}
+
+	// Compresión gRPC de las descargas, según el contenido y el cliente
+	if *responseCompression {
+		serviceOpts = append(serviceOpts, server.WithResponseCompression())
+	}
+
+	// Borrado de propietarios: el contenido se elimina en segundo plano y
+	// los comprobantes se firman
+	erasures, err := queue.Open(*erasuresPath, server.ErasureRetryOptions)
+	if err != nil {
+		fatal("Failed to open erasure queue", err)
+	}
+	defer erasures.Close()
+	// Los borrados que se descartaron con un límite de intentos vuelven a la
+	// cola: su contenido sigue en el NFS
+	failedErasures, err := erasures.List(true, 0)
+	if err != nil {
+		fatal("Failed to list failed erasure jobs", err)
+	}
+	for _, job := range failedErasures {
+		if err := erasures.Retry(job.ID); err != nil {
+			fatal("Failed to reschedule erasure job", err)
+		}
+		slog.Warn("Rescheduled failed erasure job", "job_id", job.ID, "attempts", job.Attempts, "last_error", job.LastError)
+	}
+	signer, err := audit.LoadSigner(*erasureKey)
+	if err != nil {
+		fatal("Failed to load erasure signing key", err)
+	}
+	serviceOpts = append(serviceOpts, server.WithErasure(erasures, signer))
+
+	// Notificación de eventos a webhooks, con un outbox durable
+	var notifier *webhook.Notifier
+	if *webhooksConfig != "" {
+		endpoints, err := webhook.LoadEndpoints(*webhooksConfig)
+		if err != nil {
+			fatal("Failed to load webhook endpoints", err)
+		}
+		retry := webhook.RetryOptions
+		retry.MaxAttempts = *webhookAttempts
+		outbox, err := queue.Open(*webhooksPath, retry)
+		if err != nil {
+			fatal("Failed to open webhook outbox", err)
+		}
+		defer outbox.Close()
+		notifier = webhook.NewNotifier(endpoints, outbox)
+		serviceOpts = append(serviceOpts, server.WithWebhooks(notifier))
+	}
+
+	// Registro de auditoría encadenado, con puntos de control firmados
+	var auditOpts []audit.Option
+	if *auditCheckpoints > 0 {
+		auditOpts = append(auditOpts, audit.WithCheckpoints(signer, *auditCheckpoints))
+	}
+	auditLog, err := audit.Open(*auditPath, auditOpts...)
+	if err != nil {
+		fatal("Failed to open audit log", err)
+	}
+	defer auditLog.Close()
+
 	// Escuchar en el puerto 50051
 	grpcListener, err := net.Listen("tcp", ":50051")
 	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
+		fatal("Failed to listen", err)
 	}
 	defer grpcListener.Close()
 
@@ -22,14 +289,248 @@ func main() {
 	grpcServer := grpc.NewServer(
 		grpc.MaxRecvMsgSize(1024*1024*1024),
 		grpc.ConnectionTimeout(time.Minute*5),
+		// Spans por RPC, con el contexto de traza tomado de la metadata gRPC
+		grpc.StatsHandler(otelgrpc.NewServerHandler(
+			otelgrpc.WithFilter(filters.ServicePrefix("proto.")),
+		)),
+		// Bytes de los mensajes antes y después de comprimirlos
+		grpc.StatsHandler(metrics.StatsHandler()),
+		grpc.ChainUnaryInterceptor(
+			logging.UnaryServerInterceptor(),
+			metrics.UnaryServerInterceptor(),
+			audit.UnaryServerInterceptor(auditLog),
+		),
+		grpc.ChainStreamInterceptor(
+			logging.StreamServerInterceptor(),
+			metrics.StreamServerInterceptor(),
+			audit.StreamServerInterceptor(auditLog),
+		),
 	)
 
 	// Registrar el servicio de archivos
-	pb.RegisterFileServiceServer(grpcServer, &server.FileService{})
-	log.Println("gRPC server started, listening on port 50051")
+	fileService := server.NewFileService(store, serviceOpts...)
+	// Eventos de webhooks que una caída dejó sin pasar al outbox
+	fileService.RelayEvents(context.Background())
+	pb.RegisterFileServiceServer(grpcServer, fileService)
+	pb.RegisterAdminServiceServer(grpcServer, &server.AdminService{
+		Token:    *adminToken,
+		Audit:    auditLog,
+		Webhooks: notifier,
+		Files:    fileService,
+	})
+
+	// Registrar grpc.health.v1 y reflexión para balanceadores y grpcurl
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+
+	healthChecker := server.NewHealthChecker(healthServer, *healthInterval)
+	healthChecker.AddCheck("storage", server.StorageCheck(*requireMount))
+	healthChecker.AddCheck("disk", server.DiskSpaceCheck(*minFreeBytes))
+	healthChecker.AddCheck("metadata", store.Ping)
+	healthChecker.AddCheck("audit", auditLog.Check)
+	if clamd != nil {
+		healthChecker.AddCheck("scanner", clamd.Ping)
+	}
+
+	// Esperar una señal de apagado (SIGINT o SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go healthChecker.Run(ctx)
+	// Trabajos en segundo plano que usan las bases de datos: hay que
+	// esperarlos antes de cerrarlas
+	var background sync.WaitGroup
+	if jobs != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			jobs.Run(ctx, *pipelineWorkers, fileService.ProcessJob)
+		}()
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		erasures.Run(ctx, 1, fileService.EraseJob)
+	}()
+	if notifier != nil {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			notifier.Run(ctx, *webhookWorkers)
+		}()
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		pruneChanges(ctx, store, *changeRetention)
+	}()
+
+	// Exponer métricas Prometheus en un servidor HTTP aparte
+	if *ownerMetrics {
+		metrics.EnableOwnerMetrics(*maxOwnerLabels)
+	}
+	go metrics.SampleStorage(ctx, *storageSampleInterval, func() (uint64, uint64, uint64, error) {
+		usage, err := server.StorageUsage()
+		return usage.Total, usage.Free, usage.Used, err
+	})
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: *metricsAddr, Handler: mux}
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Metrics server failed", "error", err)
+			}
+		}()
+		slog.Info("Metrics endpoint started", "addr", *metricsAddr, "path", "/metrics")
+	}
+
+	// Descargas de archivos comprimidos por HTTP, auditadas como las de gRPC
+	var httpServer *http.Server
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/archive", audit.HTTPHandler(auditLog, "download_archive", fileService.ArchiveHandler()))
+		httpServer = &http.Server{Addr: *httpAddr, Handler: mux}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("HTTP server failed", "error", err)
+			}
+		}()
+		slog.Info("HTTP endpoint started", "addr", *httpAddr, "path", "/archive")
+	}
+
+	// Mantener el servidor ejecutándose y escuchando peticiones. Se empieza
+	// a servir al final, con las métricas por propietario ya habilitadas y
+	// el endpoint de métricas escuchando, para no perder las primeras
+	// peticiones.
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- grpcServer.Serve(grpcListener)
+	}()
+	slog.Info("gRPC server started", "addr", ":50051")
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			fatal("Failed to serve gRPC", err)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutdown signal received, draining in-flight transfers", "timeout", shutdownTimeout.String())
+	healthChecker.Drain()
+	httpDrained := make(chan struct{})
+	go func() {
+		defer close(httpDrained)
+		if httpServer == nil {
+			return
+		}
+		// Esperar las descargas en curso con el mismo límite que gRPC
+		httpCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(httpCtx); err != nil {
+			httpServer.Close()
+		}
+	}()
+	shutdown(grpcServer, fileService, *shutdownTimeout)
+	<-httpDrained
+	// Las etapas y entregas interrumpidas se retoman en el próximo arranque
+	background.Wait()
+	if metricsServer != nil {
+		metricsServer.Close()
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Failed to flush traces", "error", err)
+	}
+	slog.Info("gRPC server stopped")
+}
+
+// shutdown deja de aceptar streams nuevos y espera a que terminen las subidas
+// y descargas en curso. Si no terminan antes del plazo, detiene el servidor a
+// la fuerza y borra los archivos temporales de las subidas interrumpidas.
+func shutdown(grpcServer *grpc.Server, fileService *server.FileService, timeout time.Duration) {
+	fileService.StopWatches()
+	drained := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return
+	case <-time.After(timeout):
+		slog.Warn("Shutdown timeout exceeded, forcing stop")
+		grpcServer.Stop()
+	}
+
+	if n := fileService.CleanupPartialUploads(); n > 0 {
+		slog.Info("Removed partial uploads", "count", n)
+	}
+}
+
+// pruneChanges elimina cada hora los cambios más antiguos que retention del
+// registro que usa WatchFiles.
+func pruneChanges(ctx context.Context, store *metadata.Store, retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		n, err := store.PruneChanges(time.Now().Add(-retention))
+		if err != nil {
+			slog.Error("Failed to prune change log", "error", err)
+		} else if n > 0 {
+			slog.Info("Pruned change log", "removed", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fatal registra el error y termina el proceso.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// parseSizes interpreta una lista de tamaños separados por comas.
+func parseSizes(list string) ([]int, error) {
+	var sizes []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		size, err := strconv.Atoi(field)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("invalid size %q", field)
+		}
+		sizes = append(sizes, size)
+	}
+	slices.Sort(sizes)
+	return slices.Compact(sizes), nil
+}
 
-	// Mantener el servidor ejecutándose y escuchando peticiones
-	if err := grpcServer.Serve(grpcListener); err != nil {
-		log.Fatalf("Failed to serve gRPC: %v", err)
+// parseExtensions interpreta una lista de extensiones separadas por comas y
+// las normaliza en minúsculas y con punto.
+func parseExtensions(list string) []string {
+	var exts []string
+	for _, field := range strings.Split(list, ",") {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field == "" {
+			continue
+		}
+		if !strings.HasPrefix(field, ".") {
+			field = "." + field
+		}
+		exts = append(exts, field)
 	}
+	return exts
 }
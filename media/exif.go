@@ -0,0 +1,303 @@
+package media
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Tags EXIF que se extraen
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagLensModel        = 0xA434
+
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// Un IFD con más entradas que esto se considera dañado
+const maxIFDEntries = 1024
+
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// exifHeader precede al bloque TIFF dentro del segmento APP1 de un JPEG.
+const exifHeader = "Exif\x00\x00"
+
+// tiff recorre un bloque EXIF en formato TIFF.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// Tamaño en bytes de cada tipo de valor TIFF
+var tiffTypeSize = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 8: 2, 9: 4, 10: 8}
+
+// parseEXIF completa info con los datos de cámara, fecha, orientación y GPS.
+func parseEXIF(data []byte, info *Info) error {
+	if len(data) < 8 {
+		return malformed("exif block too short")
+	}
+	t := tiff{data: data}
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return malformed("invalid exif byte order")
+	}
+	if t.order.Uint16(data[2:]) != 42 {
+		return malformed("invalid tiff header")
+	}
+
+	camera := &Camera{}
+	var exifIFD, gpsIFD uint32
+	for _, e := range t.ifd(t.order.Uint32(data[4:])) {
+		switch e.tag {
+		case tagMake:
+			camera.Make = t.ascii(e)
+		case tagModel:
+			camera.Model = t.ascii(e)
+		case tagOrientation:
+			if v := t.unsigned(e); v >= 1 && v <= 8 {
+				info.Orientation = int(v)
+			}
+		case tagDateTime:
+			if info.TakenAt.IsZero() {
+				info.TakenAt = parseExifTime(t.ascii(e))
+			}
+		case tagExifIFD:
+			exifIFD = t.unsigned(e)
+		case tagGPSIFD:
+			gpsIFD = t.unsigned(e)
+		}
+	}
+
+	if exifIFD != 0 {
+		for _, e := range t.ifd(exifIFD) {
+			switch e.tag {
+			case tagExposureTime:
+				if num, den, ok := t.rational(e, 0); ok && num > 0 && den > 0 {
+					camera.ExposureTime = formatExposure(num, den)
+				}
+			case tagFNumber:
+				camera.FNumber = t.float(e, 0)
+			case tagISO:
+				camera.ISO = int(t.unsigned(e))
+			case tagFocalLength:
+				camera.FocalLengthMm = t.float(e, 0)
+			case tagLensModel:
+				camera.Lens = t.ascii(e)
+			case tagDateTimeOriginal:
+				if taken := parseExifTime(t.ascii(e)); !taken.IsZero() {
+					info.TakenAt = taken
+				}
+			}
+		}
+	}
+	if *camera != (Camera{}) {
+		info.Camera = camera
+	}
+
+	if gpsIFD != 0 {
+		info.GPS = t.gps(gpsIFD)
+	}
+	return nil
+}
+
+// ifd retorna las entradas del directorio en offset. Un directorio dañado se
+// trunca en vez de fallar, para conservar lo que sí se pudo leer.
+func (t tiff) ifd(offset uint32) []ifdEntry {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil
+	}
+	count := int(t.order.Uint16(t.data[offset:]))
+	if count > maxIFDEntries {
+		return nil
+	}
+	entries := make([]ifdEntry, 0, count)
+	for i := 0; i < count; i++ {
+		pos := int(offset) + 2 + i*12
+		if pos+12 > len(t.data) {
+			break
+		}
+		e := ifdEntry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+		}
+		size, ok := tiffTypeSize[e.typ]
+		if !ok || e.count > uint32(len(t.data)) {
+			continue
+		}
+		n := size * int(e.count)
+		// Los valores de hasta 4 bytes van en la propia entrada
+		start := pos + 8
+		if n > 4 {
+			start = int(t.order.Uint32(t.data[pos+8:]))
+		}
+		if start < 0 || start+n > len(t.data) {
+			continue
+		}
+		e.value = t.data[start : start+n]
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (t tiff) ascii(e ifdEntry) string {
+	if e.typ != 2 {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.value), "\x00")
+	return strings.TrimSpace(strings.ToValidUTF8(s, ""))
+}
+
+func (t tiff) unsigned(e ifdEntry) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	case e.typ == 1 && len(e.value) >= 1:
+		return uint32(e.value[0])
+	}
+	return 0
+}
+
+func (t tiff) rational(e ifdEntry, i int) (num, den uint32, ok bool) {
+	if (e.typ != 5 && e.typ != 10) || len(e.value) < (i+1)*8 {
+		return 0, 0, false
+	}
+	return t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:]), true
+}
+
+func (t tiff) float(e ifdEntry, i int) float64 {
+	num, den, ok := t.rational(e, i)
+	if !ok || den == 0 {
+		return 0
+	}
+	if e.typ == 10 {
+		return float64(int32(num)) / float64(int32(den))
+	}
+	return float64(num) / float64(den)
+}
+
+// gps lee la ubicación del IFD GPS. Retorna nil si falta la latitud o la
+// longitud.
+func (t tiff) gps(offset uint32) *GPS {
+	var lat, lon, alt []float64
+	var latRef, lonRef string
+	var below bool
+	for _, e := range t.ifd(offset) {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.ascii(e)
+		case tagGPSLatitude:
+			lat = t.floats(e, 3)
+		case tagGPSLongitudeRef:
+			lonRef = t.ascii(e)
+		case tagGPSLongitude:
+			lon = t.floats(e, 3)
+		case tagGPSAltitudeRef:
+			below = t.unsigned(e) == 1
+		case tagGPSAltitude:
+			alt = t.floats(e, 1)
+		}
+	}
+	if lat == nil || lon == nil {
+		return nil
+	}
+	g := &GPS{
+		Latitude:  degrees(lat),
+		Longitude: degrees(lon),
+	}
+	if latRef == "S" {
+		g.Latitude = -g.Latitude
+	}
+	if lonRef == "W" {
+		g.Longitude = -g.Longitude
+	}
+	if alt != nil {
+		g.Altitude = alt[0]
+		if below {
+			g.Altitude = -g.Altitude
+		}
+	}
+	if math.Abs(g.Latitude) > 90 || math.Abs(g.Longitude) > 180 {
+		return nil
+	}
+	return g
+}
+
+func (t tiff) floats(e ifdEntry, n int) []float64 {
+	if len(e.value) < n*8 {
+		return nil
+	}
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = t.float(e, i)
+	}
+	return values
+}
+
+// degrees convierte grados, minutos y segundos a grados decimales.
+func degrees(dms []float64) float64 {
+	return dms[0] + dms[1]/60 + dms[2]/3600
+}
+
+func parseExifTime(s string) time.Time {
+	t, err := time.Parse(exifTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// formatExposure muestra los tiempos de exposición como se leen en la cámara:
+// "1/250" o "2" segundos.
+func formatExposure(num, den uint32) string {
+	switch {
+	case num >= den:
+		return fmt.Sprintf("%g", float64(num)/float64(den))
+	case den%num == 0:
+		return fmt.Sprintf("1/%d", den/num)
+	}
+	return fmt.Sprintf("%d/%d", num, den)
+}
+
+// orientationEXIF construye un bloque EXIF mínimo que solo guarda la
+// orientación, para conservarla al eliminar el resto de los metadatos.
+func orientationEXIF(orientation int) []byte {
+	b := []byte(exifHeader + "MM\x00\x2a\x00\x00\x00\x08")
+	b = binary.BigEndian.AppendUint16(b, 1) // Una entrada
+	b = binary.BigEndian.AppendUint16(b, tagOrientation)
+	b = binary.BigEndian.AppendUint16(b, 3) // SHORT
+	b = binary.BigEndian.AppendUint32(b, 1)
+	b = binary.BigEndian.AppendUint16(b, uint16(orientation))
+	b = binary.BigEndian.AppendUint16(b, 0)
+	return binary.BigEndian.AppendUint32(b, 0) // Sin más IFDs
+}
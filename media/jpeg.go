@@ -0,0 +1,170 @@
+package media
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// Marcadores JPEG
+const (
+	markerSOI   = 0xD8
+	markerEOI   = 0xD9
+	markerSOS   = 0xDA
+	markerAPP1  = 0xE1
+	markerAPP13 = 0xED
+)
+
+// jpegSegment es un segmento con datos: marcador y contenido sin la longitud.
+type jpegSegment struct {
+	marker byte
+	data   []byte
+}
+
+// nextJPEGSegment lee el siguiente segmento. Los marcadores sin datos (RSTn,
+// TEM) se retornan con data vacío; SOS y EOI terminan la cabecera y también
+// se retornan sin datos.
+func nextJPEGSegment(br *bufio.Reader) (jpegSegment, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return jpegSegment{}, truncated(err, "jpeg header")
+	}
+	if b != 0xFF {
+		return jpegSegment{}, malformed("expected jpeg marker")
+	}
+	// Puede haber bytes 0xFF de relleno antes del marcador
+	marker := byte(0xFF)
+	for marker == 0xFF {
+		if marker, err = br.ReadByte(); err != nil {
+			return jpegSegment{}, truncated(err, "jpeg header")
+		}
+	}
+	if standaloneMarker(marker) || marker == markerSOS || marker == markerEOI {
+		return jpegSegment{marker: marker}, nil
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(br, length[:]); err != nil {
+		return jpegSegment{}, truncated(err, "jpeg segment")
+	}
+	n := int(binary.BigEndian.Uint16(length[:])) - 2
+	if n < 0 {
+		return jpegSegment{}, malformed("invalid jpeg segment length")
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(br, data); err != nil {
+		return jpegSegment{}, truncated(err, "jpeg segment")
+	}
+	return jpegSegment{marker: marker, data: data}, nil
+}
+
+func standaloneMarker(m byte) bool {
+	return m == 0x01 || (m >= 0xD0 && m <= 0xD7)
+}
+
+// startOfFrame reconoce los marcadores SOFn, que llevan las dimensiones.
+func startOfFrame(m byte) bool {
+	return m >= 0xC0 && m <= 0xCF && m != 0xC4 && m != 0xC8 && m != 0xCC
+}
+
+func isEXIF(s jpegSegment) bool {
+	return s.marker == markerAPP1 && len(s.data) > len(exifHeader) && string(s.data[:len(exifHeader)]) == exifHeader
+}
+
+// readJPEG recorre la cabecera de un JPEG hasta el inicio de los datos de la
+// imagen, leyendo las dimensiones y el bloque EXIF.
+func readJPEG(r io.Reader, info *Info) error {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi != [2]byte{0xFF, markerSOI} {
+		return malformed("missing jpeg start of image")
+	}
+	for {
+		s, err := nextJPEGSegment(br)
+		if err != nil {
+			return err
+		}
+		switch {
+		case s.marker == markerSOS || s.marker == markerEOI:
+			return nil
+		case startOfFrame(s.marker) && len(s.data) >= 5 && info.Width == 0:
+			info.Height = int(binary.BigEndian.Uint16(s.data[1:]))
+			info.Width = int(binary.BigEndian.Uint16(s.data[3:]))
+		case isEXIF(s):
+			// Un bloque EXIF dañado no invalida la imagen
+			parseEXIF(s.data[len(exifHeader):], info)
+		}
+	}
+}
+
+func extractJPEG(r io.Reader) (*Info, error) {
+	info := &Info{Format: "jpeg"}
+	if err := readJPEG(r, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Orientation retorna el valor EXIF de orientación (1-8) de un JPEG, o 1 si
+// no lo tiene.
+func Orientation(r io.Reader) int {
+	info := &Info{}
+	readJPEG(r, info)
+	if info.Orientation == 0 {
+		return 1
+	}
+	return info.Orientation
+}
+
+// jpegStripper produce un JPEG sin los segmentos EXIF, XMP (APP1) e IPTC
+// (APP13). Si la imagen tenía orientación, la conserva en un EXIF mínimo
+// para que se siga mostrando derecha.
+type jpegStripper struct {
+	br      *bufio.Reader
+	started bool
+	// Pasado el inicio de los datos de la imagen ya no hay metadatos
+	body bool
+}
+
+func (s *jpegStripper) next() ([]byte, error) {
+	if s.body {
+		return readBlock(s.br)
+	}
+	if !s.started {
+		s.started = true
+		soi := make([]byte, 2)
+		if _, err := io.ReadFull(s.br, soi); err != nil {
+			return nil, truncated(err, "jpeg start of image")
+		}
+		return soi, nil
+	}
+
+	seg, err := nextJPEGSegment(s.br)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case seg.marker == markerSOS || seg.marker == markerEOI:
+		s.body = true
+		return []byte{0xFF, seg.marker}, nil
+	case isEXIF(seg):
+		info := &Info{}
+		parseEXIF(seg.data[len(exifHeader):], info)
+		if info.Orientation <= 1 {
+			return nil, nil
+		}
+		seg.data = orientationEXIF(info.Orientation)
+	case seg.marker == markerAPP1 || seg.marker == markerAPP13:
+		return nil, nil
+	}
+	return encodeJPEGSegment(seg), nil
+}
+
+func encodeJPEGSegment(s jpegSegment) []byte {
+	if standaloneMarker(s.marker) {
+		return []byte{0xFF, s.marker}
+	}
+	b := []byte{0xFF, s.marker}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s.data)+2))
+	return append(b, s.data...)
+}
@@ -0,0 +1,157 @@
+// Package media extrae metadatos técnicos de imágenes, audio y video
+// (dimensiones, duración, cámara, GPS y códecs) leyendo directamente los
+// contenedores, sin dependencias externas.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsupported indica que el archivo no es de un formato reconocido.
+	ErrUnsupported = errors.New("unsupported media format")
+	// ErrMalformed indica que el contenedor está dañado o truncado.
+	ErrMalformed = errors.New("malformed media container")
+)
+
+// Límites para los textos embebidos (chunks de PNG, frames de ID3)
+const (
+	maxTags     = 32
+	maxTagValue = 1024
+	maxTextSize = 64 << 10
+)
+
+// Info describe los metadatos técnicos de un archivo multimedia.
+type Info struct {
+	// Format es el contenedor detectado: jpeg, png, apng, mp3, mp4, m4a o mov
+	Format string `json:"format"`
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// DurationMs es la duración de audio y video en milisegundos
+	DurationMs int64 `json:"duration_ms,omitempty"`
+	// Orientation es el valor EXIF (1-8); Width y Height no lo aplican
+	Orientation int       `json:"orientation,omitempty"`
+	Camera      *Camera   `json:"camera,omitempty"`
+	TakenAt     time.Time `json:"taken_at"`
+	GPS         *GPS      `json:"gps,omitempty"`
+	// Codecs lista los formatos de las pistas (avc1, mp4a, mp3...)
+	Codecs      []string `json:"codecs,omitempty"`
+	BitrateKbps int      `json:"bitrate_kbps,omitempty"`
+	SampleRate  int      `json:"sample_rate,omitempty"`
+	Channels    int      `json:"channels,omitempty"`
+	// Tags guarda textos embebidos: chunks de PNG o título y artista de ID3
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// Camera agrupa los datos de captura de una foto.
+type Camera struct {
+	Make          string  `json:"make,omitempty"`
+	Model         string  `json:"model,omitempty"`
+	Lens          string  `json:"lens,omitempty"`
+	ExposureTime  string  `json:"exposure_time,omitempty"`
+	FNumber       float64 `json:"f_number,omitempty"`
+	ISO           int     `json:"iso,omitempty"`
+	FocalLengthMm float64 `json:"focal_length_mm,omitempty"`
+}
+
+// GPS es la ubicación donde se tomó una foto o se grabó un video.
+type GPS struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude,omitempty"`
+}
+
+// Extract lee los metadatos técnicos del archivo en path. Retorna
+// ErrUnsupported si no es una imagen, audio o video reconocido.
+func Extract(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return ExtractFrom(f, stat.Size())
+}
+
+// ExtractFrom es como Extract, pero lee los size bytes de r.
+func ExtractFrom(ra io.ReaderAt, size int64) (*Info, error) {
+	var err error
+	r := io.NewSectionReader(ra, 0, size)
+
+	var head [12]byte
+	n, _ := r.ReadAt(head[:], 0)
+	var info *Info
+	switch sniff(head[:n]) {
+	case "jpeg":
+		info, err = extractJPEG(r)
+	case "png":
+		info, err = extractPNG(r)
+	case "mp3":
+		info, err = extractMP3(r)
+	case "mp4":
+		info, err = extractMP4(r)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// sniff reconoce el contenedor a partir de los primeros bytes.
+func sniff(head []byte) string {
+	switch {
+	case len(head) >= 3 && head[0] == 0xFF && head[1] == 0xD8 && head[2] == 0xFF:
+		return "jpeg"
+	case bytes.HasPrefix(head, pngSignature):
+		return "png"
+	case bytes.HasPrefix(head, []byte("ID3")):
+		return "mp3"
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return "mp4"
+	case len(head) >= 4 && validFrameHeader(head[:4]):
+		return "mp3"
+	}
+	return ""
+}
+
+// addTag guarda un texto embebido respetando los límites.
+func (info *Info) addTag(key, value string) {
+	if key == "" || value == "" {
+		return
+	}
+	if info.Tags == nil {
+		info.Tags = make(map[string]string)
+	}
+	if _, ok := info.Tags[key]; !ok && len(info.Tags) >= maxTags {
+		return
+	}
+	if len(value) > maxTagValue {
+		value = strings.ToValidUTF8(value[:maxTagValue], "")
+	}
+	info.Tags[key] = value
+}
+
+func malformed(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrMalformed, fmt.Sprintf(format, args...))
+}
+
+// truncated distingue un contenedor incompleto de un error al leer el origen.
+func truncated(err error, what string) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return malformed("truncated %s", what)
+	}
+	return err
+}
@@ -0,0 +1,265 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Frames de texto ID3v2 que se guardan como Tags (v2.3/v2.4 y v2.2)
+var id3Frames = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TALB": "album", "TAL": "album",
+	"TYER": "year", "TYE": "year", "TDRC": "year",
+	"TCON": "genre", "TCO": "genre",
+	"TRCK": "track", "TRK": "track",
+}
+
+// Distancia máxima desde el fin de la etiqueta ID3 hasta el primer frame
+const maxSyncSearch = 64 << 10
+
+// Tablas de MPEG audio: bitrates en kbps por versión y capa, y frecuencias
+var (
+	mpeg1Bitrates = [3][16]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0}, // Capa I
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},    // Capa II
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},     // Capa III
+	}
+	mpeg2Bitrates = [3][16]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	}
+	sampleRates = map[int][3]int{
+		3: {44100, 48000, 32000}, // MPEG-1
+		2: {22050, 24000, 16000}, // MPEG-2
+		0: {11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+// frameHeader es la cabecera de un frame de audio MPEG.
+type frameHeader struct {
+	version    int // 3 = MPEG-1, 2 = MPEG-2, 0 = MPEG-2.5
+	layer      int // 1, 2 o 3
+	bitrate    int // kbps
+	sampleRate int
+	mono       bool
+}
+
+func validFrameHeader(b []byte) bool {
+	_, ok := parseFrameHeader(b)
+	return ok
+}
+
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return frameHeader{}, false
+	}
+	h := frameHeader{
+		version: int(b[1]>>3) & 3,
+		layer:   4 - int(b[1]>>1)&3,
+	}
+	bitrateIndex := int(b[2] >> 4)
+	rateIndex := int(b[2]>>2) & 3
+	if h.version == 1 || h.layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return frameHeader{}, false
+	}
+	if h.version == 3 {
+		h.bitrate = mpeg1Bitrates[h.layer-1][bitrateIndex]
+	} else {
+		h.bitrate = mpeg2Bitrates[h.layer-1][bitrateIndex]
+	}
+	h.sampleRate = sampleRates[h.version][rateIndex]
+	h.mono = b[3]>>6 == 3
+	return h, true
+}
+
+// samplesPerFrame depende de la capa y, en la capa III, de la versión.
+func (h frameHeader) samplesPerFrame() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version != 3:
+		return 576
+	}
+	return 1152
+}
+
+// xingOffset es la posición de la cabecera Xing/Info dentro del primer
+// frame, después de la información lateral.
+func (h frameHeader) xingOffset() int {
+	switch {
+	case h.version == 3 && !h.mono:
+		return 4 + 32
+	case h.version == 3, !h.mono:
+		return 4 + 17
+	}
+	return 4 + 9
+}
+
+func extractMP3(r *io.SectionReader) (*Info, error) {
+	info := &Info{Format: "mp3"}
+	size := r.Size()
+	audioStart, audioEnd := int64(0), size
+	var lengthMs int64
+
+	var header [10]byte
+	if _, err := r.ReadAt(header[:], 0); err == nil && string(header[:3]) == "ID3" {
+		tagSize := int64(syncsafe(header[6:10])) + 10
+		if header[5]&0x10 != 0 { // Pie de etiqueta
+			tagSize += 10
+		}
+		lengthMs = readID3v2(io.NewSectionReader(r, 10, tagSize-10), header[3], info)
+		audioStart = tagSize
+	}
+
+	// Etiqueta ID3v1 al final del archivo
+	if size >= 128 {
+		var v1 [128]byte
+		if _, err := r.ReadAt(v1[:], size-128); err == nil && string(v1[:3]) == "TAG" {
+			audioEnd -= 128
+			if info.Tags == nil {
+				info.addTag("title", id3v1String(v1[3:33]))
+				info.addTag("artist", id3v1String(v1[33:63]))
+				info.addTag("album", id3v1String(v1[63:93]))
+				info.addTag("year", id3v1String(v1[93:97]))
+			}
+		}
+	}
+
+	// Buscar el primer frame de audio
+	buf := make([]byte, min(maxSyncSearch, max(audioEnd-audioStart, 0)))
+	n, _ := r.ReadAt(buf, audioStart)
+	buf = buf[:n]
+	pos := -1
+	var h frameHeader
+	for i := 0; i+4 <= len(buf); i++ {
+		if fh, ok := parseFrameHeader(buf[i:]); ok {
+			pos, h = i, fh
+			break
+		}
+	}
+	if pos < 0 {
+		if info.Tags == nil {
+			return nil, malformed("no mpeg audio frame found")
+		}
+		return info, nil
+	}
+
+	info.Codecs = []string{"mp" + strconv.Itoa(h.layer)}
+	info.SampleRate = h.sampleRate
+	info.Channels = 2
+	if h.mono {
+		info.Channels = 1
+	}
+	info.BitrateKbps = h.bitrate
+
+	// Los archivos de bitrate variable indican el número de frames en una
+	// cabecera Xing o Info; si no está, se estima con el bitrate del primero
+	switch xing := buf[min(pos+h.xingOffset(), len(buf)):]; {
+	case len(xing) >= 12 && (string(xing[:4]) == "Xing" || string(xing[:4]) == "Info") && xing[7]&1 != 0:
+		frames := int64(binary.BigEndian.Uint32(xing[8:12]))
+		info.DurationMs = frames * int64(h.samplesPerFrame()) * 1000 / int64(h.sampleRate)
+		if info.DurationMs > 0 {
+			info.BitrateKbps = int((audioEnd - audioStart - int64(pos)) * 8 / info.DurationMs)
+		}
+	case lengthMs > 0:
+		info.DurationMs = lengthMs
+	default:
+		info.DurationMs = (audioEnd - audioStart - int64(pos)) * 8 / int64(h.bitrate)
+	}
+	return info, nil
+}
+
+// readID3v2 lee los frames de texto de una etiqueta ID3v2 y retorna la
+// duración declarada en TLEN, si la hay.
+func readID3v2(r *io.SectionReader, version byte, info *Info) (lengthMs int64) {
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for offset := int64(0); offset+int64(headerLen) <= r.Size(); {
+		header := make([]byte, headerLen)
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return lengthMs
+		}
+		id := string(header[:idLen])
+		if header[0] == 0 { // Relleno
+			return lengthMs
+		}
+		var size int64
+		switch version {
+		case 2:
+			size = int64(header[3])<<16 | int64(header[4])<<8 | int64(header[5])
+		case 3:
+			size = int64(binary.BigEndian.Uint32(header[4:8]))
+		default:
+			size = int64(syncsafe(header[4:8]))
+		}
+		data := offset + int64(headerLen)
+		offset = data + size
+
+		key, wanted := id3Frames[id]
+		if (!wanted && id != "TLEN" && id != "TLE") || size == 0 || size > maxTextSize {
+			continue
+		}
+		frame := make([]byte, size)
+		if _, err := r.ReadAt(frame, data); err != nil {
+			return lengthMs
+		}
+		text := id3Text(frame)
+		if wanted {
+			info.addTag(key, text)
+		} else if ms, err := strconv.ParseInt(text, 10, 64); err == nil {
+			lengthMs = ms
+		}
+	}
+	return lengthMs
+}
+
+// id3Text decodifica un frame de texto según su byte de codificación.
+func id3Text(frame []byte) string {
+	var s string
+	switch body := frame[1:]; frame[0] {
+	case 0: // ISO-8859-1
+		s = latin1(body)
+	case 1: // UTF-16 con BOM
+		switch {
+		case bytes.HasPrefix(body, []byte{0xFF, 0xFE}):
+			s = decodeUTF16(body[2:], binary.LittleEndian)
+		case bytes.HasPrefix(body, []byte{0xFE, 0xFF}):
+			s = decodeUTF16(body[2:], binary.BigEndian)
+		default:
+			s = decodeUTF16(body, binary.BigEndian)
+		}
+	case 2: // UTF-16BE
+		s = decodeUTF16(body, binary.BigEndian)
+	default: // UTF-8
+		s = strings.ToValidUTF8(string(body), "")
+	}
+	// Los frames con varios valores los separan con NUL
+	s, _, _ = strings.Cut(s, "\x00")
+	return strings.TrimSpace(s)
+}
+
+func decodeUTF16(b []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = order.Uint16(b[i*2:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func id3v1String(b []byte) string {
+	b, _, _ = bytes.Cut(b, []byte{0})
+	return strings.TrimSpace(latin1(b))
+}
+
+// syncsafe decodifica un entero de 28 bits repartido en 4 bytes de 7 bits.
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
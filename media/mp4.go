@@ -0,0 +1,183 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Cajas contenedoras que se recorren en busca de pistas y metadatos
+var mp4Containers = map[string]bool{
+	"moov": true, "trak": true, "mdia": true, "minf": true, "stbl": true, "udta": true,
+}
+
+// Profundidad máxima de cajas anidadas
+const maxBoxDepth = 8
+
+// Ubicación ISO 6709 que guardan las cámaras en la caja ©xyz, como
+// "+40.7128-074.0060+010.000/"
+var iso6709 = regexp.MustCompile(`^([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)([+-]\d+(?:\.\d+)?)?`)
+
+// mp4Parser recorre las cajas de un contenedor ISO BMFF (MP4, MOV, M4A).
+type mp4Parser struct {
+	r    io.ReaderAt
+	info *Info
+	// Tipo de la pista que se está recorriendo (vide, soun...)
+	handler string
+}
+
+func extractMP4(r *io.SectionReader) (*Info, error) {
+	p := &mp4Parser{r: r, info: &Info{Format: "mp4"}}
+	if err := p.walk(0, r.Size(), 0); err != nil {
+		return nil, err
+	}
+	return p.info, nil
+}
+
+func (p *mp4Parser) walk(start, end int64, depth int) error {
+	for offset := start; offset+8 <= end; {
+		var header [16]byte
+		if _, err := p.r.ReadAt(header[:8], offset); err != nil {
+			return malformed("truncated mp4 box")
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+		switch size {
+		case 0: // Hasta el final del contenedor
+			size = end - offset
+		case 1: // Tamaño de 64 bits a continuación
+			if _, err := p.r.ReadAt(header[8:16], offset+8); err != nil {
+				return malformed("truncated mp4 box")
+			}
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		}
+		if size < headerLen || size > end-offset {
+			return malformed("invalid size for mp4 box %q", typ)
+		}
+		body, bodyEnd := offset+headerLen, offset+size
+		offset = bodyEnd
+
+		switch {
+		case mp4Containers[typ]:
+			if depth >= maxBoxDepth {
+				continue
+			}
+			if typ == "trak" {
+				p.handler = ""
+			}
+			if err := p.walk(body, bodyEnd, depth+1); err != nil {
+				return err
+			}
+		case typ == "ftyp":
+			switch string(p.read(body, 4)) {
+			case "qt  ":
+				p.info.Format = "mov"
+			case "M4A ":
+				p.info.Format = "m4a"
+			}
+		case typ == "mvhd":
+			p.movieHeader(p.read(body, 32))
+		case typ == "tkhd":
+			p.trackHeader(p.read(body, bodyEnd-body))
+		case typ == "hdlr":
+			if b := p.read(body, 12); len(b) == 12 {
+				p.handler = string(b[8:12])
+			}
+		case typ == "stsd":
+			p.sampleDescription(p.read(body, min(bodyEnd-body, 64)))
+		case typ == "\xa9xyz":
+			p.location(p.read(body, min(bodyEnd-body, 64)))
+		}
+	}
+	return nil
+}
+
+// read lee n bytes a partir de offset. Retorna nil si no están completos.
+func (p *mp4Parser) read(offset, n int64) []byte {
+	if n <= 0 || n > 1<<16 {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, err := p.r.ReadAt(b, offset); err != nil {
+		return nil
+	}
+	return b
+}
+
+// movieHeader lee la duración de la película de la caja mvhd.
+func (p *mp4Parser) movieHeader(b []byte) {
+	if len(b) < 32 {
+		return
+	}
+	var timescale, duration uint64
+	if b[0] == 1 { // Versión con fechas y duración de 64 bits
+		timescale = uint64(binary.BigEndian.Uint32(b[20:24]))
+		duration = binary.BigEndian.Uint64(b[24:32])
+	} else {
+		timescale = uint64(binary.BigEndian.Uint32(b[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(b[16:20]))
+	}
+	if timescale > 0 {
+		p.info.DurationMs = int64(duration * 1000 / timescale)
+	}
+}
+
+// trackHeader lee las dimensiones de una pista, en punto fijo 16.16 al
+// final de la caja tkhd. Las pistas de audio tienen dimensiones cero.
+func (p *mp4Parser) trackHeader(b []byte) {
+	if len(b) < 84 || p.info.Width != 0 {
+		return
+	}
+	width := int(binary.BigEndian.Uint32(b[len(b)-8:]) >> 16)
+	height := int(binary.BigEndian.Uint32(b[len(b)-4:]) >> 16)
+	if width > 0 && height > 0 {
+		p.info.Width, p.info.Height = width, height
+	}
+}
+
+// sampleDescription lee el códec de la primera entrada de la caja stsd y,
+// en las pistas de audio, los canales y la frecuencia de muestreo.
+func (p *mp4Parser) sampleDescription(b []byte) {
+	// Versión y flags, número de entradas y la cabecera de la primera entrada
+	if len(b) < 16 {
+		return
+	}
+	entry := b[8:]
+	codec := strings.TrimSpace(strings.ToValidUTF8(string(entry[4:8]), ""))
+	if codec != "" && !slices.Contains(p.info.Codecs, codec) {
+		p.info.Codecs = append(p.info.Codecs, codec)
+	}
+	if p.handler == "soun" && len(entry) >= 36 && p.info.SampleRate == 0 {
+		p.info.Channels = int(binary.BigEndian.Uint16(entry[24:26]))
+		p.info.SampleRate = int(binary.BigEndian.Uint32(entry[32:36]) >> 16)
+	}
+}
+
+// location lee la ubicación de la caja ©xyz de QuickTime: longitud del
+// texto, idioma y la coordenada ISO 6709.
+func (p *mp4Parser) location(b []byte) {
+	if len(b) < 4 {
+		return
+	}
+	n := int(binary.BigEndian.Uint16(b[:2]))
+	text := b[4:min(4+n, len(b))]
+	m := iso6709.FindSubmatch(text)
+	if m == nil {
+		return
+	}
+	lat, _ := strconv.ParseFloat(string(m[1]), 64)
+	lon, _ := strconv.ParseFloat(string(m[2]), 64)
+	if lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		return
+	}
+	g := &GPS{Latitude: lat, Longitude: lon}
+	if m[3] != nil {
+		g.Altitude, _ = strconv.ParseFloat(string(m[3]), 64)
+	}
+	p.info.GPS = g
+}
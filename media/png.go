@@ -0,0 +1,190 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// Chunks de texto que no se guardan como Tags: XMP y perfiles EXIF/IPTC
+// embebidos por ImageMagick como texto.
+func metadataTextKey(key string) bool {
+	return key == "XML:com.adobe.xmp" || strings.HasPrefix(key, "Raw profile type ")
+}
+
+func extractPNG(r *io.SectionReader) (*Info, error) {
+	info := &Info{Format: "png"}
+	offset := int64(len(pngSignature))
+	for {
+		var header [8]byte
+		if _, err := r.ReadAt(header[:], offset); err != nil {
+			if info.Width == 0 {
+				return nil, malformed("truncated png chunk")
+			}
+			// Falta IEND: se conserva lo leído
+			return info, nil
+		}
+		length := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:])
+		data := offset + 8
+		offset = data + length + 4 // Más el CRC
+
+		switch typ {
+		case "IHDR":
+			var ihdr [8]byte
+			if length < 13 {
+				return nil, malformed("invalid png header")
+			}
+			if _, err := r.ReadAt(ihdr[:], data); err != nil {
+				return nil, malformed("truncated png header")
+			}
+			info.Width = int(binary.BigEndian.Uint32(ihdr[:4]))
+			info.Height = int(binary.BigEndian.Uint32(ihdr[4:]))
+		case "tEXt", "zTXt", "iTXt":
+			if length > maxTextSize {
+				continue
+			}
+			chunk := make([]byte, length)
+			if _, err := r.ReadAt(chunk, data); err != nil {
+				return info, nil
+			}
+			if key, value, ok := pngText(typ, chunk); ok && !metadataTextKey(key) {
+				info.addTag(key, value)
+			}
+		case "eXIf":
+			if length > 1<<20 {
+				continue
+			}
+			chunk := make([]byte, length)
+			if _, err := r.ReadAt(chunk, data); err != nil {
+				return info, nil
+			}
+			parseEXIF(chunk, info)
+		case "acTL":
+			info.Format = "apng"
+		case "IEND":
+			return info, nil
+		}
+	}
+}
+
+// pngText decodifica un chunk tEXt, zTXt o iTXt.
+func pngText(typ string, chunk []byte) (key, value string, ok bool) {
+	name, rest, found := bytes.Cut(chunk, []byte{0})
+	if !found {
+		return "", "", false
+	}
+	key = string(name)
+	switch typ {
+	case "tEXt":
+		return key, latin1(rest), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflate(rest[1:])
+		if err != nil {
+			return "", "", false
+		}
+		return key, latin1(text), true
+	case "iTXt":
+		// Bandera de compresión, método, idioma y palabra clave traducida
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(parts) < 3 {
+			return "", "", false
+		}
+		text := parts[2]
+		if compressed {
+			var err error
+			if text, err = inflate(text); err != nil {
+				return "", "", false
+			}
+		}
+		return key, strings.ToValidUTF8(string(text), ""), true
+	}
+	return "", "", false
+}
+
+// inflate descomprime un texto limitando su tamaño.
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxTextSize))
+}
+
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// pngStripper produce un PNG sin el chunk eXIf ni los textos con XMP o
+// perfiles EXIF. Los demás chunks se copian sin cambios, así que sus CRC
+// siguen siendo válidos.
+type pngStripper struct {
+	br      *bufio.Reader
+	started bool
+	// Bytes del chunk actual (datos y CRC) que faltan por copiar
+	remaining int64
+	last      bool
+	// Pasado IEND el resto se copia tal cual
+	tail bool
+}
+
+func (s *pngStripper) next() ([]byte, error) {
+	switch {
+	case s.tail:
+		return readBlock(s.br)
+	case s.remaining > 0:
+		buf := make([]byte, min(s.remaining, blockSize))
+		if _, err := io.ReadFull(s.br, buf); err != nil {
+			return nil, truncated(err, "png chunk")
+		}
+		s.remaining -= int64(len(buf))
+		s.tail = s.remaining == 0 && s.last
+		return buf, nil
+	case !s.started:
+		s.started = true
+		signature := make([]byte, len(pngSignature))
+		if _, err := io.ReadFull(s.br, signature); err != nil {
+			return nil, truncated(err, "png signature")
+		}
+		return signature, nil
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s.br, header); err != nil {
+		return nil, truncated(err, "png chunk")
+	}
+	length := int64(binary.BigEndian.Uint32(header[:4]))
+	typ := string(header[4:])
+
+	drop := typ == "eXIf"
+	if typ == "tEXt" || typ == "zTXt" || typ == "iTXt" {
+		// La palabra clave ocupa como mucho 79 bytes más el separador
+		peek, _ := s.br.Peek(int(min(length, 80)))
+		key, _, _ := bytes.Cut(peek, []byte{0})
+		drop = metadataTextKey(string(key))
+	}
+	if drop {
+		if _, err := s.br.Discard(int(length + 4)); err != nil {
+			return nil, truncated(err, "png chunk")
+		}
+		return nil, nil
+	}
+	s.remaining = length + 4
+	s.last = typ == "IEND"
+	return header, nil
+}
@@ -0,0 +1,53 @@
+package media
+
+import (
+	"bufio"
+	"io"
+)
+
+// Tamaño de los bloques que se copian sin cambios
+const blockSize = 32 << 10
+
+// StripReader retorna el contenido de r sin los metadatos EXIF, XMP e IPTC
+// de las imágenes JPEG y PNG, incluida la ubicación GPS. La orientación de
+// los JPEG se conserva. Los demás formatos se leen sin cambios.
+//
+// La limpieza ocurre a medida que se lee, sin cargar el archivo completo.
+func StripReader(r io.Reader) io.Reader {
+	br := bufio.NewReaderSize(r, 64<<10)
+	head, _ := br.Peek(12)
+	switch sniff(head) {
+	case "jpeg":
+		return &stripReader{next: (&jpegStripper{br: br}).next}
+	case "png":
+		return &stripReader{next: (&pngStripper{br: br}).next}
+	}
+	return br
+}
+
+// stripReader entrega los bloques que produce next. Un bloque vacío indica
+// que se descartó un segmento y hay que pedir el siguiente.
+type stripReader struct {
+	next    func() ([]byte, error)
+	pending []byte
+	err     error
+}
+
+func (s *stripReader) Read(p []byte) (int, error) {
+	for len(s.pending) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.pending, s.err = s.next()
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// readBlock lee el siguiente bloque de datos que se copia sin cambios.
+func readBlock(br *bufio.Reader) ([]byte, error) {
+	buf := make([]byte, blockSize)
+	n, err := br.Read(buf)
+	return buf[:n], err
+}
@@ -0,0 +1,140 @@
+package metadata
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Límites de los atributos definidos por el usuario
+const (
+	MaxMetadataEntries  = 32
+	MaxMetadataKeyLen   = 128
+	MaxMetadataValueLen = 1024
+	MaxTags             = 32
+	MaxTagLen           = 64
+)
+
+var ErrInvalidAttribute = errors.New("invalid metadata or tag")
+
+// NormalizeTags recorta espacios, elimina duplicados y ordena las etiquetas.
+func NormalizeTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// ValidateAttributes comprueba los límites de cantidad y tamaño.
+func ValidateAttributes(meta map[string]string, tags []string) error {
+	if len(meta) > MaxMetadataEntries {
+		return fmt.Errorf("%w: at most %d metadata entries allowed", ErrInvalidAttribute, MaxMetadataEntries)
+	}
+	for k, v := range meta {
+		if k == "" || len(k) > MaxMetadataKeyLen {
+			return fmt.Errorf("%w: metadata keys must be 1 to %d bytes", ErrInvalidAttribute, MaxMetadataKeyLen)
+		}
+		if len(v) > MaxMetadataValueLen {
+			return fmt.Errorf("%w: metadata value for %q exceeds %d bytes", ErrInvalidAttribute, k, MaxMetadataValueLen)
+		}
+	}
+	if len(tags) > MaxTags {
+		return fmt.Errorf("%w: at most %d tags allowed", ErrInvalidAttribute, MaxTags)
+	}
+	for _, t := range tags {
+		if len(t) > MaxTagLen {
+			return fmt.Errorf("%w: tag %q exceeds %d bytes", ErrInvalidAttribute, t, MaxTagLen)
+		}
+	}
+	return nil
+}
+
+// UpdateAttributes aplica fn al registro de un archivo visible y guarda el
+// resultado si los atributos siguen dentro de los límites.
+func (s *Store) UpdateAttributes(owner, fileID string, fn func(f *File)) (*File, error) {
+	var file *File
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		f, err := t.visibleFile(owner, fileID)
+		if err != nil {
+			return err
+		}
+		fn(f)
+		f.Tags = NormalizeTags(f.Tags)
+		if len(f.Metadata) == 0 {
+			f.Metadata = nil
+		}
+		if err := ValidateAttributes(f.Metadata, f.Tags); err != nil {
+			return err
+		}
+		f.ModifiedAt = time.Now().UTC()
+		file = f
+		return t.putFile(ChangeUpdated, f, nil)
+	})
+	return file, err
+}
+
+// Query filtra archivos visibles de un propietario.
+type Query struct {
+	// Carpeta donde buscar y si se incluyen sus subcarpetas
+	FolderID  string
+	Recursive bool
+	// Etiquetas que deben estar todas presentes
+	Tags []string
+	// Metadatos que deben coincidir exactamente
+	Metadata map[string]string
+}
+
+func (q Query) matches(f *File) bool {
+	for _, tag := range q.Tags {
+		if !slices.Contains(f.Tags, tag) {
+			return false
+		}
+	}
+	for k, v := range q.Metadata {
+		if got, ok := f.Metadata[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// FindFiles retorna los archivos visibles que cumplen la consulta.
+func (s *Store) FindFiles(owner string, q Query) ([]*File, error) {
+	q.Tags = NormalizeTags(q.Tags)
+	var files []*File
+	err := s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		if err := t.requireFolder(owner, q.FolderID); err != nil {
+			return err
+		}
+		return each(t.files, owner, func(f *File) error {
+			if !q.matches(f) {
+				return nil
+			}
+			if q.Recursive {
+				inside, err := t.isDescendant(owner, f.FolderID, q.FolderID)
+				if err != nil || !inside {
+					return err
+				}
+			} else if f.FolderID != q.FolderID {
+				return nil
+			}
+			if ok, err := t.fileVisible(f); err != nil || !ok {
+				return err
+			}
+			files = append(files, f)
+			return nil
+		})
+	})
+	return files, err
+}
@@ -0,0 +1,265 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrCursorExpired indica que los cambios posteriores al cursor ya se
+// eliminaron del registro: el cliente debe volver a listar su árbol.
+var ErrCursorExpired = errors.New("change cursor has expired")
+
+var (
+	changesBucket = []byte("changes")
+	stateBucket   = []byte("state")
+)
+
+// Tipos de cambio
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+	ChangeMoved   = "moved"
+)
+
+// Change es una entrada del registro de cambios. Guarda el estado del
+// elemento y su ruta en el momento del cambio.
+type Change struct {
+	Seq    uint64    `json:"seq"`
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	File   *File     `json:"file,omitempty"`
+	Folder *Folder   `json:"folder,omitempty"`
+	Path   string    `json:"path"`
+	// Carpeta y ruta anteriores de un elemento movido
+	FromFolderID string `json:"from_folder_id,omitempty"`
+	FromPath     string `json:"from_path,omitempty"`
+}
+
+// ParentID retorna la carpeta que contiene al elemento después del cambio.
+func (c *Change) ParentID() string {
+	return Item{File: c.File, Folder: c.Folder}.parentID()
+}
+
+// Las claves son "<owner>\x00" seguido de la secuencia en big endian, para
+// recorrer los cambios de un propietario en orden.
+func changeKey(owner string, seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(ownerPrefix(owner), seq)
+}
+
+// logChange agrega un cambio al registro dentro de la transacción. La
+// secuencia es global, así que también ordena los cambios de distintos
+// propietarios.
+func (t tree) logChange(typ string, item Item, from *Item) error {
+	c := Change{Type: typ, Time: time.Now().UTC(), File: item.File, Folder: item.Folder}
+	var owner string
+	var err error
+	if item.File != nil {
+		owner = item.File.OwnerID
+		c.Path, err = t.itemPath(owner, item.File.FolderID, item.File.Name)
+	} else {
+		owner = item.Folder.OwnerID
+		c.Path, err = t.itemPath(owner, item.Folder.ParentID, item.Folder.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if from != nil {
+		c.FromFolderID = from.parentID()
+		c.FromPath, err = t.itemPath(owner, c.FromFolderID, from.name())
+		if err != nil {
+			return err
+		}
+	}
+	c.Seq, err = t.changes.NextSequence()
+	if err != nil {
+		return err
+	}
+	return put(t.changes, changeKey(owner, c.Seq), c)
+}
+
+func (t tree) itemPath(owner, parent, name string) (string, error) {
+	dir, err := t.folderPath(owner, parent)
+	if err != nil {
+		return "", err
+	}
+	return joinPath(dir, name), nil
+}
+
+// Ubicación de un elemento antes de modificarlo, para registrar movimientos
+func (i Item) parentID() string {
+	if i.File != nil {
+		return i.File.FolderID
+	}
+	return i.Folder.ParentID
+}
+
+func (i Item) name() string {
+	if i.File != nil {
+		return i.File.Name
+	}
+	return i.Folder.Name
+}
+
+// Changes retorna hasta limit cambios del propietario posteriores a la
+// secuencia after. Si esos cambios ya se eliminaron retorna ErrCursorExpired.
+func (s *Store) Changes(owner string, after uint64, limit int) ([]*Change, error) {
+	var changes []*Change
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if pruned := prunedSeq(tx, owner); after < pruned {
+			return ErrCursorExpired
+		}
+		prefix := ownerPrefix(owner)
+		c := tx.Bucket(changesBucket).Cursor()
+		for k, v := c.Seek(changeKey(owner, after+1)); k != nil && hasPrefix(k, prefix) && len(changes) < limit; k, v = c.Next() {
+			change := new(Change)
+			if err := json.Unmarshal(v, change); err != nil {
+				return fmt.Errorf("corrupt change record %q: %w", k, err)
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	return changes, err
+}
+
+// ChangeHead retorna la secuencia del último cambio registrado. Un cliente
+// que empieza a observar desde ahí recibe solo los cambios nuevos.
+func (s *Store) ChangeHead() (uint64, error) {
+	var seq uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seq = tx.Bucket(changesBucket).Sequence()
+		return nil
+	})
+	return seq, err
+}
+
+// PruneChanges elimina los cambios anteriores a before y retorna cuántos
+// borró. Los cursores de un propietario anteriores a su último cambio
+// eliminado dejan de ser válidos.
+func (s *Store) PruneChanges(before time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(changesBucket)
+		var stale [][]byte
+		pruned := make(map[string]uint64)
+		err := b.ForEach(func(k, v []byte) error {
+			var c Change
+			if err := json.Unmarshal(v, &c); err != nil {
+				return fmt.Errorf("corrupt change record %q: %w", k, err)
+			}
+			if c.Time.Before(before) {
+				stale = append(stale, k)
+				owner := string(k[:len(k)-9])
+				pruned[owner] = max(pruned[owner], c.Seq)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		state := tx.Bucket(stateBucket)
+		for owner, seq := range pruned {
+			if err := state.Put(prunedKey(owner), binary.BigEndian.AppendUint64(nil, seq)); err != nil {
+				return err
+			}
+		}
+		removed = len(stale)
+		return nil
+	})
+	return removed, err
+}
+
+// Secuencia del último cambio del propietario eliminado por PruneChanges
+func prunedKey(owner string) []byte {
+	return append([]byte("changes_pruned\x00"), owner...)
+}
+
+func prunedSeq(tx *bolt.Tx, owner string) uint64 {
+	if v := tx.Bucket(stateBucket).Get(prunedKey(owner)); len(v) == 8 {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+// InFolder indica si la carpeta folderID es ancestor o está dentro de él.
+func (s *Store) InFolder(owner, folderID, ancestor string) (bool, error) {
+	if ancestor == RootID {
+		return true, nil
+	}
+	var inside bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		inside, err = newTree(tx).isDescendant(owner, folderID, ancestor)
+		if err == ErrNotFound {
+			inside, err = false, nil
+		}
+		return err
+	})
+	return inside, err
+}
+
+// changeFeed avisa a los observadores de un propietario que hay cambios
+// nuevos. Los avisos se acumulan en un canal de capacidad 1: un observador
+// lento recibe un solo aviso y lee todo lo pendiente del registro.
+type changeFeed struct {
+	mu   sync.Mutex
+	subs map[string]map[chan struct{}]struct{}
+}
+
+// Subscribe retorna un canal que recibe un aviso después de cada cambio del
+// propietario, y la función para cancelar la suscripción.
+func (s *Store) Subscribe(owner string) (<-chan struct{}, func()) {
+	f := &s.feed
+	ch := make(chan struct{}, 1)
+	f.mu.Lock()
+	if f.subs == nil {
+		f.subs = make(map[string]map[chan struct{}]struct{})
+	}
+	if f.subs[owner] == nil {
+		f.subs[owner] = make(map[chan struct{}]struct{})
+	}
+	f.subs[owner][ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		delete(f.subs[owner], ch)
+		if len(f.subs[owner]) == 0 {
+			delete(f.subs, owner)
+		}
+		f.mu.Unlock()
+	}
+}
+
+func (f *changeFeed) notify(owner string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch := range f.subs[owner] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// update ejecuta fn en una transacción de escritura y, si se confirma, avisa
+// a los observadores del propietario.
+func (s *Store) update(owner string, fn func(tx *bolt.Tx) error) error {
+	if err := s.db.Update(fn); err != nil {
+		return err
+	}
+	s.feed.notify(owner)
+	return nil
+}
@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Eventos pendientes: un outbox dentro de la base de metadatos. Cada evento
+// se guarda en la misma transacción que el cambio que lo produce, así que una
+// caída no puede confirmar el cambio y perder el evento. Quien los entrega
+// los lee con PendingEvents y los borra con DeleteEvent cuando ya los guardó
+// en su propio destino; si se cae entre las dos cosas, el evento se entrega
+// de nuevo con el mismo ID.
+
+var eventsBucket = []byte("events")
+
+// Event es un evento pendiente sobre un archivo.
+type Event struct {
+	Seq uint64 `json:"seq"`
+	// ID es único y se conserva si el evento se entrega más de una vez
+	ID   string    `json:"id"`
+	Type string    `json:"type"`
+	Time time.Time `json:"time"`
+	// Estado y ruta del archivo al producirse el evento
+	File *File  `json:"file"`
+	Path string `json:"path"`
+}
+
+// Las claves son la secuencia en big endian, para leer los eventos en orden.
+func eventKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// addEvents guarda un evento de cada tipo para el archivo dentro de la
+// transacción.
+func (t tree) addEvents(types []string, f *File) error {
+	if len(types) == 0 {
+		return nil
+	}
+	path, err := t.itemPath(f.OwnerID, f.FolderID, f.Name)
+	if err != nil {
+		return err
+	}
+	for _, typ := range types {
+		e := Event{ID: NewID(), Type: typ, Time: time.Now().UTC(), File: f, Path: path}
+		if e.Seq, err = t.events.NextSequence(); err != nil {
+			return err
+		}
+		if err := put(t.events, eventKey(e.Seq), e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingEvents retorna hasta limit eventos pendientes, los más antiguos
+// primero.
+func (s *Store) PendingEvents(limit int) ([]*Event, error) {
+	var events []*Event
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(eventsBucket).Cursor()
+		for k, v := c.First(); k != nil && len(events) < limit; k, v = c.Next() {
+			e := new(Event)
+			if err := json.Unmarshal(v, e); err != nil {
+				return fmt.Errorf("corrupt event record %q: %w", k, err)
+			}
+			events = append(events, e)
+		}
+		return nil
+	})
+	return events, err
+}
+
+// DeleteEvent borra un evento ya entregado.
+func (s *Store) DeleteEvent(seq uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).Delete(eventKey(seq))
+	})
+}
+
+// eraseEvents borra los eventos pendientes del propietario dentro de la
+// transacción y retorna cuántos borró.
+func eraseEvents(tx *bolt.Tx, owner string) (int, error) {
+	b := tx.Bucket(eventsBucket)
+	var stale [][]byte
+	err := b.ForEach(func(k, v []byte) error {
+		var e Event
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("corrupt event record %q: %w", k, err)
+		}
+		if e.File != nil && e.File.OwnerID == owner {
+			stale = append(stale, k)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
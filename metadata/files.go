@@ -0,0 +1,201 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// PutFile crea o actualiza el registro de un archivo subido. Si ya existía,
+// conserva su fecha de creación y, si f no trae atributos, sus metadatos y
+// etiquetas. En la misma transacción guarda un evento pendiente de cada tipo
+// de events (ver PendingEvents).
+func (s *Store) PutFile(f *File, events ...string) error {
+	return s.update(f.OwnerID, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		now := time.Now().UTC()
+
+		change := ChangeCreated
+		if existing, err := t.file(f.OwnerID, f.FileID); err == nil {
+			if !existing.Trashed() {
+				change = ChangeUpdated
+			}
+			f.CreatedAt = existing.CreatedAt
+			// Una nueva subida sin atributos conserva los anteriores
+			if f.Metadata == nil && f.Tags == nil {
+				f.Metadata = existing.Metadata
+				f.Tags = existing.Tags
+			}
+		} else if err != ErrNotFound {
+			return err
+		} else {
+			f.CreatedAt = now
+		}
+		f.ModifiedAt = now
+		f.TrashedAt = time.Time{}
+
+		if err := t.requireFolder(f.OwnerID, f.FolderID); err != nil {
+			return err
+		}
+		if err := t.checkName(f.OwnerID, f.FolderID, f.Name, Ref{FileID: f.FileID}); err != nil {
+			return err
+		}
+		if err := t.putFile(change, f, nil); err != nil {
+			return err
+		}
+		return t.addEvents(events, f)
+	})
+}
+
+// Usage retorna el tamaño total de los archivos del propietario, incluidos
+// los que están en la papelera, que siguen ocupando espacio en el NFS.
+func (s *Store) Usage(owner string) (int64, error) {
+	var total int64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return each(tx.Bucket(filesBucket), owner, func(f *File) error {
+			total += f.Size
+			return nil
+		})
+	})
+	return total, err
+}
+
+// EachFile llama a fn con el registro de cada archivo de todos los
+// propietarios, incluidos los que están en la papelera. fn no debe modificar
+// el almacén.
+func (s *Store) EachFile(fn func(*File) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(filesBucket).ForEach(func(k, v []byte) error {
+			f := new(File)
+			if err := json.Unmarshal(v, f); err != nil {
+				return fmt.Errorf("corrupt metadata record %q: %w", k, err)
+			}
+			return fn(f)
+		})
+	})
+}
+
+// ValidateFile comprueba, antes de escribir el contenido, que el archivo se
+// pueda registrar en su carpeta con ese nombre.
+func (s *Store) ValidateFile(f *File) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		if err := t.requireFolder(f.OwnerID, f.FolderID); err != nil {
+			return err
+		}
+		return t.checkName(f.OwnerID, f.FolderID, f.Name, Ref{FileID: f.FileID})
+	})
+}
+
+// GetFile retorna el registro de un archivo visible. Si el archivo o alguna
+// de sus carpetas está en la papelera retorna ErrTrashed.
+func (s *Store) GetFile(owner, fileID string) (*File, error) {
+	var file *File
+	err := s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		f, err := t.file(owner, fileID)
+		if err != nil {
+			return err
+		}
+		ok, err := t.fileVisible(f)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrTrashed
+		}
+		file = f
+		return nil
+	})
+	return file, err
+}
+
+// LoadFile retorna el registro de un archivo aunque esté en la papelera.
+func (s *Store) LoadFile(owner, fileID string) (*File, error) {
+	var file *File
+	err := s.db.View(func(tx *bolt.Tx) (err error) {
+		file, err = newTree(tx).file(owner, fileID)
+		return err
+	})
+	return file, err
+}
+
+// UpdateFile modifica el registro de un archivo con fn dentro de una
+// transacción. A diferencia de PutFile no cambia la fecha de modificación ni
+// la ubicación, y se aplica también a archivos en la papelera. Si fn retorna
+// un error, el registro no se modifica.
+func (s *Store) UpdateFile(owner, fileID string, fn func(*File) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		f, err := t.file(owner, fileID)
+		if err != nil {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+		return put(t.files, key(owner, fileID), f)
+	})
+}
+
+// FilePath retorna la ruta absoluta de un archivo dentro del árbol.
+func (s *Store) FilePath(f *File) (string, error) {
+	var path string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		dir, err := newTree(tx).folderPath(f.OwnerID, f.FolderID)
+		if err != nil {
+			return err
+		}
+		path = joinPath(dir, f.Name)
+		return nil
+	})
+	return path, err
+}
+
+func joinPath(dir, name string) string {
+	if dir == "/" {
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+// EraseOwner borra todos los registros del propietario: sus archivos, con las
+// claves de datos envueltas de los cifrados, sus carpetas y su registro de
+// cambios y sus eventos pendientes, que guardan copias de los registros. Los
+// cursores de WatchFiles del propietario dejan de ser válidos. Retorna los
+// archivos borrados.
+func (s *Store) EraseOwner(owner string) (files []*File, folders, changes int, err error) {
+	err = s.update(owner, func(tx *bolt.Tx) error {
+		filesB := tx.Bucket(filesBucket)
+		err := each(filesB, owner, func(f *File) error {
+			files = append(files, f)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := deletePrefix(filesB, ownerPrefix(owner)); err != nil {
+			return err
+		}
+		if folders, err = deletePrefix(tx.Bucket(foldersBucket), ownerPrefix(owner)); err != nil {
+			return err
+		}
+		changesB := tx.Bucket(changesBucket)
+		if changes, err = deletePrefix(changesB, ownerPrefix(owner)); err != nil {
+			return err
+		}
+		head := binary.BigEndian.AppendUint64(nil, changesB.Sequence())
+		if err := tx.Bucket(stateBucket).Put(prunedKey(owner), head); err != nil {
+			return err
+		}
+		_, err = eraseEvents(tx, owner)
+		return err
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return files, folders, changes, nil
+}
@@ -0,0 +1,376 @@
+package metadata
+
+import (
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// CreateFolder crea una carpeta dentro de parentID.
+func (s *Store) CreateFolder(owner, parentID, name string) (*Folder, error) {
+	return s.ImportFolder(owner, parentID, name, Folder{})
+}
+
+// ImportFolder crea una carpeta dentro de parentID con el id y las fechas
+// de from, por ejemplo al importar un paquete. Si from no tiene id o ya
+// está en uso, incluso en la papelera, la carpeta recibe uno nuevo; las
+// fechas que falten son la actual.
+func (s *Store) ImportFolder(owner, parentID, name string, from Folder) (*Folder, error) {
+	var folder *Folder
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		if err := t.requireFolder(owner, parentID); err != nil {
+			return err
+		}
+		if err := t.checkName(owner, parentID, name, Ref{}); err != nil {
+			return err
+		}
+		id := from.FolderID
+		if id != RootID {
+			switch _, err := t.folder(owner, id); {
+			case err == nil:
+				id = RootID
+			case err != ErrNotFound:
+				return err
+			}
+		}
+		if id == RootID {
+			id = NewID()
+		}
+		now := time.Now().UTC()
+		folder = &Folder{
+			OwnerID:    owner,
+			FolderID:   id,
+			Name:       name,
+			ParentID:   parentID,
+			CreatedAt:  from.CreatedAt,
+			ModifiedAt: from.ModifiedAt,
+		}
+		if folder.CreatedAt.IsZero() {
+			folder.CreatedAt = now
+		}
+		if folder.ModifiedAt.IsZero() {
+			folder.ModifiedAt = now
+		}
+		return t.putFolder(ChangeCreated, folder, nil)
+	})
+	return folder, err
+}
+
+// GetFolder retorna una carpeta visible. RootID retorna la raíz virtual.
+func (s *Store) GetFolder(owner, folderID string) (*Folder, error) {
+	if folderID == RootID {
+		return &Folder{OwnerID: owner, FolderID: RootID, Name: "/"}, nil
+	}
+	var folder *Folder
+	err := s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		ok, err := t.folderVisible(owner, folderID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotFound
+		}
+		folder, err = t.folder(owner, folderID)
+		return err
+	})
+	return folder, err
+}
+
+// FolderPath retorna la ruta absoluta de una carpeta.
+func (s *Store) FolderPath(owner, folderID string) (string, error) {
+	var path string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		path, err = newTree(tx).folderPath(owner, folderID)
+		return err
+	})
+	return path, err
+}
+
+// Resolve busca un archivo o carpeta por su ruta absoluta.
+func (s *Store) Resolve(owner, path string) (Item, error) {
+	var item Item
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		item, err = newTree(tx).resolve(owner, path)
+		return err
+	})
+	return item, err
+}
+
+// List retorna el contenido directo de una carpeta visible.
+func (s *Store) List(owner, folderID string) ([]*Folder, []*File, error) {
+	var folders []*Folder
+	var files []*File
+	err := s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		if err := t.requireFolder(owner, folderID); err != nil {
+			return err
+		}
+		var err error
+		folders, files, err = t.children(owner, folderID)
+		return err
+	})
+	return folders, files, err
+}
+
+// Move mueve un archivo o carpeta a destID en una sola transacción. Como los
+// archivos solo guardan el id de su carpeta, mover una carpeta mueve todo su
+// contenido de forma atómica.
+func (s *Store) Move(owner string, ref Ref, destID string) (Item, error) {
+	var item Item
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		if err := t.requireFolder(owner, destID); err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+
+		if ref.FolderID != "" {
+			f, err := t.visibleFolder(owner, ref.FolderID)
+			if err != nil {
+				return err
+			}
+			inside, err := t.isDescendant(owner, destID, f.FolderID)
+			if err != nil {
+				return err
+			}
+			if inside {
+				return ErrInvalidMove
+			}
+			if err := t.checkName(owner, destID, f.Name, ref); err != nil {
+				return err
+			}
+			from := Item{Folder: &Folder{ParentID: f.ParentID, Name: f.Name}}
+			f.ParentID = destID
+			f.ModifiedAt = now
+			item.Folder = f
+			return t.putFolder(ChangeMoved, f, &from)
+		}
+
+		f, err := t.visibleFile(owner, ref.FileID)
+		if err != nil {
+			return err
+		}
+		if err := t.checkName(owner, destID, f.Name, ref); err != nil {
+			return err
+		}
+		from := Item{File: &File{FolderID: f.FolderID, Name: f.Name}}
+		f.FolderID = destID
+		f.ModifiedAt = now
+		item.File = f
+		return t.putFile(ChangeMoved, f, &from)
+	})
+	return item, err
+}
+
+// Rename cambia el nombre de un archivo o carpeta.
+func (s *Store) Rename(owner string, ref Ref, name string) (Item, error) {
+	var item Item
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		now := time.Now().UTC()
+
+		if ref.FolderID != "" {
+			f, err := t.visibleFolder(owner, ref.FolderID)
+			if err != nil {
+				return err
+			}
+			if err := t.checkName(owner, f.ParentID, name, ref); err != nil {
+				return err
+			}
+			from := Item{Folder: &Folder{ParentID: f.ParentID, Name: f.Name}}
+			f.Name = name
+			f.ModifiedAt = now
+			item.Folder = f
+			return t.putFolder(ChangeMoved, f, &from)
+		}
+
+		f, err := t.visibleFile(owner, ref.FileID)
+		if err != nil {
+			return err
+		}
+		if err := t.checkName(owner, f.FolderID, name, ref); err != nil {
+			return err
+		}
+		from := Item{File: &File{FolderID: f.FolderID, Name: f.Name}}
+		f.Name = name
+		f.ModifiedAt = now
+		item.File = f
+		return t.putFile(ChangeMoved, f, &from)
+	})
+	return item, err
+}
+
+// Trash envía un archivo o carpeta a la papelera. Para una carpeta basta con
+// marcarla: todo su contenido deja de ser visible con ella. En la misma
+// transacción guarda un evento pendiente de cada tipo de events para el
+// archivo, o para cada archivo visible dentro de la carpeta, que se retornan
+// en Descendants.
+func (s *Store) Trash(owner string, ref Ref, events ...string) (Item, error) {
+	var item Item
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		now := time.Now().UTC()
+
+		if ref.FolderID != "" {
+			f, err := t.visibleFolder(owner, ref.FolderID)
+			if err != nil {
+				return err
+			}
+			// Los eventos llevan la ruta que tenían los archivos
+			descendants, err := t.descendants(owner, f.FolderID)
+			if err != nil {
+				return err
+			}
+			for _, file := range descendants {
+				if err := t.addEvents(events, file); err != nil {
+					return err
+				}
+			}
+			f.TrashedAt = now
+			item.Folder = f
+			item.Descendants = descendants
+			return t.putFolder(ChangeDeleted, f, nil)
+		}
+
+		f, err := t.visibleFile(owner, ref.FileID)
+		if err != nil {
+			return err
+		}
+		f.TrashedAt = now
+		item.File = f
+		if err := t.putFile(ChangeDeleted, f, nil); err != nil {
+			return err
+		}
+		return t.addEvents(events, f)
+	})
+	return item, err
+}
+
+// Restore saca un elemento de la papelera. Si su carpeta original ya no es
+// visible, se restaura en la raíz. Para una carpeta, Descendants son los
+// archivos que vuelven a ser visibles con ella.
+func (s *Store) Restore(owner string, ref Ref) (Item, error) {
+	var item Item
+	err := s.update(owner, func(tx *bolt.Tx) error {
+		t := newTree(tx)
+
+		if ref.FolderID != "" {
+			f, err := t.folder(owner, ref.FolderID)
+			if err != nil {
+				return err
+			}
+			if !f.Trashed() {
+				return ErrNotInTrash
+			}
+			if ok, err := t.folderVisible(owner, f.ParentID); err != nil {
+				return err
+			} else if !ok {
+				f.ParentID = RootID
+			}
+			if err := t.checkName(owner, f.ParentID, f.Name, ref); err != nil {
+				return err
+			}
+			f.TrashedAt = time.Time{}
+			item.Folder = f
+			if err := t.putFolder(ChangeCreated, f, nil); err != nil {
+				return err
+			}
+			item.Descendants, err = t.descendants(owner, f.FolderID)
+			return err
+		}
+
+		f, err := t.file(owner, ref.FileID)
+		if err != nil {
+			return err
+		}
+		if !f.Trashed() {
+			return ErrNotInTrash
+		}
+		if ok, err := t.folderVisible(owner, f.FolderID); err != nil {
+			return err
+		} else if !ok {
+			f.FolderID = RootID
+		}
+		if err := t.checkName(owner, f.FolderID, f.Name, ref); err != nil {
+			return err
+		}
+		f.TrashedAt = time.Time{}
+		item.File = f
+		return t.putFile(ChangeCreated, f, nil)
+	})
+	return item, err
+}
+
+// ListTrash retorna los elementos enviados a la papelera.
+func (s *Store) ListTrash(owner string) ([]*Folder, []*File, error) {
+	var folders []*Folder
+	var files []*File
+	err := s.db.View(func(tx *bolt.Tx) error {
+		t := newTree(tx)
+		err := each(t.folders, owner, func(f *Folder) error {
+			if f.Trashed() {
+				folders = append(folders, f)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return each(t.files, owner, func(f *File) error {
+			if f.Trashed() {
+				files = append(files, f)
+			}
+			return nil
+		})
+	})
+	return folders, files, err
+}
+
+func (t tree) visibleFolder(owner, id string) (*Folder, error) {
+	if id == RootID {
+		return nil, ErrInvalidName
+	}
+	ok, err := t.folderVisible(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return t.folder(owner, id)
+}
+
+func (t tree) visibleFile(owner, id string) (*File, error) {
+	f, err := t.file(owner, id)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := t.fileVisible(f)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return f, nil
+}
+
+// putFolder guarda una carpeta y registra el cambio.
+func (t tree) putFolder(change string, f *Folder, from *Item) error {
+	if err := put(t.folders, key(f.OwnerID, f.FolderID), f); err != nil {
+		return err
+	}
+	return t.logChange(change, Item{Folder: f}, from)
+}
+
+// putFile guarda un archivo y registra el cambio.
+func (t tree) putFile(change string, f *File, from *Item) error {
+	if err := put(t.files, key(f.OwnerID, f.FileID), f); err != nil {
+		return err
+	}
+	return t.logChange(change, Item{File: f}, from)
+}
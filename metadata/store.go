@@ -0,0 +1,148 @@
+// Package metadata guarda los registros de archivos y carpetas de cada
+// propietario en una base de datos bbolt local.
+package metadata
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrExists      = errors.New("an item with that name already exists")
+	ErrInvalidName = errors.New("invalid name")
+	ErrInvalidMove = errors.New("cannot move a folder into itself or one of its subfolders")
+	ErrNotInTrash  = errors.New("item is not in the trash")
+	ErrTrashed     = errors.New("item is in the trash")
+)
+
+var (
+	filesBucket   = []byte("files")
+	foldersBucket = []byte("folders")
+)
+
+// Store es el almacén de metadatos.
+type Store struct {
+	db *bolt.DB
+	// Observadores del registro de cambios
+	feed changeFeed
+}
+
+// Open abre (o crea) la base de datos de metadatos en path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metadata store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{filesBucket, foldersBucket, changesBucket, stateBucket, eventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize metadata store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping comprueba que la base de datos responde. Se usa en el health check.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(filesBucket) == nil {
+			return errors.New("metadata store is not initialized")
+		}
+		return nil
+	})
+}
+
+// Las claves son "<owner>\x00<id>" para poder recorrer por propietario.
+func key(owner, id string) []byte {
+	return []byte(owner + "\x00" + id)
+}
+
+func ownerPrefix(owner string) []byte {
+	return []byte(owner + "\x00")
+}
+
+// NewID genera un id aleatorio para un archivo o una carpeta.
+func NewID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func get[T any](b *bolt.Bucket, k []byte) (*T, error) {
+	data := b.Get(k)
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	v := new(T)
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("corrupt metadata record %q: %w", k, err)
+	}
+	return v, nil
+}
+
+func put(b *bolt.Bucket, k []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, data)
+}
+
+// each decodifica cada registro del propietario en el bucket.
+func each[T any](b *bolt.Bucket, owner string, fn func(*T) error) error {
+	prefix := ownerPrefix(owner)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, v = c.Next() {
+		rec := new(T)
+		if err := json.Unmarshal(v, rec); err != nil {
+			return fmt.Errorf("corrupt metadata record %q: %w", k, err)
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasPrefix(k, prefix []byte) bool {
+	return len(k) >= len(prefix) && string(k[:len(prefix)]) == string(prefix)
+}
+
+// deletePrefix borra las claves con el prefijo y retorna cuántas borró.
+func deletePrefix(b *bolt.Bucket, prefix []byte) (int, error) {
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && hasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, k)
+	}
+	for _, k := range keys {
+		if err := b.Delete(k); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
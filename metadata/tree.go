@@ -0,0 +1,347 @@
+package metadata
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/media"
+	bolt "go.etcd.io/bbolt"
+)
+
+// RootID identifica la carpeta raíz virtual de cada propietario.
+const RootID = ""
+
+// File es el registro de un archivo subido.
+type File struct {
+	OwnerID  string `json:"owner_id"`
+	FileID   string `json:"file_id"`
+	Name     string `json:"name"`
+	FolderID string `json:"folder_id"`
+	// StorageName es el nombre del archivo dentro del directorio del propietario
+	StorageName string `json:"storage_name"`
+	// OriginalName es el nombre con el que se subió; Name puede cambiar con Rename
+	OriginalName string `json:"original_name"`
+	// ContentType es el tipo declarado por el cliente
+	ContentType string `json:"content_type,omitempty"`
+	// DetectedContentType es el tipo detectado a partir de los primeros bytes
+	DetectedContentType string `json:"detected_content_type"`
+	// Metadatos y etiquetas definidos por el usuario
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Tags     []string          `json:"tags,omitempty"`
+	// Media son los metadatos técnicos extraídos del contenido
+	Media *media.Info `json:"media,omitempty"`
+	// ScanStatus es el resultado del análisis de malware (vacío si no se
+	// analizó) y ScanSignature la amenaza detectada
+	ScanStatus    string `json:"scan_status,omitempty"`
+	ScanSignature string `json:"scan_signature,omitempty"`
+	// SHA256 es el hash del contenido guardado, en hexadecimal
+	SHA256 string `json:"sha256,omitempty"`
+	// Encryption es la clave de datos del contenido, envuelta con una clave
+	// maestra; nil si el contenido se guardó sin cifrar
+	Encryption *encryption.WrappedKey `json:"encryption,omitempty"`
+	// Compression es el algoritmo con el que se comprimió el contenido antes
+	// de cifrarlo (ver el paquete compression); vacío si no se comprimió
+	Compression string `json:"compression,omitempty"`
+	// Processing es el estado del pipeline de la última subida
+	Processing *Processing `json:"processing,omitempty"`
+	// Size es el tamaño del contenido y StoredSize el que ocupa en el NFS,
+	// comprimido y cifrado (0 en archivos guardados antes de registrarlo)
+	Size       int64     `json:"size"`
+	StoredSize int64     `json:"stored_size,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+	TrashedAt  time.Time `json:"trashed_at"`
+}
+
+// Estados del análisis de malware de un archivo
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanFailed   = "failed"
+)
+
+// Processing registra las etapas de procesamiento de una subida. UploadID
+// distingue las subidas sucesivas de un mismo archivo, para que un trabajo
+// asíncrono atrasado no modifique el registro de una subida posterior.
+type Processing struct {
+	UploadID string       `json:"upload_id"`
+	Stages   []StageState `json:"stages"`
+}
+
+// StageState es el estado de una etapa del pipeline.
+type StageState struct {
+	Name      string    `json:"name"`
+	Async     bool      `json:"async,omitempty"`
+	Status    string    `json:"status"`
+	Attempts  int       `json:"attempts,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Estados de una etapa del pipeline
+const (
+	StagePending = "pending"
+	StageDone    = "done"
+	StageFailed  = "failed"
+	StageSkipped = "skipped"
+)
+
+// Stage retorna el estado de la etapa con ese nombre, o nil si el pipeline
+// no la incluye.
+func (p *Processing) Stage(name string) *StageState {
+	if p == nil {
+		return nil
+	}
+	for i := range p.Stages {
+		if p.Stages[i].Name == name {
+			return &p.Stages[i]
+		}
+	}
+	return nil
+}
+
+// Folder es una carpeta del árbol virtual de un propietario.
+type Folder struct {
+	OwnerID    string    `json:"owner_id"`
+	FolderID   string    `json:"folder_id"`
+	Name       string    `json:"name"`
+	ParentID   string    `json:"parent_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+	TrashedAt  time.Time `json:"trashed_at"`
+}
+
+func (f *File) Trashed() bool   { return !f.TrashedAt.IsZero() }
+func (f *Folder) Trashed() bool { return !f.TrashedAt.IsZero() }
+
+// Ref identifica un archivo o una carpeta. Solo uno de los campos se usa.
+type Ref struct {
+	FileID   string
+	FolderID string
+}
+
+// Item es un archivo o una carpeta resuelto.
+type Item struct {
+	File   *File
+	Folder *Folder
+	// Archivos visibles dentro de la carpeta, solo al moverla a la papelera
+	// o restaurarla
+	Descendants []*File
+}
+
+// validName rechaza nombres vacíos o que rompan la resolución de rutas.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\x00")
+}
+
+// SplitPath separa una ruta como "/reports/2024/q1.pdf" en sus componentes.
+func SplitPath(path string) []string {
+	var parts []string
+	for _, p := range strings.Split(path, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return parts
+}
+
+// tree agrupa las operaciones sobre una transacción.
+type tree struct {
+	files   *bolt.Bucket
+	folders *bolt.Bucket
+	changes *bolt.Bucket
+	events  *bolt.Bucket
+}
+
+func newTree(tx *bolt.Tx) tree {
+	return tree{files: tx.Bucket(filesBucket), folders: tx.Bucket(foldersBucket), changes: tx.Bucket(changesBucket), events: tx.Bucket(eventsBucket)}
+}
+
+func (t tree) file(owner, id string) (*File, error) {
+	return get[File](t.files, key(owner, id))
+}
+
+func (t tree) folder(owner, id string) (*Folder, error) {
+	return get[Folder](t.folders, key(owner, id))
+}
+
+// folderVisible indica si la carpeta existe y ni ella ni sus ancestros están
+// en la papelera.
+func (t tree) folderVisible(owner, id string) (bool, error) {
+	for id != RootID {
+		f, err := t.folder(owner, id)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if f.Trashed() {
+			return false, nil
+		}
+		id = f.ParentID
+	}
+	return true, nil
+}
+
+func (t tree) fileVisible(f *File) (bool, error) {
+	if f.Trashed() {
+		return false, nil
+	}
+	return t.folderVisible(f.OwnerID, f.FolderID)
+}
+
+// children retorna las carpetas y archivos directos de parent, sin los que
+// están en la papelera.
+func (t tree) children(owner, parent string) ([]*Folder, []*File, error) {
+	var folders []*Folder
+	var files []*File
+	err := each(t.folders, owner, func(f *Folder) error {
+		if f.ParentID == parent && !f.Trashed() {
+			folders = append(folders, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	err = each(t.files, owner, func(f *File) error {
+		if f.FolderID == parent && !f.Trashed() {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return folders, files, err
+}
+
+// descendants retorna los archivos visibles dentro de la carpeta folder y de
+// sus subcarpetas visibles.
+func (t tree) descendants(owner, folder string) ([]*File, error) {
+	var result []*File
+	pending := []string{folder}
+	for len(pending) > 0 {
+		folders, files, err := t.children(owner, pending[0])
+		if err != nil {
+			return nil, err
+		}
+		pending = pending[1:]
+		result = append(result, files...)
+		for _, f := range folders {
+			pending = append(pending, f.FolderID)
+		}
+	}
+	return result, nil
+}
+
+// checkName falla con ErrExists si ya hay un elemento visible con ese nombre
+// en parent, ignorando el propio elemento self.
+func (t tree) checkName(owner, parent, name string, self Ref) error {
+	if !validName(name) {
+		return ErrInvalidName
+	}
+	folders, files, err := t.children(owner, parent)
+	if err != nil {
+		return err
+	}
+	for _, f := range folders {
+		if f.Name == name && f.FolderID != self.FolderID {
+			return ErrExists
+		}
+	}
+	for _, f := range files {
+		if f.Name == name && f.FileID != self.FileID {
+			return ErrExists
+		}
+	}
+	return nil
+}
+
+// requireFolder comprueba que la carpeta destino exista y sea visible.
+func (t tree) requireFolder(owner, id string) error {
+	ok, err := t.folderVisible(owner, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// resolve recorre la ruta desde la raíz del propietario.
+func (t tree) resolve(owner, path string) (Item, error) {
+	parts := SplitPath(path)
+	if len(parts) == 0 {
+		return Item{Folder: &Folder{OwnerID: owner, FolderID: RootID, Name: "/"}}, nil
+	}
+
+	parent := RootID
+	for i, name := range parts {
+		folders, files, err := t.children(owner, parent)
+		if err != nil {
+			return Item{}, err
+		}
+		var next *Folder
+		for _, f := range folders {
+			if f.Name == name {
+				next = f
+				break
+			}
+		}
+		if next != nil {
+			if i == len(parts)-1 {
+				return Item{Folder: next}, nil
+			}
+			parent = next.FolderID
+			continue
+		}
+		if i == len(parts)-1 {
+			for _, f := range files {
+				if f.Name == name {
+					return Item{File: f}, nil
+				}
+			}
+		}
+		return Item{}, ErrNotFound
+	}
+	return Item{}, ErrNotFound
+}
+
+// folderPath construye la ruta absoluta de una carpeta.
+func (t tree) folderPath(owner, id string) (string, error) {
+	var parts []string
+	for id != RootID {
+		f, err := t.folder(owner, id)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, f.Name)
+		id = f.ParentID
+	}
+	var b strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		b.WriteString("/")
+		b.WriteString(parts[i])
+	}
+	if b.Len() == 0 {
+		return "/", nil
+	}
+	return b.String(), nil
+}
+
+// isDescendant indica si folder es candidate o está dentro de candidate.
+func (t tree) isDescendant(owner, folder, candidate string) (bool, error) {
+	for folder != RootID {
+		if folder == candidate {
+			return true, nil
+		}
+		f, err := t.folder(owner, folder)
+		if err != nil {
+			return false, err
+		}
+		folder = f.ParentID
+	}
+	return candidate == RootID, nil
+}
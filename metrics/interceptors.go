@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"path"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Mensajes que llevan contenido de archivo o un propietario. Se detectan por
+// sus getters para no depender de cada tipo generado.
+type (
+	uploadChunk   interface{ GetBinaryFile() []byte }
+	downloadChunk interface{ GetBinaryFileResponse() []byte }
+	ownedMessage  interface{ GetOwnerId() string }
+)
+
+// UnaryServerInterceptor cuenta peticiones, códigos de estado y latencia.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		observeRPC(path.Base(info.FullMethod), start, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor además cuenta los streams activos y los bytes de
+// archivo enviados y recibidos.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		method := path.Base(info.FullMethod)
+		start := time.Now()
+
+		activeStreams.WithLabelValues(method).Inc()
+		defer activeStreams.WithLabelValues(method).Dec()
+
+		ms := &meteredStream{ServerStream: ss, method: method}
+		err := handler(srv, ms)
+		// Otros streams también reciben contenido (ExtractArchive,
+		// ImportOwner), pero no es una subida de archivo
+		if err == nil && ms.received > 0 && info.FullMethod == pb.FileService_Upload_FullMethodName {
+			ObserveUploadSize(ms.received)
+		}
+		observeRPC(method, start, err)
+		return err
+	}
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	rpcRequests.WithLabelValues(method, status.Code(err).String()).Inc()
+	rpcDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+type meteredStream struct {
+	grpc.ServerStream
+	method   string
+	owner    string
+	received int64
+}
+
+func (s *meteredStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if o, ok := m.(ownedMessage); ok && s.owner == "" {
+		s.owner = o.GetOwnerId()
+	}
+	if c, ok := m.(uploadChunk); ok {
+		n := len(c.GetBinaryFile())
+		s.received += int64(n)
+		addTransferBytes(s.method, "upload", s.owner, n)
+	}
+	return nil
+}
+
+func (s *meteredStream) SendMsg(m any) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	if c, ok := m.(downloadChunk); ok {
+		addTransferBytes(s.method, "download", s.owner, len(c.GetBinaryFileResponse()))
+	}
+	return nil
+}
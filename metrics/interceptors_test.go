@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"path"
+	"testing"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// chunkStream entrega un solo mensaje a RecvMsg.
+type chunkStream struct {
+	grpc.ServerStream
+	msg proto.Message
+}
+
+func (s *chunkStream) RecvMsg(m any) error {
+	proto.Merge(m.(proto.Message), s.msg)
+	return nil
+}
+
+// uploadSizeCount retorna cuántas subidas registró upload_size_bytes.
+func uploadSizeCount(t *testing.T) uint64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == namespace+"_upload_size_bytes" {
+			return f.GetMetric()[0].GetHistogram().GetSampleCount()
+		}
+	}
+	t.Fatal("upload_size_bytes not registered")
+	return 0
+}
+
+// Solo Upload registra el tamaño de la subida, aunque otros streams reciban
+// contenido.
+func TestUploadSizeOnlyForUpload(t *testing.T) {
+	content := []byte("content")
+	tests := []struct {
+		method string
+		msg    proto.Message
+		want   uint64
+	}{
+		{pb.FileService_Upload_FullMethodName, &pb.FileUploadRequest{BinaryFile: content}, 1},
+		{pb.FileService_ExtractArchive_FullMethodName, &pb.ExtractArchiveRequest{BinaryFile: content}, 0},
+		{pb.FileService_ImportOwner_FullMethodName, &pb.ImportOwnerRequest{BinaryFile: content}, 0},
+	}
+	interceptor := StreamServerInterceptor()
+	for _, tt := range tests {
+		t.Run(path.Base(tt.method), func(t *testing.T) {
+			before := uploadSizeCount(t)
+			handler := func(srv any, ss grpc.ServerStream) error {
+				return ss.RecvMsg(tt.msg.ProtoReflect().New().Interface())
+			}
+			info := &grpc.StreamServerInfo{FullMethod: tt.method, IsClientStream: true}
+			if err := interceptor(nil, &chunkStream{msg: tt.msg}, info, handler); err != nil {
+				t.Fatal(err)
+			}
+			if got := uploadSizeCount(t) - before; got != tt.want {
+				t.Errorf("upload sizes observed = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+// Package metrics expone métricas Prometheus del servidor de archivos.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "fileserver"
+
+// Etiqueta usada para los propietarios que superan el límite de cardinalidad
+const otherOwner = "__other__"
+
+var (
+	// Registry contiene todas las métricas del servidor
+	Registry = prometheus.NewRegistry()
+
+	rpcRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_requests_total",
+		Help:      "Total RPCs handled, by method and gRPC status code.",
+	}, []string{"method", "code"})
+
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_duration_seconds",
+		Help:      "RPC latency in seconds, by method.",
+		Buckets:   []float64{.005, .01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"method"})
+
+	transferBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transfer_bytes_total",
+		Help:      "File bytes transferred, by method and direction (upload or download).",
+	}, []string{"method", "direction"})
+
+	activeStreams = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Streaming RPCs currently in progress, by method.",
+	}, []string{"method"})
+
+	uploadSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Size of completed uploads in bytes.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 11), // 1 KiB .. 1 GiB
+	})
+
+	storageErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storage_errors_total",
+		Help:      "Storage operation failures, by kind.",
+	}, []string{"kind"})
+
+	storageBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "storage_bytes",
+		Help:      "Sampled size of the storage root filesystem, by state (total, free or used).",
+	}, []string{"state"})
+
+	scans = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "malware_scans_total",
+		Help:      "Malware scans of uploaded files, by result (clean, infected or error).",
+	}, []string{"result"})
+
+	pipelineStages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pipeline_stages_total",
+		Help:      "Upload processing stage executions, by stage and result (done, skipped, retry or failed).",
+	}, []string{"stage", "result"})
+
+	webhookDeliveries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts, by result (delivered, retry or failed).",
+	}, []string{"result"})
+
+	extractedEntries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "extracted_entries_total",
+		Help:      "Archive entries processed by ExtractArchive, by result (extracted or failed).",
+	}, []string{"result"})
+
+	messageBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_message_bytes_total",
+		Help:      "Serialized gRPC message bytes before compression, by method, direction (sent or received) and compression.",
+	}, []string{"method", "direction", "compression"})
+
+	wireBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grpc_wire_bytes_total",
+		Help:      "gRPC message bytes on the wire, compressed and with gRPC framing, by method, direction (sent or received) and compression.",
+	}, []string{"method", "direction", "compression"})
+
+	responseCompression = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_compression_total",
+		Help:      "Compression chosen for file download responses, by method and compressor (identity when skipped).",
+	}, []string{"method", "compressor"})
+
+	auditWriteErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "audit_write_errors_total",
+		Help:      "Audit log entries that could not be written.",
+	})
+
+	erasureFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "erasure_deletion_failures_total",
+		Help:      "Failed attempts to delete the stored data of an erased owner. The data stays on disk until an attempt succeeds.",
+	})
+
+	ownerBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "owner_transfer_bytes_total",
+		Help:      "File bytes transferred per owner. Only populated when owner metrics are enabled.",
+	}, []string{"owner", "direction"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		rpcRequests,
+		rpcDuration,
+		transferBytes,
+		activeStreams,
+		uploadSize,
+		storageErrors,
+		storageBytes,
+		scans,
+		pipelineStages,
+		webhookDeliveries,
+		extractedEntries,
+		messageBytes,
+		wireBytes,
+		responseCompression,
+		auditWriteErrors,
+		erasureFailures,
+		ownerBytes,
+	)
+}
+
+// Handler sirve las métricas en formato Prometheus.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Tipos de error de almacenamiento
+const (
+	StorageErrMkdir    = "mkdir"
+	StorageErrCreate   = "create"
+	StorageErrWrite    = "write"
+	StorageErrSync     = "sync"
+	StorageErrRename   = "rename"
+	StorageErrNotFound = "not_found"
+	StorageErrOpen     = "open"
+	StorageErrRead     = "read"
+	StorageErrStat     = "stat"
+	StorageErrRemove   = "remove"
+)
+
+// StorageError cuenta un fallo de almacenamiento del tipo indicado.
+func StorageError(kind string) {
+	storageErrors.WithLabelValues(kind).Inc()
+}
+
+// Resultados del análisis de malware
+const (
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanError    = "error"
+)
+
+// ObserveScan cuenta un análisis de malware con el resultado indicado.
+func ObserveScan(result string) {
+	scans.WithLabelValues(result).Inc()
+}
+
+// Resultados de una etapa del pipeline de procesamiento
+const (
+	StageDone    = "done"
+	StageSkipped = "skipped"
+	StageRetry   = "retry"
+	StageFailed  = "failed"
+)
+
+// ObservePipelineStage cuenta una ejecución de una etapa del pipeline.
+func ObservePipelineStage(stage, result string) {
+	pipelineStages.WithLabelValues(stage, result).Inc()
+}
+
+// Resultados de un intento de entrega de un webhook
+const (
+	WebhookDelivered = "delivered"
+	WebhookRetry     = "retry"
+	WebhookFailed    = "failed"
+)
+
+// ObserveWebhookDelivery cuenta un intento de entrega de un webhook.
+func ObserveWebhookDelivery(result string) {
+	webhookDeliveries.WithLabelValues(result).Inc()
+}
+
+// Resultados de una entrada de ExtractArchive
+const (
+	ExtractDone   = "extracted"
+	ExtractFailed = "failed"
+)
+
+// ObserveExtractedEntry cuenta una entrada de un archivo comprimido extraído.
+func ObserveExtractedEntry(result string) {
+	extractedEntries.WithLabelValues(result).Inc()
+}
+
+// AuditWriteError cuenta una entrada de auditoría que no se pudo escribir.
+func AuditWriteError() {
+	auditWriteErrors.Inc()
+}
+
+// ErasureDeletionFailed cuenta un intento fallido de eliminar el contenido de
+// un propietario borrado.
+func ErasureDeletionFailed() {
+	erasureFailures.Inc()
+}
+
+// ObserveResponseCompression cuenta la compresión elegida para la respuesta
+// de una descarga.
+func ObserveResponseCompression(method, compressor string) {
+	responseCompression.WithLabelValues(method, compressor).Inc()
+}
+
+// AddDownloadBytes cuenta bytes descargados fuera de gRPC, por ejemplo por
+// HTTP.
+func AddDownloadBytes(method, owner string, n int64) {
+	addTransferBytes(method, "download", owner, int(n))
+}
+
+// ObserveUploadSize registra el tamaño de una subida completada.
+func ObserveUploadSize(bytes int64) {
+	uploadSize.Observe(float64(bytes))
+}
+
+// SetStorageUsage publica el último muestreo de espacio de la raíz de almacenamiento.
+func SetStorageUsage(total, free, used uint64) {
+	storageBytes.WithLabelValues("total").Set(float64(total))
+	storageBytes.WithLabelValues("free").Set(float64(free))
+	storageBytes.WithLabelValues("used").Set(float64(used))
+}
+
+// owners limita cuántos propietarios distintos aparecen como etiqueta. Una
+// vez alcanzado el límite, el resto se agrupa bajo otherOwner.
+var owners = struct {
+	mu      sync.Mutex
+	enabled bool
+	max     int
+	seen    map[string]struct{}
+}{seen: make(map[string]struct{})}
+
+// EnableOwnerMetrics activa los contadores por propietario con un máximo de
+// maxOwners etiquetas distintas.
+func EnableOwnerMetrics(maxOwners int) {
+	owners.mu.Lock()
+	defer owners.mu.Unlock()
+	owners.enabled = true
+	owners.max = maxOwners
+}
+
+func ownerLabel(owner string) (string, bool) {
+	owners.mu.Lock()
+	defer owners.mu.Unlock()
+	if !owners.enabled || owner == "" {
+		return "", false
+	}
+	if _, ok := owners.seen[owner]; ok {
+		return owner, true
+	}
+	if len(owners.seen) >= owners.max {
+		return otherOwner, true
+	}
+	owners.seen[owner] = struct{}{}
+	return owner, true
+}
+
+func addTransferBytes(method, direction, owner string, n int) {
+	if n == 0 {
+		return
+	}
+	transferBytes.WithLabelValues(method, direction).Add(float64(n))
+	if label, ok := ownerLabel(owner); ok {
+		ownerBytes.WithLabelValues(label, direction).Add(float64(n))
+	}
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// UsageFunc retorna el espacio total, libre y usado de la raíz de almacenamiento.
+type UsageFunc func() (total, free, used uint64, err error)
+
+// SampleStorage muestrea periódicamente el espacio de almacenamiento hasta que
+// se cancele el contexto.
+func SampleStorage(ctx context.Context, interval time.Duration, usage UsageFunc) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		total, free, used, err := usage()
+		if err != nil {
+			slog.Warn("Failed to sample storage usage", "error", err)
+			StorageError(StorageErrStat)
+		} else {
+			SetStorageUsage(total, free, used)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"context"
+	"path"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/stats"
+)
+
+// StatsHandler cuenta los bytes de los mensajes gRPC antes de comprimirlos y
+// los que ocupan en la conexión, para comparar cuánto ahorra la compresión.
+// Se instala con grpc.StatsHandler.
+func StatsHandler() stats.Handler {
+	return wireStats{}
+}
+
+type wireStats struct{}
+
+type wireKey struct{}
+
+// rpcWire es el estado de un RPC. La compresión de cada sentido se conoce
+// con su encabezado, que puede llegar desde otra goroutine que los mensajes.
+type rpcWire struct {
+	method  string
+	in, out atomic.Value
+}
+
+func (wireStats) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	// Solo los servicios propios, no health ni reflexión
+	if !strings.HasPrefix(info.FullMethodName, "/proto.") {
+		return ctx
+	}
+	return context.WithValue(ctx, wireKey{}, &rpcWire{method: path.Base(info.FullMethodName)})
+}
+
+func (wireStats) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	w, ok := ctx.Value(wireKey{}).(*rpcWire)
+	if !ok {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.InHeader:
+		w.in.Store(s.Compression)
+	case *stats.OutHeader:
+		w.out.Store(s.Compression)
+	case *stats.InPayload:
+		addWireBytes(w.method, "received", &w.in, s.Length, s.WireLength)
+	case *stats.OutPayload:
+		addWireBytes(w.method, "sent", &w.out, s.Length, s.WireLength)
+	}
+}
+
+func addWireBytes(method, direction string, compression *atomic.Value, length, wire int) {
+	name, _ := compression.Load().(string)
+	if name == "" {
+		name = encoding.Identity
+	}
+	messageBytes.WithLabelValues(method, direction, name).Add(float64(length))
+	wireBytes.WithLabelValues(method, direction, name).Add(float64(wire))
+}
+
+func (wireStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (wireStats) HandleConn(context.Context, stats.ConnStats) {}
@@ -0,0 +1,333 @@
+// Package queue implementa una cola de trabajos local y durable sobre bbolt.
+// Los trabajos sobreviven a reinicios y los que fallan se reintentan con una
+// espera exponencial hasta agotar los intentos.
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrNotFound indica que el trabajo no existe.
+var ErrNotFound = errors.New("job not found")
+
+var (
+	jobsBucket = []byte("jobs")
+	// Trabajos que agotaron sus intentos, para inspeccionarlos
+	deadBucket = []byte("dead")
+)
+
+// Job es un trabajo guardado en la cola.
+type Job struct {
+	ID      uint64          `json:"id"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts es la cantidad de intentos fallidos hasta ahora
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Handler procesa un trabajo. last indica que es el último intento: si
+// falla, el trabajo se descarta.
+type Handler func(ctx context.Context, job Job, last bool) error
+
+// Options configura los reintentos.
+type Options struct {
+	MaxAttempts int
+	// Espera antes del primer reintento; se duplica en cada uno hasta MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultOptions reintenta durante unos diez minutos.
+var DefaultOptions = Options{
+	MaxAttempts: 8,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    5 * time.Minute,
+}
+
+// Queue es una cola durable. Se puede usar desde varias goroutines.
+type Queue struct {
+	db   *bolt.DB
+	opts Options
+	wake chan struct{}
+
+	mu sync.Mutex
+	// Trabajos que algún worker está procesando
+	running map[uint64]bool
+}
+
+// Open abre (o crea) la cola en path.
+func Open(path string, opts Options) (*Queue, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job queue: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{jobsBucket, deadBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize job queue: %w", err)
+	}
+	return &Queue{
+		db:      db,
+		opts:    opts,
+		wake:    make(chan struct{}, 1),
+		running: make(map[uint64]bool),
+	}, nil
+}
+
+// Close cierra la base de datos. Los workers deben haber terminado.
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// Enqueue guarda un trabajo con el payload serializado en JSON.
+func (q *Queue) Enqueue(payload any) (uint64, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode job: %w", err)
+	}
+	var id uint64
+	err = q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(jobsBucket)
+		id, _ = b.NextSequence()
+		now := time.Now().UTC()
+		return putJob(b, &Job{ID: id, Payload: data, NotBefore: now, CreatedAt: now})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue job: %w", err)
+	}
+	q.notify()
+	return id, nil
+}
+
+// Run reparte los trabajos pendientes entre la cantidad de workers indicada
+// hasta que se cancele el contexto. Retorna cuando todos los workers
+// terminaron; los trabajos interrumpidos se retoman en el próximo Run.
+func (q *Queue) Run(ctx context.Context, workers int, handle Handler) {
+	jobs := make(chan Job)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				q.process(ctx, job, handle)
+			}
+		}()
+	}
+	defer wg.Wait()
+	defer close(jobs)
+
+	for {
+		job, wait, err := q.next()
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read job queue", "error", err)
+			wait = time.Second
+		}
+		if job != nil {
+			select {
+			case jobs <- *job:
+				continue
+			case <-ctx.Done():
+				q.release(job.ID)
+				return
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// Espera máxima entre revisiones de la cola si no hay trabajos agendados
+const idleWait = time.Minute
+
+// next reserva el primer trabajo listo para ejecutarse. Si no hay ninguno,
+// retorna cuánto esperar hasta el próximo.
+func (q *Queue) next() (*Job, time.Duration, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var found *Job
+	wait := idleWait
+	now := time.Now()
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			if found != nil {
+				return nil
+			}
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to decode job %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			if q.running[job.ID] {
+				return nil
+			}
+			if d := job.NotBefore.Sub(now); d > 0 {
+				wait = min(wait, d)
+				return nil
+			}
+			found = &job
+			return nil
+		})
+	})
+	if err != nil || found == nil {
+		return nil, wait, err
+	}
+	q.running[found.ID] = true
+	return found, 0, nil
+}
+
+func (q *Queue) release(id uint64) {
+	q.mu.Lock()
+	delete(q.running, id)
+	q.mu.Unlock()
+}
+
+// process ejecuta un trabajo y registra el resultado: lo elimina si terminó,
+// agenda un reintento si falló o lo descarta si agotó los intentos.
+func (q *Queue) process(ctx context.Context, job Job, handle Handler) {
+	// Run calculó su espera sin este trabajo, que estaba en ejecución: hay
+	// que despertarlo para que tenga en cuenta el reintento agendado
+	defer q.notify()
+	defer q.release(job.ID)
+	last := job.Attempts+1 >= q.opts.MaxAttempts
+	err := handle(ctx, job, last)
+	if err != nil && ctx.Err() != nil {
+		// Interrumpido por el apagado: no cuenta como intento
+		return
+	}
+
+	dbErr := q.db.Update(func(tx *bolt.Tx) error {
+		jobs := tx.Bucket(jobsBucket)
+		if err == nil {
+			return jobs.Delete(jobKey(job.ID))
+		}
+		job.Attempts++
+		job.LastError = err.Error()
+		if last {
+			if err := jobs.Delete(jobKey(job.ID)); err != nil {
+				return err
+			}
+			return putJob(tx.Bucket(deadBucket), &job)
+		}
+		job.NotBefore = time.Now().UTC().Add(q.backoff(job.Attempts))
+		return putJob(jobs, &job)
+	})
+	if dbErr != nil {
+		slog.ErrorContext(ctx, "Failed to update job queue", "job_id", job.ID, "error", dbErr)
+	}
+	switch {
+	case err == nil:
+	case last:
+		slog.ErrorContext(ctx, "Job failed, giving up", "job_id", job.ID, "attempts", job.Attempts, "error", err)
+	default:
+		slog.WarnContext(ctx, "Job failed, will retry", "job_id", job.ID, "attempts", job.Attempts, "retry_at", job.NotBefore, "error", err)
+	}
+}
+
+// backoff duplica la espera en cada intento, sin pasar de MaxDelay.
+func (q *Queue) backoff(attempts int) time.Duration {
+	delay := q.opts.BaseDelay
+	for i := 1; i < attempts && delay < q.opts.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, q.opts.MaxDelay)
+}
+
+func jobKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+func putJob(b *bolt.Bucket, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return b.Put(jobKey(job.ID), data)
+}
+
+// List retorna hasta limit trabajos (0 = todos), pendientes o, si dead es
+// true, descartados por agotar sus intentos.
+func (q *Queue) List(dead bool, limit int) ([]Job, error) {
+	bucket := jobsBucket
+	if dead {
+		bucket = deadBucket
+	}
+	var jobs []Job
+	err := q.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.First(); k != nil && (limit == 0 || len(jobs) < limit); k, v = c.Next() {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("failed to decode job %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// Retry vuelve a agendar un trabajo descartado, con los intentos en cero.
+func (q *Queue) Retry(id uint64) error {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		dead := tx.Bucket(deadBucket)
+		data := dead.Get(jobKey(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return fmt.Errorf("failed to decode job %d: %w", id, err)
+		}
+		if err := dead.Delete(jobKey(id)); err != nil {
+			return err
+		}
+		job.Attempts = 0
+		job.NotBefore = time.Now().UTC()
+		return putJob(tx.Bucket(jobsBucket), &job)
+	})
+	if err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// notify despierta a Run para que revise la cola.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,179 @@
+package scan
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Tamaño de los bloques enviados con INSTREAM. clamd rechaza el flujo si el
+// total supera su StreamMaxLength.
+const clamdChunkSize = 64 << 10
+
+// ErrScanFailed indica que clamd respondió con un error en vez de un veredicto.
+var ErrScanFailed = errors.New("clamd scan failed")
+
+// Clamd es un cliente del protocolo de clamd (ClamAV) sobre TCP o un socket
+// Unix. Cada análisis abre su propia conexión.
+type Clamd struct {
+	network string
+	address string
+	// Timeout limita cada análisis si el contexto no tiene plazo
+	Timeout time.Duration
+}
+
+// NewClamd crea un cliente para addr, que puede ser "tcp://host:puerto",
+// "unix:///ruta/clamd.sock" o simplemente "host:puerto".
+func NewClamd(addr string, timeout time.Duration) (*Clamd, error) {
+	network, address := "tcp", addr
+	if scheme, rest, ok := strings.Cut(addr, "://"); ok {
+		network, address = scheme, rest
+	}
+	if network != "tcp" && network != "unix" {
+		return nil, fmt.Errorf("unsupported clamd network %q", network)
+	}
+	if address == "" {
+		return nil, fmt.Errorf("missing clamd address")
+	}
+	return &Clamd{network: network, address: address, Timeout: timeout}, nil
+}
+
+// Scan envía el contenido con el comando INSTREAM y retorna el veredicto.
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return Result{}, fmt.Errorf("failed to send clamd command: %w", err)
+	}
+	if err := sendStream(conn, r); err != nil {
+		// clamd cierra la conexión si el flujo supera su límite; en ese caso
+		// su respuesta explica el motivo mejor que el error de escritura
+		if reply, replyErr := readReply(conn); replyErr == nil {
+			if _, parseErr := parseScanReply(reply); parseErr != nil {
+				return Result{}, parseErr
+			}
+		}
+		return Result{}, err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return Result{}, err
+	}
+	return parseScanReply(reply)
+}
+
+// Ping comprueba que clamd responda. Sirve como chequeo de salud.
+func (c *Clamd) Ping(ctx context.Context) error {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("zPING\x00")); err != nil {
+		return fmt.Errorf("failed to send clamd command: %w", err)
+	}
+	reply, err := readReply(conn)
+	if err != nil {
+		return err
+	}
+	if reply != "PONG" {
+		return fmt.Errorf("unexpected clamd reply %q", reply)
+	}
+	return nil
+}
+
+// withTimeout aplica Timeout si el contexto no tiene plazo.
+func (c *Clamd) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		return context.WithTimeout(ctx, c.Timeout)
+	}
+	return ctx, func() {}
+}
+
+// dial abre una conexión cuyo plazo sigue al del contexto. Cancelar el
+// contexto cierra la conexión.
+func (c *Clamd) dial(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to clamd: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	return &ctxConn{Conn: conn, stop: context.AfterFunc(ctx, func() { conn.Close() })}, nil
+}
+
+// ctxConn deja de vigilar el contexto al cerrarse la conexión.
+type ctxConn struct {
+	net.Conn
+	stop func() bool
+}
+
+func (c *ctxConn) Close() error {
+	c.stop()
+	return c.Conn.Close()
+}
+
+// sendStream envía el contenido en bloques precedidos por su longitud y
+// termina con un bloque de longitud cero.
+func sendStream(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := w.Write(buf[:4+n]); werr != nil {
+				return fmt.Errorf("failed to send data to clamd: %w", werr)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read file to scan: %w", err)
+		}
+	}
+	if _, err := w.Write([]byte{0, 0, 0, 0}); err != nil {
+		return fmt.Errorf("failed to send data to clamd: %w", err)
+	}
+	return nil
+}
+
+// readReply lee una respuesta terminada en NUL (comandos con prefijo "z").
+func readReply(r io.Reader) (string, error) {
+	reply, err := bufio.NewReader(io.LimitReader(r, 4096)).ReadBytes(0)
+	if err != nil && len(reply) == 0 {
+		return "", fmt.Errorf("failed to read clamd reply: %w", err)
+	}
+	return strings.TrimSpace(string(bytes.TrimSuffix(reply, []byte{0}))), nil
+}
+
+// parseScanReply interpreta "stream: OK", "stream: <firma> FOUND" o
+// "<mensaje> ERROR".
+func parseScanReply(reply string) (Result, error) {
+	_, verdict, _ := strings.Cut(reply, ": ")
+	switch {
+	case verdict == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(verdict, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(verdict, " FOUND")}, nil
+	}
+	return Result{}, fmt.Errorf("%w: %s", ErrScanFailed, reply)
+}
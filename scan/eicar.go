@@ -0,0 +1,44 @@
+package scan
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// eicarSignature es el archivo de prueba estándar EICAR. No es malware, pero
+// todos los antivirus lo detectan.
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// EICARName es el nombre con el que ClamAV reporta la firma de prueba.
+const EICARName = "Eicar-Test-Signature"
+
+// EICAR detecta solo la firma de prueba EICAR. Sirve para probar el flujo de
+// cuarentena sin un antivirus real.
+type EICAR struct{}
+
+func (EICAR) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	sig := []byte(eicarSignature)
+	buf := make([]byte, 32<<10)
+	// Se conserva el final del bloque anterior por si la firma queda partida
+	var carry []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			window := append(carry, buf[:n]...)
+			if bytes.Contains(window, sig) {
+				return Result{Infected: true, Signature: EICARName}, nil
+			}
+			carry = append(carry[:0], window[max(0, len(window)-len(sig)+1):]...)
+		}
+		if err == io.EOF {
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package scan analiza los archivos subidos en busca de malware antes de que
+// se puedan descargar.
+package scan
+
+import (
+	"context"
+	"io"
+)
+
+// Result es el veredicto de un análisis.
+type Result struct {
+	Infected bool
+	// Signature es el nombre de la amenaza detectada
+	Signature string
+}
+
+// Scanner analiza el contenido de un archivo. Un error indica que no se
+// pudo completar el análisis, no que el archivo esté infectado.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
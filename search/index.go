@@ -0,0 +1,173 @@
+// Package search mantiene un índice invertido embebido del contenido de los
+// archivos de texto para la búsqueda de texto completo.
+package search
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	postingsBucket = []byte("postings")
+	docsBucket     = []byte("docs")
+)
+
+// Index es el índice de texto completo. Las entradas se guardan como
+// "<término>\x00<owner>\x00<file_id>" -> frecuencia, y por cada documento se
+// guarda su lista de términos para poder borrarlo.
+type Index struct {
+	db *bolt.DB
+}
+
+// Open abre (o crea) el índice en path.
+func Open(path string) (*Index, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create index directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open search index: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{postingsBucket, docsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize search index: %w", err)
+	}
+	return &Index{db: db}, nil
+}
+
+func (ix *Index) Close() error {
+	return ix.db.Close()
+}
+
+func docKey(owner, fileID string) []byte {
+	return []byte(owner + "\x00" + fileID)
+}
+
+func postingKey(term, owner, fileID string) []byte {
+	return []byte(term + "\x00" + owner + "\x00" + fileID)
+}
+
+// Put reemplaza los términos indexados de un archivo.
+func (ix *Index) Put(owner, fileID, text string) error {
+	freqs := termFrequencies(text)
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		if err := removeDoc(tx, owner, fileID); err != nil {
+			return err
+		}
+		if len(freqs) == 0 {
+			return nil
+		}
+
+		postings := tx.Bucket(postingsBucket)
+		terms := make([]string, 0, len(freqs))
+		for term, n := range freqs {
+			var v [4]byte
+			binary.BigEndian.PutUint32(v[:], uint32(n))
+			if err := postings.Put(postingKey(term, owner, fileID), v[:]); err != nil {
+				return err
+			}
+			terms = append(terms, term)
+		}
+		data, err := json.Marshal(terms)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(docsBucket).Put(docKey(owner, fileID), data)
+	})
+}
+
+// Remove borra un archivo del índice.
+func (ix *Index) Remove(owner, fileID string) error {
+	return ix.db.Update(func(tx *bolt.Tx) error {
+		return removeDoc(tx, owner, fileID)
+	})
+}
+
+// RemoveOwner borra del índice todos los archivos del propietario y retorna
+// cuántos borró.
+func (ix *Index) RemoveOwner(owner string) (int, error) {
+	removed := 0
+	err := ix.db.Update(func(tx *bolt.Tx) error {
+		prefix := []byte(owner + "\x00")
+		var fileIDs []string
+		c := tx.Bucket(docsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			fileIDs = append(fileIDs, string(k[len(prefix):]))
+		}
+		for _, id := range fileIDs {
+			if err := removeDoc(tx, owner, id); err != nil {
+				return err
+			}
+		}
+		removed = len(fileIDs)
+		return nil
+	})
+	return removed, err
+}
+
+func removeDoc(tx *bolt.Tx, owner, fileID string) error {
+	docs := tx.Bucket(docsBucket)
+	data := docs.Get(docKey(owner, fileID))
+	if data == nil {
+		return nil
+	}
+	var terms []string
+	if err := json.Unmarshal(data, &terms); err != nil {
+		return fmt.Errorf("corrupt index document: %w", err)
+	}
+	postings := tx.Bucket(postingsBucket)
+	for _, term := range terms {
+		if err := postings.Delete(postingKey(term, owner, fileID)); err != nil {
+			return err
+		}
+	}
+	return docs.Delete(docKey(owner, fileID))
+}
+
+// Match retorna los archivos del propietario que contienen todos los términos
+// de la consulta, con un puntaje igual a la suma de sus frecuencias.
+func (ix *Index) Match(owner, query string) (map[string]float64, error) {
+	terms := Tokenize(query)
+	if len(terms) == 0 {
+		return map[string]float64{}, nil
+	}
+
+	var scores map[string]float64
+	err := ix.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(postingsBucket).Cursor()
+		for i, term := range terms {
+			prefix := []byte(term + "\x00" + owner + "\x00")
+			found := make(map[string]float64)
+			for k, v := c.Seek(prefix); k != nil && len(k) >= len(prefix) && string(k[:len(prefix)]) == string(prefix); k, v = c.Next() {
+				fileID := string(k[len(prefix):])
+				if i > 0 {
+					if _, ok := scores[fileID]; !ok {
+						continue
+					}
+				}
+				found[fileID] = scores[fileID] + float64(binary.BigEndian.Uint32(v))
+			}
+			scores = found
+			if len(scores) == 0 {
+				break
+			}
+		}
+		return nil
+	})
+	return scores, err
+}
@@ -0,0 +1,89 @@
+package search
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// NameMode indica cómo se compara la consulta con el nombre del archivo.
+type NameMode int
+
+const (
+	// NameAny prueba exacto, prefijo, subcadena y aproximado, en ese orden
+	NameAny NameMode = iota
+	NamePrefix
+	NameSubstring
+	NameFuzzy
+)
+
+// Puntajes de cada tipo de coincidencia de nombre
+const (
+	scoreExact     = 100
+	scorePrefix    = 80
+	scoreSubstring = 60
+	scoreFuzzy     = 40
+)
+
+// MatchName compara la consulta con el nombre sin distinguir mayúsculas.
+// La coincidencia aproximada acepta una distancia de edición de hasta un
+// cuarto del largo de la consulta contra el nombre o cualquiera de sus
+// palabras.
+func MatchName(name, query string, mode NameMode) (float64, bool) {
+	name = strings.ToLower(name)
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return 0, true
+	}
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+	if mode == NameAny || mode == NamePrefix {
+		if name == query || stem == query {
+			return scoreExact, true
+		}
+		if strings.HasPrefix(name, query) {
+			return scorePrefix, true
+		}
+	}
+	if mode == NameAny || mode == NameSubstring {
+		if strings.Contains(name, query) {
+			return scoreSubstring, true
+		}
+	}
+	if mode == NameAny || mode == NameFuzzy {
+		maxDist := max(1, utf8.RuneCountInString(query)/4)
+		best := -1
+		candidates := append([]string{name, stem}, Tokenize(stem)...)
+		for _, c := range candidates {
+			if d := levenshtein(c, query); d <= maxDist && (best < 0 || d < best) {
+				best = d
+			}
+		}
+		if best >= 0 {
+			return float64(scoreFuzzy - best*5), true
+		}
+	}
+	return 0, false
+}
+
+// levenshtein calcula la distancia de edición entre a y b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
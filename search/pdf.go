@@ -0,0 +1,79 @@
+package search
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Extracción de texto de PDF en Go puro. Solo cubre el caso común: streams
+// de contenido sin comprimir o con FlateDecode y texto dentro de los
+// operadores Tj/TJ. Fuentes con codificaciones propias no se decodifican.
+
+var (
+	pdfStream = regexp.MustCompile(`(?s)stream\r?\n(.*?)\r?\nendstream`)
+	pdfText   = regexp.MustCompile(`(?s)BT(.*?)ET`)
+)
+
+// Límite de datos descomprimidos por stream, contra bombas de compresión
+const maxPDFStream = 16 << 20
+
+func extractPDFText(data []byte) string {
+	var b strings.Builder
+	for _, m := range pdfStream.FindAllSubmatch(data, -1) {
+		content := m[1]
+		if zr, err := zlib.NewReader(bytes.NewReader(content)); err == nil {
+			if inflated, err := io.ReadAll(io.LimitReader(zr, maxPDFStream)); err == nil || len(inflated) > 0 {
+				content = inflated
+			}
+			zr.Close()
+		}
+		for _, block := range pdfText.FindAllSubmatch(content, -1) {
+			writePDFStrings(&b, block[1])
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// writePDFStrings escribe los literales "(...)" de un bloque de texto,
+// resolviendo los escapes de PDF.
+func writePDFStrings(b *strings.Builder, block []byte) {
+	for i := 0; i < len(block); i++ {
+		if block[i] != '(' {
+			continue
+		}
+		depth := 1
+		for i++; i < len(block) && depth > 0; i++ {
+			c := block[i]
+			switch {
+			case c == '\\' && i+1 < len(block):
+				i++
+				switch block[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r', 't':
+					b.WriteByte(' ')
+				case '(', ')', '\\':
+					b.WriteByte(block[i])
+				default:
+					// Escapes octales y saltos de línea se omiten
+				}
+			case c == '(':
+				depth++
+				b.WriteByte(c)
+			case c == ')':
+				depth--
+				if depth > 0 {
+					b.WriteByte(c)
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		b.WriteByte(' ')
+		i--
+	}
+}
@@ -0,0 +1,78 @@
+package search
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Máximo de bytes de un archivo que se leen para indexar
+const MaxIndexedBytes = 8 << 20
+
+// Largo de los términos que se indexan
+const (
+	minTermLen = 2
+	maxTermLen = 64
+)
+
+// Extensiones de archivos de texto y código fuente que se indexan aunque el
+// tipo detectado no sea text/*.
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".markdown": true, ".csv": true, ".tsv": true, ".log": true,
+	".json": true, ".xml": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true,
+	".html": true, ".htm": true, ".css": true, ".sql": true, ".tex": true, ".rst": true,
+	".go": true, ".py": true, ".java": true, ".js": true, ".ts": true, ".jsx": true, ".tsx": true,
+	".c": true, ".h": true, ".cpp": true, ".hpp": true, ".cc": true, ".cs": true, ".rs": true,
+	".rb": true, ".php": true, ".kt": true, ".swift": true, ".scala": true, ".sh": true,
+	".r": true, ".m": true, ".proto": true,
+}
+
+// Indexable indica si el contenido de un archivo con ese nombre y tipo se
+// puede extraer como texto.
+func Indexable(name, contentType string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return textExtensions[ext] || ext == ".pdf" ||
+		strings.HasPrefix(contentType, "text/") || strings.HasPrefix(contentType, "application/pdf")
+}
+
+// ExtractText lee hasta MaxIndexedBytes del archivo y retorna su texto.
+// Los PDF se procesan con un extractor simple; si no se puede extraer texto
+// se retorna una cadena vacía.
+func ExtractText(r io.Reader, name, contentType string) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxIndexedBytes))
+	if err != nil {
+		return "", err
+	}
+	if strings.EqualFold(filepath.Ext(name), ".pdf") || strings.HasPrefix(contentType, "application/pdf") || bytes.HasPrefix(data, []byte("%PDF-")) {
+		return extractPDFText(data), nil
+	}
+	if !utf8.Valid(data) {
+		data = bytes.ToValidUTF8(data, []byte(" "))
+	}
+	return string(data), nil
+}
+
+// Tokenize separa el texto en términos en minúsculas formados por letras y
+// dígitos.
+func Tokenize(text string) []string {
+	var terms []string
+	for _, field := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if n := utf8.RuneCountInString(field); n >= minTermLen && n <= maxTermLen {
+			terms = append(terms, strings.ToLower(field))
+		}
+	}
+	return terms
+}
+
+func termFrequencies(text string) map[string]int {
+	freqs := make(map[string]int)
+	for _, term := range Tokenize(text) {
+		freqs[term]++
+	}
+	return freqs
+}
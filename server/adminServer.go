@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/audit"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"github.com/Districorp-UPB/FileServer/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AdminService expone operaciones administrativas protegidas por un token.
+type AdminService struct {
+	pb.UnimplementedAdminServiceServer
+
+	// Token que deben enviar los administradores como "authorization: Bearer <token>".
+	// Si está vacío, todas las operaciones se rechazan.
+	Token string
+	Audit *audit.Log
+	// Outbox de webhooks para inspeccionar y reintentar entregas (opcional)
+	Webhooks *webhook.Notifier
+	// Servicio de archivos, para rotar las claves del cifrado en reposo y
+	// borrar propietarios
+	Files *FileService
+}
+
+func (s *AdminService) QueryAudit(ctx context.Context, req *pb.QueryAuditRequest) (*pb.QueryAuditResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := audit.Filter{
+		Principal: req.Principal,
+		OwnerID:   req.OwnerId,
+		FileID:    req.FileId,
+		Action:    req.Action,
+		Limit:     int(req.Limit),
+	}
+	if req.Since != nil {
+		filter.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		filter.Until = req.Until.AsTime()
+	}
+
+	entries, err := s.Audit.Query(filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to query audit log: %v", err)
+	}
+
+	resp := &pb.QueryAuditResponse{Entries: make([]*pb.AuditEntry, 0, len(entries))}
+	for _, e := range entries {
+		resp.Entries = append(resp.Entries, &pb.AuditEntry{
+			Sequence:  e.Sequence,
+			Time:      timestamppb.New(e.Time),
+			Principal: e.Principal,
+			Action:    e.Action,
+			OwnerId:   e.OwnerID,
+			FileId:    e.FileID,
+			Bytes:     e.Bytes,
+			ClientIp:  e.ClientIP,
+			Result:    e.Result,
+			Error:     e.Error,
+			RequestId: e.RequestID,
+			PrevHash:  e.PrevHash,
+			Hash:      e.Hash,
+		})
+	}
+	return resp, nil
+}
+
+// authorize compara el token bearer de la metadata con el configurado.
+func (s *AdminService) authorize(ctx context.Context) error {
+	if s.Token == "" {
+		return status.Error(codes.PermissionDenied, "admin API is disabled")
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return status.Error(codes.Unauthenticated, "missing admin token")
+	}
+	token, ok := strings.CutPrefix(values[0], "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		return status.Error(codes.PermissionDenied, "invalid admin token")
+	}
+	return nil
+}
+
+func (s *AdminService) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if s.Webhooks == nil {
+		return nil, status.Error(codes.FailedPrecondition, "webhooks are not enabled")
+	}
+
+	deliveries, err := s.Webhooks.Deliveries(req.Failed, int(req.Limit))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read webhook outbox: %v", err)
+	}
+	resp := &pb.ListWebhookDeliveriesResponse{Deliveries: make([]*pb.WebhookDelivery, 0, len(deliveries))}
+	for _, d := range deliveries {
+		delivery := &pb.WebhookDelivery{
+			Id:        d.ID,
+			Url:       d.URL,
+			EventId:   d.Event.ID,
+			EventType: d.Event.Type,
+			OwnerId:   d.Event.OwnerID,
+			FileId:    d.Event.FileID,
+			Attempts:  int32(d.Attempts),
+			LastError: d.LastError,
+			CreatedAt: timestamppb.New(d.CreatedAt),
+		}
+		if !req.Failed {
+			delivery.NextAttemptAt = timestamppb.New(d.NextTry)
+		}
+		resp.Deliveries = append(resp.Deliveries, delivery)
+	}
+	return resp, nil
+}
+
+func (s *AdminService) ReplayWebhookDeliveries(ctx context.Context, req *pb.ReplayWebhookDeliveriesRequest) (*pb.ReplayWebhookDeliveriesResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if s.Webhooks == nil {
+		return nil, status.Error(codes.FailedPrecondition, "webhooks are not enabled")
+	}
+
+	ids := req.Ids
+	if req.All {
+		failed, err := s.Webhooks.Deliveries(true, 0)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to read webhook outbox: %v", err)
+		}
+		for _, d := range failed {
+			ids = append(ids, d.ID)
+		}
+	}
+	resp := &pb.ReplayWebhookDeliveriesResponse{}
+	for _, id := range ids {
+		err := s.Webhooks.Replay(id)
+		switch {
+		case errors.Is(err, queue.ErrNotFound):
+			if !req.All {
+				return resp, status.Errorf(codes.NotFound, "no failed webhook delivery with id %d", id)
+			}
+		case err != nil:
+			return resp, status.Errorf(codes.Internal, "failed to replay webhook delivery %d: %v", id, err)
+		default:
+			resp.Replayed++
+		}
+	}
+	return resp, nil
+}
+
+// RotateMasterKey activa una clave maestra nueva y vuelve a envolver las
+// claves de datos de los archivos cifrados con las anteriores.
+func (s *AdminService) RotateMasterKey(ctx context.Context, req *pb.RotateMasterKeyRequest) (*pb.RotateMasterKeyResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if s.Files == nil {
+		return nil, status.Error(codes.FailedPrecondition, "encryption is not enabled")
+	}
+
+	keyID, rewrapped, failed, err := s.Files.RotateKeys(ctx, !req.RewrapOnly)
+	return &pb.RotateMasterKeyResponse{KeyId: keyID, Rewrapped: int32(rewrapped), Failed: int32(failed)}, err
+}
+
+// EraseOwner borra todos los datos de un propietario y retorna el
+// comprobante firmado (ver FileService.EraseOwner).
+func (s *AdminService) EraseOwner(ctx context.Context, req *pb.EraseOwnerRequest) (*pb.EraseOwnerResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	if s.Files == nil {
+		return nil, status.Error(codes.FailedPrecondition, "owner erasure is not enabled")
+	}
+	return s.Files.EraseOwner(ctx, req.OwnerId)
+}
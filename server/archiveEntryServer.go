@@ -0,0 +1,312 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Lectura de las entradas de un zip, tar o tar.gz guardado sin extraerlo.
+// Un zip se abre con acceso aleatorio: se lee el directorio central al final
+// del archivo y después solo los bytes de la entrada pedida. Un tar no tiene
+// índice, así que se recorren los encabezados saltando el contenido; en un
+// tar.gz hay que descomprimir todo lo anterior a la entrada.
+
+// Tipos de ArchiveEntry
+const (
+	entryFile    = "file"
+	entryFolder  = "folder"
+	entrySymlink = "symlink"
+	entryOther   = "other"
+)
+
+// storedArchive es un archivo comprimido guardado en el NFS, abierto para
+// leer sus entradas.
+type storedArchive struct {
+	content *storedContent
+	format  string
+	// Directorio central, solo en zip
+	zip *zip.Reader
+}
+
+// openStoredArchive abre el archivo y detecta su formato por el contenido,
+// no por la extensión.
+func (s *FileService) openStoredArchive(ctx context.Context, f *metadata.File, filePath string) (a *storedArchive, err error) {
+	ctx, span := startStorageSpan(ctx, "open_archive", attrPath.String(filePath))
+	defer func() { endSpan(span, err) }()
+
+	content, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, 512)
+	n, err := content.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		content.Close()
+		metrics.StorageError(metrics.StorageErrRead)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	head = head[:n]
+
+	a = &storedArchive{content: content}
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		a.format = ArchiveTarGz
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		a.format = ArchiveTar
+	default:
+		// El directorio central está al final, así que también se reconocen
+		// los zip con datos antepuestos (por ejemplo, autoextraíbles)
+		a.zip, err = zip.NewReader(content, content.Size())
+		if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+			content.Close()
+			return nil, status.Error(codes.FailedPrecondition, "file is not a zip or tar archive")
+		}
+		a.format = ArchiveZip
+	}
+	return a, nil
+}
+
+func (a *storedArchive) Close() error {
+	return a.content.Close()
+}
+
+// walkTar recorre las entradas de un tar o tar.gz hasta que fn retorne
+// false. El contenido de la entrada actual se puede leer de tr.
+func (a *storedArchive) walkTar(fn func(hdr *tar.Header, tr *tar.Reader) bool) error {
+	// Sobre el archivo sin comprimir, tar.Reader salta el contenido con Seek
+	var r io.Reader = io.NewSectionReader(a.content, 0, a.content.Size())
+	if a.format == ArchiveTarGz {
+		gz, err := gzip.NewReader(bufio.NewReader(r))
+		if err != nil {
+			return status.Errorf(codes.FailedPrecondition, "invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return status.Errorf(codes.FailedPrecondition, "invalid tar archive: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if !fn(hdr, tr) {
+			return nil
+		}
+	}
+}
+
+func (s *FileService) ListArchiveEntries(ctx context.Context, req *pb.ListArchiveEntriesRequest) (*pb.ListArchiveEntriesResponse, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId), attrFileID.String(req.FileId))
+
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkScanStatus(record); err != nil {
+		return nil, err
+	}
+	a, err := s.openStoredArchive(ctx, record, filepath.Join(storageRoot, record.OwnerID, record.StorageName))
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+
+	resp := &pb.ListArchiveEntriesResponse{FileId: record.FileID, Format: a.format}
+	add := func(e *pb.ArchiveEntry) {
+		if strings.HasPrefix(e.Name, req.Prefix) {
+			resp.Entries = append(resp.Entries, e)
+		}
+	}
+	if a.zip != nil {
+		for _, f := range a.zip.File {
+			add(&pb.ArchiveEntry{
+				Name:           f.Name,
+				Type:           zipEntryType(f),
+				Size:           int64(f.UncompressedSize64),
+				CompressedSize: int64(f.CompressedSize64),
+				ModifiedAt:     timestamppb.New(f.Modified),
+			})
+		}
+	} else {
+		err = a.walkTar(func(hdr *tar.Header, _ *tar.Reader) bool {
+			add(&pb.ArchiveEntry{
+				Name:       hdr.Name,
+				Type:       tarEntryType(hdr),
+				Size:       hdr.Size,
+				ModifiedAt: timestamppb.New(hdr.ModTime),
+			})
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrFileCount.Int(len(resp.Entries)))
+	return resp, nil
+}
+
+func (s *FileService) DownloadArchiveEntry(req *pb.DownloadArchiveEntryRequest, stream pb.FileService_DownloadArchiveEntryServer) error {
+	ctx := stream.Context()
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId), attrFileID.String(req.FileId))
+
+	if req.EntryName == "" {
+		return status.Error(codes.InvalidArgument, "entry_name is required")
+	}
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, req.Path)
+	if err != nil {
+		return err
+	}
+	if err := s.checkScanStatus(record); err != nil {
+		return err
+	}
+	filePath := filepath.Join(storageRoot, record.OwnerID, record.StorageName)
+	a, err := s.openStoredArchive(ctx, record, filePath)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	// send envía la entrada encontrada; el primer mensaje lleva su nombre,
+	// tipo detectado, tamaño y fecha, como en Download
+	found := false
+	send := func(typ string, content io.Reader, first *pb.FileDownloadResponse) error {
+		found = true
+		if typ != entryFile {
+			return status.Errorf(codes.FailedPrecondition, "entry %s is a %s, not a file", req.EntryName, typ)
+		}
+		return s.sendArchiveEntry(ctx, stream, filePath, content, first)
+	}
+	first := &pb.FileDownloadResponse{FileId: record.FileID, FileName: path.Base(req.EntryName)}
+	if a.zip != nil {
+		for _, f := range a.zip.File {
+			if f.Name != req.EntryName {
+				continue
+			}
+			first.Size = int64(f.UncompressedSize64)
+			first.ModifiedAt = timestamppb.New(f.Modified)
+			typ := zipEntryType(f)
+			var content io.ReadCloser
+			if typ == entryFile {
+				if content, err = f.Open(); err != nil {
+					return status.Errorf(codes.FailedPrecondition, "failed to open entry: %v", err)
+				}
+				defer content.Close()
+			}
+			err = send(typ, content, first)
+			break
+		}
+	} else {
+		walkErr := a.walkTar(func(hdr *tar.Header, tr *tar.Reader) bool {
+			if hdr.Name != req.EntryName {
+				return true
+			}
+			first.Size = hdr.Size
+			first.ModifiedAt = timestamppb.New(hdr.ModTime)
+			err = send(tarEntryType(hdr), tr, first)
+			return false
+		})
+		if walkErr != nil && !found {
+			return walkErr
+		}
+	}
+	if !found {
+		return status.Errorf(codes.NotFound, "entry %s not found in archive", req.EntryName)
+	}
+	return err
+}
+
+// sendArchiveEntry envía el contenido de una entrada en fragmentos, con el
+// mismo ciclo que Download.
+func (s *FileService) sendArchiveEntry(ctx context.Context, stream pb.FileService_DownloadArchiveEntryServer, filePath string, content io.Reader, first *pb.FileDownloadResponse) (err error) {
+	// El tipo se detecta con los primeros bytes de la entrada, como en la
+	// etapa sniff
+	br := bufio.NewReaderSize(content, sniffLen)
+	head, _ := br.Peek(sniffLen)
+	first.DetectedContentType = http.DetectContentType(head)
+	s.compressResponse(ctx, first.Size, first.DetectedContentType)
+
+	_, span := startStorageSpan(ctx, "read", attrPath.String(filePath))
+	var sent int64
+	chunks := 0
+	defer func() {
+		span.SetAttributes(attrFileSize.Int64(sent), attrChunkCount.Int(chunks))
+		endSpan(span, err)
+	}()
+
+	fileID := first.FileId
+	var readErr, sendErr error
+	sent, chunks, readErr, sendErr = sendChunks(br, func(chunk []byte) error {
+		msg := &pb.FileDownloadResponse{FileId: fileID}
+		if first != nil {
+			msg, first = first, nil
+		}
+		msg.BinaryFileResponse = chunk
+		return stream.Send(msg)
+	})
+	switch {
+	case readErr != nil:
+		metrics.StorageError(metrics.StorageErrRead)
+		return fmt.Errorf("failed to read archive entry: %w", readErr)
+	case sendErr != nil:
+		return fmt.Errorf("failed to send file chunk: %w", sendErr)
+	}
+	// Entrada vacía: enviar solo los metadatos
+	if first != nil {
+		if err := stream.Send(first); err != nil {
+			return fmt.Errorf("failed to send file metadata: %w", err)
+		}
+	}
+	return nil
+}
+
+func zipEntryType(f *zip.File) string {
+	mode := f.Mode()
+	switch {
+	case mode.IsDir():
+		return entryFolder
+	case mode&os.ModeSymlink != 0:
+		return entrySymlink
+	case mode.IsRegular():
+		return entryFile
+	}
+	return entryOther
+}
+
+func tarEntryType(hdr *tar.Header) string {
+	switch hdr.Typeflag {
+	case tar.TypeReg:
+		return entryFile
+	case tar.TypeDir:
+		return entryFolder
+	case tar.TypeSymlink:
+		return entrySymlink
+	}
+	return entryOther
+}
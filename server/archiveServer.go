@@ -0,0 +1,512 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Descarga de varios archivos en un zip o tar.gz. El archivo se genera
+// mientras se envía, leyendo cada archivo del NFS una sola vez: nunca se
+// guarda completo en disco ni en memoria. Al final se agrega manifest.json
+// con el SHA-256 de cada archivo, calculado durante la lectura.
+
+// Formatos de DownloadArchive
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Nombre del manifiesto dentro del archivo
+const manifestName = "manifest.json"
+
+// archive describe un archivo comprimido por generar.
+type archive struct {
+	owner   string
+	format  string
+	name    string
+	entries []archiveEntry
+	// Paquete de ExportOwner: el manifiesto describe también los registros
+	export bool
+}
+
+// archiveEntry es una carpeta o un archivo del árbol, con su ruta dentro del
+// archivo comprimido.
+type archiveEntry struct {
+	name   string
+	folder *metadata.Folder
+	file   *metadata.File
+}
+
+// manifest es el contenido de manifest.json.
+type manifest struct {
+	CreatedAt time.Time       `json:"created_at"`
+	OwnerID   string          `json:"owner_id"`
+	Files     []manifestEntry `json:"files"`
+	// Archivos que no se pudieron incluir, con el motivo
+	Skipped []manifestEntry `json:"skipped,omitempty"`
+	// Solo en los paquetes de ExportOwner: versión del formato y carpetas
+	Format  string           `json:"format,omitempty"`
+	Folders []manifestFolder `json:"folders,omitempty"`
+}
+
+type manifestEntry struct {
+	Path   string `json:"path"`
+	FileID string `json:"file_id"`
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Solo en los paquetes de ExportOwner
+	OriginalName string            `json:"original_name,omitempty"`
+	ContentType  string            `json:"content_type,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	CreatedAt    *time.Time        `json:"created_at,omitempty"`
+	ModifiedAt   *time.Time        `json:"modified_at,omitempty"`
+}
+
+type manifestFolder struct {
+	Path       string    `json:"path"`
+	FolderID   string    `json:"folder_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	ModifiedAt time.Time `json:"modified_at"`
+}
+
+func (s *FileService) DownloadArchive(req *pb.DownloadArchiveRequest, stream pb.FileService_DownloadArchiveServer) error {
+	ctx := stream.Context()
+	a, err := s.prepareArchive(ctx, req)
+	if err != nil {
+		return err
+	}
+	return s.sendArchive(ctx, a, stream)
+}
+
+// sendArchive genera el archivo comprimido mientras lo envía por stream.
+func (s *FileService) sendArchive(ctx context.Context, a *archive, stream pb.FileService_DownloadArchiveServer) error {
+	// El archivo se escribe en un pipe y se envía con el mismo ciclo de
+	// fragmentos que Download
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		err := s.writeArchive(ctx, pw, a)
+		pw.CloseWithError(err)
+		written <- err
+	}()
+
+	first := &pb.DownloadArchiveResponse{FileName: a.name, ContentType: a.contentType()}
+	_, _, readErr, sendErr := sendChunks(pr, func(chunk []byte) error {
+		msg := &pb.DownloadArchiveResponse{}
+		if first != nil {
+			msg, first = first, nil
+		}
+		msg.BinaryFileResponse = chunk
+		return stream.Send(msg)
+	})
+	// Si el cliente se desconectó, detener la escritura
+	pr.CloseWithError(sendErr)
+	writeErr := <-written
+	if sendErr != nil {
+		return fmt.Errorf("failed to send archive chunk: %w", sendErr)
+	}
+	if writeErr == nil {
+		writeErr = readErr
+	}
+	if writeErr != nil {
+		return status.Errorf(codes.Internal, "failed to build archive: %v", writeErr)
+	}
+	return nil
+}
+
+// ArchiveHandler sirve DownloadArchive por HTTP:
+//
+//	GET /archive?owner_id=u1&file_id=a&file_id=b&format=zip
+//	GET /archive?owner_id=u1&path=/fotos&format=tar.gz
+//
+// También acepta folder_id en lugar de path.
+func (s *FileService) ArchiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.URL.Query()
+		req := &pb.DownloadArchiveRequest{
+			OwnerId:    q.Get("owner_id"),
+			FileIds:    q["file_id"],
+			FolderId:   q.Get("folder_id"),
+			FolderPath: q.Get("path"),
+			Format:     q.Get("format"),
+		}
+		ctx := r.Context()
+		a, err := s.prepareArchive(ctx, req)
+		if err != nil {
+			st := status.Convert(err)
+			http.Error(w, st.Message(), httpStatus(st.Code()))
+			return
+		}
+
+		w.Header().Set("Content-Type", a.contentType())
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.name}))
+		cw := &countingWriter{w: w}
+		// La respuesta ya empezó: un error solo puede cortar la conexión,
+		// y el cliente lo nota porque el archivo queda incompleto
+		if err := s.writeArchive(ctx, cw, a); err != nil {
+			slog.WarnContext(ctx, "HTTP archive download failed", "owner_id", a.owner, "bytes", cw.n, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		metrics.AddDownloadBytes("DownloadArchive", a.owner, cw.n)
+	})
+}
+
+// httpStatus traduce los códigos gRPC que retorna prepareArchive.
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusInternalServerError
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (a *archive) contentType() string {
+	if a.format == ArchiveTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+// prepareArchive valida la petición y arma la lista de entradas antes de
+// empezar a enviar, para poder responder con un error.
+func (s *FileService) prepareArchive(ctx context.Context, req *pb.DownloadArchiveRequest) (*archive, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	format, err := archiveFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+	a := &archive{owner: req.OwnerId, format: format}
+	byFolder := req.FolderId != "" || req.FolderPath != ""
+	if byFolder == (len(req.FileIds) > 0) {
+		return nil, status.Error(codes.InvalidArgument, "either file_ids or a folder is required")
+	}
+
+	base := "files"
+	if byFolder {
+		base, a.entries, err = s.folderEntries(req.OwnerId, req.FolderId, req.FolderPath)
+	} else {
+		a.entries, err = s.fileEntries(ctx, req.OwnerId, req.FileIds)
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.name = base + "." + a.format
+	return a, nil
+}
+
+// archiveFormat valida el formato pedido; vacío es zip.
+func archiveFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return ArchiveZip, nil
+	case ArchiveZip, ArchiveTarGz:
+		return format, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unsupported archive format %q (use zip or tar.gz)", format)
+}
+
+// folderEntries retorna la carpeta y todo su contenido visible, dentro de un
+// directorio con el nombre de la carpeta.
+func (s *FileService) folderEntries(owner, folderID, folderPath string) (string, []archiveEntry, error) {
+	folderID, err := s.folderRef(owner, folderID, folderPath)
+	if err != nil {
+		return "", nil, err
+	}
+	folder, err := s.store.GetFolder(owner, folderID)
+	if err != nil {
+		return "", nil, storeError(err)
+	}
+	// La raíz no tiene nombre: su contenido va en la raíz del archivo
+	base, dir := "files", ""
+	if folderID != metadata.RootID {
+		base, dir = folder.Name, folder.Name
+	}
+
+	var entries []archiveEntry
+	var walk func(folderID, dir string) error
+	walk = func(folderID, dir string) error {
+		folders, files, err := s.store.List(owner, folderID)
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			entries = append(entries, archiveEntry{name: path.Join(dir, f.Name), file: f})
+		}
+		for _, f := range folders {
+			name := path.Join(dir, f.Name)
+			entries = append(entries, archiveEntry{name: name, folder: f})
+			if err := walk(f.FolderID, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if dir != "" {
+		entries = append(entries, archiveEntry{name: dir, folder: folder})
+	}
+	if err := walk(folderID, dir); err != nil {
+		return "", nil, storeError(err)
+	}
+	return base, entries, nil
+}
+
+// fileEntries retorna los archivos indicados con su ruta relativa a la
+// carpeta común más profunda, para conservar la estructura entre ellos.
+func (s *FileService) fileEntries(ctx context.Context, owner string, ids []string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		record, err := s.lookupFile(ctx, owner, id, "")
+		if err != nil {
+			return nil, err
+		}
+		p, err := s.store.FilePath(record)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		entries = append(entries, archiveEntry{name: p, file: record})
+	}
+
+	common := path.Dir(entries[0].name)
+	for _, e := range entries[1:] {
+		for common != "/" && !strings.HasPrefix(e.name, common+"/") {
+			common = path.Dir(common)
+		}
+	}
+	for i := range entries {
+		entries[i].name = strings.TrimPrefix(strings.TrimPrefix(entries[i].name, common), "/")
+	}
+	return entries, nil
+}
+
+// archiveWriter escribe las entradas en un formato de archivo comprimido.
+type archiveWriter interface {
+	addDir(name string, modTime time.Time) error
+	addFile(name string, size int64, modTime time.Time, content io.Reader) error
+	Close() error
+}
+
+// writeArchive genera el archivo comprimido en w. Los archivos que no se
+// pueden descargar (por ejemplo, en cuarentena) se omiten y quedan en el
+// manifiesto con el motivo.
+func (s *FileService) writeArchive(ctx context.Context, w io.Writer, a *archive) (err error) {
+	ctx, span := startStorageSpan(ctx, "archive", attrOwner.String(a.owner))
+	counter := &countingWriter{w: w}
+	defer func() {
+		span.SetAttributes(attrFileSize.Int64(counter.n), attrFileCount.Int(len(a.entries)))
+		endSpan(span, err)
+	}()
+
+	var aw archiveWriter
+	if a.format == ArchiveTarGz {
+		aw = newTarGzWriter(counter)
+	} else {
+		aw = &zipWriter{zip.NewWriter(counter)}
+	}
+
+	m := manifest{CreatedAt: time.Now().UTC(), OwnerID: a.owner, Files: []manifestEntry{}}
+	if a.export {
+		m.Format = exportFormat
+	}
+	for _, e := range a.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.folder != nil {
+			if err := aw.addDir(e.name, e.folder.ModifiedAt); err != nil {
+				return err
+			}
+			if a.export {
+				m.Folders = append(m.Folders, manifestFolder{
+					Path:       e.name,
+					FolderID:   e.folder.FolderID,
+					CreatedAt:  e.folder.CreatedAt,
+					ModifiedAt: e.folder.ModifiedAt,
+				})
+			}
+			continue
+		}
+		entry, err := s.addArchiveFile(ctx, aw, e)
+		if err != nil {
+			return err
+		}
+		if entry.Reason != "" {
+			m.Skipped = append(m.Skipped, entry)
+			continue
+		}
+		if a.export {
+			describeExported(&entry, e.file)
+		}
+		m.Files = append(m.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	name := manifestName
+	for i := 2; a.hasEntry(name); i++ {
+		name = fmt.Sprintf("manifest (%d).json", i)
+	}
+	if err := aw.addFile(name, int64(len(data)), m.CreatedAt, strings.NewReader(string(data))); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+func (a *archive) hasEntry(name string) bool {
+	for _, e := range a.entries {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addArchiveFile copia un archivo del NFS al archivo comprimido calculando su
+// SHA-256. Un archivo que no se puede descargar se omite; un error de
+// escritura detiene todo el archivo.
+func (s *FileService) addArchiveFile(ctx context.Context, aw archiveWriter, e archiveEntry) (manifestEntry, error) {
+	entry := manifestEntry{Path: e.name, FileID: e.file.FileID}
+	if err := s.checkScanStatus(e.file); err != nil {
+		entry.Reason = status.Convert(err).Message()
+		return entry, nil
+	}
+	content, err := s.openContent(ctx, e.file, filepath.Join(storageRoot, e.file.OwnerID, e.file.StorageName))
+	if err != nil {
+		entry.Reason = "file content is unreadable"
+		if errors.Is(err, os.ErrNotExist) {
+			entry.Reason = "file content is missing"
+		}
+		return entry, nil
+	}
+	defer content.Close()
+
+	// Los archivos subidos antes del árbol de carpetas no tienen fecha
+	modTime := e.file.ModifiedAt
+	if modTime.IsZero() {
+		modTime = content.modTime
+	}
+	h := sha256.New()
+	tee := io.TeeReader(&storageReader{content}, h)
+	if err := aw.addFile(e.name, content.Size(), modTime, tee); err != nil {
+		return entry, err
+	}
+	entry.Size = content.Size()
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return entry, nil
+}
+
+// storageReader cuenta los errores de lectura del NFS.
+type storageReader struct {
+	r io.Reader
+}
+
+func (s *storageReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		metrics.StorageError(metrics.StorageErrRead)
+		err = fmt.Errorf("failed to read file: %w", err)
+	}
+	return n, err
+}
+
+type zipWriter struct {
+	*zip.Writer
+}
+
+func (z *zipWriter) addDir(name string, modTime time.Time) error {
+	_, err := z.CreateHeader(&zip.FileHeader{Name: name + "/", Modified: modTime})
+	return err
+}
+
+func (z *zipWriter) addFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	w, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, content)
+	return err
+}
+
+type tarGzWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newTarGzWriter(w io.Writer) *tarGzWriter {
+	gz := gzip.NewWriter(w)
+	return &tarGzWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// Las fechas se truncan al segundo: tar las redondea y una fecha futura
+// genera advertencias al extraer.
+func (t *tarGzWriter) addDir(name string, modTime time.Time) error {
+	return t.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755, ModTime: modTime.Truncate(time.Second)})
+}
+
+func (t *tarGzWriter) addFile(name string, size int64, modTime time.Time, content io.Reader) error {
+	err := t.tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0644, ModTime: modTime.Truncate(time.Second)})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(t.tw, content, size)
+	return err
+}
+
+func (t *tarGzWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+)
+
+// Manejo de metadatos y etiquetas definidos por el usuario.
+
+func (s *FileService) UpdateMetadata(ctx context.Context, req *pb.UpdateMetadataRequest) (*pb.FileEntry, error) {
+	return s.updateAttributes(req.OwnerId, req.FileId, func(f *metadata.File) {
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		for k, v := range req.Set {
+			f.Metadata[k] = v
+		}
+		for _, k := range req.Remove {
+			delete(f.Metadata, k)
+		}
+	})
+}
+
+func (s *FileService) AddTags(ctx context.Context, req *pb.TagsRequest) (*pb.FileEntry, error) {
+	return s.updateAttributes(req.OwnerId, req.FileId, func(f *metadata.File) {
+		f.Tags = append(f.Tags, req.Tags...)
+	})
+}
+
+func (s *FileService) RemoveTags(ctx context.Context, req *pb.TagsRequest) (*pb.FileEntry, error) {
+	remove := metadata.NormalizeTags(req.Tags)
+	return s.updateAttributes(req.OwnerId, req.FileId, func(f *metadata.File) {
+		f.Tags = slices.DeleteFunc(f.Tags, func(t string) bool {
+			return slices.Contains(remove, t)
+		})
+	})
+}
+
+func (s *FileService) ListFiles(ctx context.Context, req *pb.ListFilesRequest) (*pb.ListFilesResponse, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	folderID, err := s.folderRef(req.OwnerId, req.FolderId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	files, err := s.store.FindFiles(req.OwnerId, metadata.Query{
+		FolderID:  folderID,
+		Recursive: req.Recursive,
+		Tags:      req.Tags,
+		Metadata:  req.Metadata,
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	resp := &pb.ListFilesResponse{}
+	for _, f := range files {
+		path, err := s.store.FilePath(f)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		resp.Files = append(resp.Files, newFileEntryProto(f, path))
+	}
+	return resp, nil
+}
+
+func (s *FileService) updateAttributes(owner, fileID string, fn func(f *metadata.File)) (*pb.FileEntry, error) {
+	if err := validateIDs(owner, fileID); err != nil {
+		return nil, err
+	}
+	file, err := s.store.UpdateAttributes(owner, fileID, fn)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	path, err := s.store.FilePath(file)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return newFileEntryProto(file, path), nil
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/compression"
+	"github.com/Districorp-UPB/FileServer/compression/grpczstd"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// Compresión del contenido guardado (ver el paquete compression). Con una
+// política configurada, cada subida se comprime si su tipo no es uno ya
+// comprimido y su comienzo se reduce al menos MinRatio veces. Se comprime
+// antes de cifrar. Las lecturas descomprimen sin que se note; Download
+// puede además entregar el contenido comprimido tal cual (ver
+// FileDownloadRequest.accept_encoding).
+
+// CompressionPolicy decide qué subidas se guardan comprimidas.
+type CompressionPolicy struct {
+	// Algoritmo: compression.Zstd o compression.Gzip
+	Codec string
+	// Cuántas veces tiene que reducirse la muestra para comprimir el archivo
+	MinRatio float64
+}
+
+// DefaultCompressionPolicy es la política de WithCompression si no se
+// indica otra relación mínima.
+var DefaultCompressionPolicy = CompressionPolicy{Codec: compression.Zstd, MinRatio: 1.5}
+
+const (
+	// Bytes del comienzo de cada subida que se comprimen de prueba
+	compressionSampleSize = 128 << 10
+	// Los archivos más chicos no se comprimen: la tabla de búsqueda se
+	// come lo que se ahorra
+	minCompressedSize = 4 << 10
+)
+
+// Tipos que ya vienen comprimidos. Los de image/, audio/ y video/ también,
+// salvo los de compressibleMedia.
+var compressedTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/pdf":              true,
+	"application/wasm":             true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+var compressibleMedia = map[string]bool{
+	"image/bmp":     true,
+	"image/svg+xml": true,
+	"image/x-icon":  true,
+	"image/tiff":    true,
+	"audio/wave":    true,
+	"audio/wav":     true,
+	"audio/x-wav":   true,
+}
+
+// compressibleType indica si vale la pena probar a comprimir un archivo del
+// tipo MIME contentType (vacío si se desconoce).
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	if compressedTypes[mediaType] {
+		return false
+	}
+	// Documentos de Office y OpenDocument son archivos zip
+	if strings.HasPrefix(mediaType, "application/vnd.openxmlformats-") || strings.HasPrefix(mediaType, "application/vnd.oasis.opendocument.") {
+		return false
+	}
+	kind, _, _ := strings.Cut(mediaType, "/")
+	if kind == "image" || kind == "audio" || kind == "video" {
+		return compressibleMedia[mediaType]
+	}
+	return true
+}
+
+// compressContent decide si el contenido de una subida se guarda comprimido
+// y lo registra en f.Compression. Retorna el contenido a guardar, que
+// incluye lo leído para decidir.
+func (s *FileService) compressContent(f *metadata.File, content io.Reader) io.Reader {
+	f.Compression = ""
+	if s.compression.Codec == "" {
+		return content
+	}
+	r := bufio.NewReaderSize(content, compressionSampleSize)
+	// Un error de lectura se repite al copiar el contenido
+	sample, _ := r.Peek(compressionSampleSize)
+	if len(sample) < minCompressedSize {
+		return r
+	}
+	if !compressibleType(f.ContentType) || !compressibleType(http.DetectContentType(sample)) {
+		return r
+	}
+	ratio, err := compression.Ratio(s.compression.Codec, sample)
+	if err == nil && ratio >= s.compression.MinRatio {
+		f.Compression = s.compression.Codec
+	}
+	return r
+}
+
+// compressSeal agrega la compresión con codec (si no está vacío) antes de
+// seal.
+func compressSeal(codec string, seal sealFunc) sealFunc {
+	if codec == "" {
+		return seal
+	}
+	return func(w io.Writer) (io.WriteCloser, error) {
+		var sealed io.WriteCloser
+		if seal != nil {
+			var err error
+			if sealed, err = seal(w); err != nil {
+				return nil, err
+			}
+			w = sealed
+		}
+		cw, err := compression.NewWriter(w, codec)
+		if err != nil {
+			return nil, err
+		}
+		if sealed == nil {
+			return cw, nil
+		}
+		return &stackedWriter{WriteCloser: cw, inner: sealed}, nil
+	}
+}
+
+// stackedWriter escribe en el compresor y al cerrar completa también el
+// cifrado que tiene debajo.
+type stackedWriter struct {
+	io.WriteCloser
+	inner io.Closer
+}
+
+func (w *stackedWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	return w.inner.Close()
+}
+
+// Compresores gRPC para las respuestas de descarga, en orden de preferencia
+var responseCompressors = []string{grpczstd.Name, gzip.Name}
+
+// compressResponse elige la compresión gRPC de una descarga de size bytes
+// con los tipos MIME dados: el primer compresor de responseCompressors que
+// anunció el cliente, o ninguna si el contenido ya viene comprimido o es
+// chico. Hay que llamarla antes de enviar el primer mensaje.
+func (s *FileService) compressResponse(ctx context.Context, size int64, contentTypes ...string) {
+	if !s.responseCompression {
+		return
+	}
+	advertised, err := grpc.ClientSupportedCompressors(ctx)
+	if err != nil {
+		return
+	}
+	name := encoding.Identity
+	compressible := size >= minCompressedSize
+	for _, contentType := range contentTypes {
+		compressible = compressible && compressibleType(contentType)
+	}
+	if compressible {
+		for _, c := range responseCompressors {
+			if slices.Contains(advertised, c) {
+				name = c
+				break
+			}
+		}
+	}
+	// identity también reemplaza la compresión que gRPC copiaría de la
+	// petición
+	if err := grpc.SetSendCompressor(ctx, name); err != nil {
+		slog.WarnContext(ctx, "Failed to set response compressor", "compressor", name, "error", err)
+		return
+	}
+	method, _ := grpc.Method(ctx)
+	metrics.ObserveResponseCompression(path.Base(method), name)
+}
@@ -0,0 +1,34 @@
+package server
+
+import (
+	"path/filepath"
+	"syscall"
+)
+
+func diskUsageOf(path string) (DiskUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return DiskUsage{}, err
+	}
+	bsize := uint64(st.Bsize)
+	total := st.Blocks * bsize
+	// Bavail es el espacio disponible para usuarios sin privilegios
+	free := st.Bavail * bsize
+	return DiskUsage{Total: total, Free: free, Used: total - st.Bfree*bsize}, nil
+}
+
+// isMountPoint compara el dispositivo del directorio con el de su padre.
+func isMountPoint(path string) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	var self, parent syscall.Stat_t
+	if err := syscall.Stat(abs, &self); err != nil {
+		return false, err
+	}
+	if err := syscall.Stat(filepath.Dir(abs), &parent); err != nil {
+		return false, err
+	}
+	return self.Dev != parent.Dev || self.Ino == parent.Ino, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package server
+
+func diskUsageOf(path string) (DiskUsage, error) {
+	return DiskUsage{}, errDiskUsageUnsupported
+}
+
+func isMountPoint(path string) (bool, error) {
+	return false, errDiskUsageUnsupported
+}
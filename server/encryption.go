@@ -0,0 +1,227 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/compression"
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Cifrado del contenido guardado (ver el paquete encryption). Con un KMS
+// configurado cada subida se cifra con su propia clave de datos, guardada
+// envuelta en el registro del archivo. Los archivos guardados antes, o sin
+// KMS, quedan en texto plano y se siguen leyendo igual.
+
+// sealFunc envuelve el destino de saveFile, por ejemplo para cifrar. Close
+// debe completar el contenido sin cerrar el destino.
+type sealFunc func(w io.Writer) (io.WriteCloser, error)
+
+// newDataKey genera la clave de datos de una subida, la guarda envuelta en
+// el registro y retorna la función que cifra el contenido. Sin KMS retorna
+// nil.
+func (s *FileService) newDataKey(ctx context.Context, f *metadata.File) (sealFunc, error) {
+	f.Encryption = nil
+	if s.kms == nil {
+		return nil, nil
+	}
+	key, err := encryption.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := s.kms.WrapKey(ctx, key)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "failed to wrap data key: %v", err)
+	}
+	f.Encryption = wrapped
+	return func(w io.Writer) (io.WriteCloser, error) {
+		return encryption.NewWriter(w, key)
+	}, nil
+}
+
+// dataKey desenvuelve la clave de datos de un archivo cifrado.
+func (s *FileService) dataKey(ctx context.Context, f *metadata.File) ([]byte, error) {
+	if s.kms == nil {
+		return nil, status.Error(codes.FailedPrecondition, "file is encrypted but no KMS is configured")
+	}
+	key, err := s.kms.UnwrapKey(ctx, f.Encryption)
+	switch {
+	case errors.Is(err, encryption.ErrUnknownKey), errors.Is(err, encryption.ErrCorrupt):
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to unwrap data key: %v", err)
+	case err != nil:
+		return nil, status.Errorf(codes.Unavailable, "failed to unwrap data key: %v", err)
+	}
+	return key, nil
+}
+
+// decrypt descifra contenido pequeño derivado de un archivo cifrado, como
+// sus miniaturas.
+func (s *FileService) decrypt(ctx context.Context, f *metadata.File, data []byte) ([]byte, error) {
+	key, err := s.dataKey(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := encryption.NewReader(bytes.NewReader(data), int64(len(data)), key)
+	if err != nil {
+		return nil, status.Error(codes.DataLoss, err.Error())
+	}
+	plain, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	if err != nil {
+		return nil, status.Error(codes.DataLoss, err.Error())
+	}
+	return plain, nil
+}
+
+// storedContent es el contenido de un archivo guardado, descifrado y
+// descomprimido si hace falta. Permite lecturas secuenciales y aleatorias.
+type storedContent struct {
+	*io.SectionReader
+	file    *os.File
+	modTime time.Time
+	// Contenido descifrado pero todavía comprimido con encoding, si el
+	// archivo se guardó comprimido
+	encoded  *io.SectionReader
+	encoding string
+}
+
+func (c *storedContent) Close() error {
+	return c.file.Close()
+}
+
+// openContent abre el contenido guardado en filePath de un archivo.
+func (s *FileService) openContent(ctx context.Context, f *metadata.File, filePath string) (*storedContent, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrOpen)
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		metrics.StorageError(metrics.StorageErrStat)
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	c := &storedContent{file: file, modTime: info.ModTime()}
+	c.SectionReader, err = s.decryptContent(ctx, f, file, info.Size())
+	if err == nil && f.Compression != "" {
+		c.encoded, c.encoding = c.SectionReader, f.Compression
+		c.SectionReader, err = decompressContent(c.encoded, f.Compression)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (s *FileService) decryptContent(ctx context.Context, f *metadata.File, file *os.File, size int64) (*io.SectionReader, error) {
+	if f.Encryption == nil {
+		return io.NewSectionReader(file, 0, size), nil
+	}
+	key, err := s.dataKey(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	r, err := encryption.NewReader(file, size, key)
+	if err != nil {
+		if errors.Is(err, encryption.ErrCorrupt) {
+			return nil, status.Error(codes.DataLoss, err.Error())
+		}
+		metrics.StorageError(metrics.StorageErrRead)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return io.NewSectionReader(r, 0, r.Size()), nil
+}
+
+func decompressContent(encoded *io.SectionReader, codec string) (*io.SectionReader, error) {
+	r, err := compression.NewReader(encoded, encoded.Size(), codec)
+	if err != nil {
+		if errors.Is(err, compression.ErrCorrupt) || errors.Is(err, encryption.ErrCorrupt) {
+			return nil, status.Error(codes.DataLoss, err.Error())
+		}
+		metrics.StorageError(metrics.StorageErrRead)
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return io.NewSectionReader(r, 0, r.Size()), nil
+}
+
+// RotateKeys activa una clave maestra nueva si rotate es true y el KMS lo
+// permite, y vuelve a envolver con la clave activa todas las claves de datos
+// envueltas con otra. El contenido de los archivos no se modifica. Retorna la
+// clave activa y cuántas claves se envolvieron de nuevo o fallaron.
+func (s *FileService) RotateKeys(ctx context.Context, rotate bool) (keyID string, rewrapped, failed int, err error) {
+	if s.kms == nil {
+		return "", 0, 0, status.Error(codes.FailedPrecondition, "encryption is not enabled")
+	}
+	if rotate {
+		rotator, ok := s.kms.(encryption.Rotator)
+		if !ok {
+			return "", 0, 0, status.Error(codes.FailedPrecondition, "the KMS rotates its master keys itself")
+		}
+		if _, err := rotator.Rotate(ctx); err != nil {
+			return "", 0, 0, status.Errorf(codes.Internal, "failed to rotate master key: %v", err)
+		}
+	}
+	keyID = s.kms.KeyID()
+
+	// Primero se buscan los archivos y después se envuelven, fuera de la
+	// transacción de lectura
+	var pending []*metadata.File
+	err = s.store.EachFile(func(f *metadata.File) error {
+		if f.Encryption != nil && f.Encryption.KeyID != keyID {
+			pending = append(pending, f)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, 0, storeError(err)
+	}
+
+	for _, f := range pending {
+		if err := ctx.Err(); err != nil {
+			return keyID, rewrapped, failed, status.FromContextError(err).Err()
+		}
+		if err := s.rewrapKey(ctx, f); err != nil {
+			failed++
+			slog.WarnContext(ctx, "Failed to rewrap data key", "owner_id", f.OwnerID, "file_id", f.FileID, "key_id", f.Encryption.KeyID, "error", err)
+			continue
+		}
+		rewrapped++
+	}
+	return keyID, rewrapped, failed, nil
+}
+
+// Una subida nueva reemplazó la clave de datos mientras se envolvía
+var errKeyChanged = errors.New("data key changed")
+
+func (s *FileService) rewrapKey(ctx context.Context, f *metadata.File) error {
+	key, err := s.dataKey(ctx, f)
+	if err != nil {
+		return err
+	}
+	wrapped, err := s.kms.WrapKey(ctx, key)
+	if err != nil {
+		return err
+	}
+	err = s.store.UpdateFile(f.OwnerID, f.FileID, func(cur *metadata.File) error {
+		if cur.Encryption == nil || !bytes.Equal(cur.Encryption.Ciphertext, f.Encryption.Ciphertext) {
+			return errKeyChanged
+		}
+		cur.Encryption = wrapped
+		return nil
+	})
+	if errors.Is(err, errKeyChanged) || errors.Is(err, metadata.ErrNotFound) {
+		return nil
+	}
+	return err
+}
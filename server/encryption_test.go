@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+)
+
+// Después de rotar, las claves de datos quedan envueltas con la clave
+// activa y el contenido se sigue leyendo aunque se quite la anterior.
+func TestRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	keyringPath := filepath.Join(t.TempDir(), "keyring.json")
+	keyring, err := encryption.OpenKeyring(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey := keyring.KeyID()
+	store := servertest.OpenStore(t)
+	svc := NewFileService(store, WithEncryption(keyring))
+	conn := servertest.Dial(t, func(s *grpc.Server) { pb.RegisterFileServiceServer(s, svc) })
+	c := pb.NewFileServiceClient(conn)
+
+	owner := "rotate"
+	contents := map[string][]byte{
+		"small": []byte("secret"),
+		"large": bytes.Repeat([]byte("0123456789"), 20000),
+	}
+	for id, content := range contents {
+		if _, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: id, FileName: id + ".bin"}, content); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := os.ReadFile(filepath.Join(storageRoot, owner, id+".bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(stored, content[:6]) {
+			t.Errorf("%s stored in plain text", id)
+		}
+	}
+
+	keyID, rewrapped, failed, err := svc.RotateKeys(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID == oldKey || keyID != keyring.KeyID() {
+		t.Errorf("RotateKeys key = %q, keyring active %q, previous %q", keyID, keyring.KeyID(), oldKey)
+	}
+	if rewrapped != len(contents) || failed != 0 {
+		t.Errorf("RotateKeys rewrapped %d, failed %d, want %d, 0", rewrapped, failed, len(contents))
+	}
+	for id := range contents {
+		f, err := store.GetFile(owner, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Encryption == nil || f.Encryption.KeyID != keyID {
+			t.Errorf("%s wrapped with %+v, want key %q", id, f.Encryption, keyID)
+		}
+	}
+
+	// Sin claves pendientes no se envuelve nada de nuevo
+	if _, rewrapped, failed, err := svc.RotateKeys(ctx, false); err != nil || rewrapped != 0 || failed != 0 {
+		t.Errorf("second RotateKeys = %d, %d, %v, want 0, 0, nil", rewrapped, failed, err)
+	}
+
+	// Quitar la clave anterior del archivo no impide leer
+	removeKey(t, keyringPath, oldKey)
+	keyring, err = encryption.OpenKeyring(keyringPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = newStoreClient(t, store, WithEncryption(keyring))
+	for id, content := range contents {
+		got, err := servertest.Download(ctx, c, &pb.FileDownloadRequest{OwnerId: owner, FileId: id})
+		if err != nil {
+			t.Fatalf("Download %s: %v", id, err)
+		}
+		if !bytes.Equal(got, content) {
+			t.Errorf("Download %s returned different content", id)
+		}
+	}
+}
+
+// removeKey quita una clave maestra del archivo del keyring.
+func removeKey(t *testing.T, path, id string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Active string            `json:"active"`
+		Keys   []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	keys := file.Keys[:0]
+	for _, raw := range file.Keys {
+		var key struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(raw, &key); err != nil {
+			t.Fatal(err)
+		}
+		if key.ID != id {
+			keys = append(keys, raw)
+		}
+	}
+	if len(keys) == len(file.Keys) {
+		t.Fatalf("key %q not in keyring", id)
+	}
+	file.Keys = keys
+	if data, err = json.Marshal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
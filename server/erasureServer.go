@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Borrado de todos los datos de un propietario (derecho de supresión). El
+// borrado es inmediato para las lecturas y el contenido se elimina del NFS en
+// segundo plano:
+//
+//  1. Se borran sus registros, que guardan las claves de datos envueltas: el
+//     contenido cifrado queda ilegible desde ese momento (crypto-shredding).
+//  2. Su directorio se mueve a erasedDir, así que nada más se lee ni se
+//     escribe en él, y se borran sus entradas del índice de búsqueda.
+//  3. Se agenda el borrado del directorio movido (contenido, miniaturas,
+//     cuarentena y subidas parciales). El trabajo se reintenta sin límite
+//     (ver ErasureRetryOptions) y cada fallo suma a la métrica
+//     erasure_deletion_failures_total.
+//
+// Los archivos sin cifrar siguen en el NFS hasta que termina el paso 3, y el
+// comprobante lo indica con deletion_status "pending". Las copias de la
+// base de metadatos anteriores al borrado (respaldos, páginas que bbolt no
+// reutilizó) conservan las claves envueltas: para que tampoco sirvan hay que
+// rotar la clave maestra y retirar la anterior del KMS.
+
+// Directorio de storageRoot con los directorios de los propietarios borrados
+// pendientes de eliminar. Los ids no pueden empezar con ".".
+const erasedDir = ".erased"
+
+// ErasureRetryOptions reintenta el borrado del contenido sin límite, como
+// mucho una vez por hora: descartar el trabajo dejaría archivos sin cifrar
+// en erasedDir para siempre.
+var ErasureRetryOptions = queue.Options{
+	MaxAttempts: math.MaxInt,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// Estados del borrado del contenido en el comprobante
+const (
+	// El trabajo DeletionJob todavía tiene que eliminar el directorio
+	deletionPending = "pending"
+	// No había contenido en el NFS
+	deletionNotNeeded = "not_needed"
+)
+
+// erasureReceipt es el comprobante de un borrado. Se entrega firmado.
+type erasureReceipt struct {
+	ReceiptID string    `json:"receipt_id"`
+	OwnerID   string    `json:"owner_id"`
+	ErasedAt  time.Time `json:"erased_at"`
+	Files     int       `json:"files"`
+	// Archivos cifrados, ilegibles desde ErasedAt
+	EncryptedFiles int `json:"encrypted_files"`
+	// Archivos sin cifrar, que se eliminan con el directorio
+	PlaintextFiles int `json:"plaintext_files"`
+	Folders        int `json:"folders"`
+	Changes        int `json:"changes"`
+	IndexEntries   int `json:"index_entries"`
+	// Trabajo que elimina el contenido del NFS (0 si no había directorio)
+	DeletionJob uint64 `json:"deletion_job,omitempty"`
+	// Estado de la eliminación del contenido al firmar: el comprobante se
+	// firma antes de que termine DeletionJob
+	DeletionStatus string `json:"deletion_status"`
+	// Clave con la que se firmó el comprobante
+	SigningKeyID string `json:"signing_key_id"`
+}
+
+// erasureJob elimina del NFS el directorio de un propietario borrado.
+type erasureJob struct {
+	ReceiptID string `json:"receipt_id"`
+	OwnerID   string `json:"owner_id"`
+	Dir       string `json:"dir"`
+}
+
+// EraseOwner borra todos los datos del propietario y retorna el comprobante
+// firmado. Repetirlo es seguro: un propietario sin datos da un comprobante
+// con todo en cero.
+func (s *FileService) EraseOwner(ctx context.Context, owner string) (*pb.EraseOwnerResponse, error) {
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(owner))
+	if err := validateIDs(owner); err != nil {
+		return nil, err
+	}
+	if s.erasures == nil || s.signer == nil {
+		return nil, status.Error(codes.FailedPrecondition, "owner erasure is not enabled")
+	}
+
+	receipt := erasureReceipt{
+		ReceiptID:    metadata.NewID(),
+		OwnerID:      owner,
+		ErasedAt:     time.Now().UTC(),
+		SigningKeyID: s.signer.KeyID(),
+	}
+	files, folders, changes, err := s.store.EraseOwner(owner)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	receipt.Files, receipt.Folders, receipt.Changes = len(files), folders, changes
+	for _, f := range files {
+		if f.Encryption != nil {
+			receipt.EncryptedFiles++
+		} else {
+			receipt.PlaintextFiles++
+		}
+	}
+	slog.InfoContext(ctx, "Owner records erased", "owner_id", owner, "receipt_id", receipt.ReceiptID, "files", receipt.Files, "encrypted_files", receipt.EncryptedFiles)
+
+	if s.index != nil {
+		if receipt.IndexEntries, err = s.index.RemoveOwner(owner); err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to remove owner from search index: %v", err)
+		}
+	}
+
+	dir, err := moveErasedDir(owner, receipt.ReceiptID)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to move owner directory: %v", err)
+	}
+	receipt.DeletionStatus = deletionNotNeeded
+	if dir != "" {
+		receipt.DeletionJob, err = s.erasures.Enqueue(erasureJob{ReceiptID: receipt.ReceiptID, OwnerID: owner, Dir: dir})
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to schedule owner data deletion: %v", err)
+		}
+		receipt.DeletionStatus = deletionPending
+	}
+
+	payload, signature, err := s.signer.Sign(receipt)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to sign erasure receipt: %v", err)
+	}
+	slog.InfoContext(ctx, "Owner erased", "owner_id", owner, "receipt_id", receipt.ReceiptID, "deletion_job", receipt.DeletionJob)
+	return &pb.EraseOwnerResponse{
+		ReceiptId: receipt.ReceiptID,
+		Receipt:   payload,
+		Signature: signature,
+		PublicKey: s.signer.PublicKey(),
+	}, nil
+}
+
+// moveErasedDir mueve el directorio del propietario a erasedDir y retorna su
+// nueva ruta, o "" si el propietario no tenía directorio.
+func moveErasedDir(owner, receiptID string) (string, error) {
+	if err := os.MkdirAll(filepath.Join(storageRoot, erasedDir), 0700); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(storageRoot, erasedDir, owner+"."+receiptID)
+	err := os.Rename(filepath.Join(storageRoot, owner), dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// EraseJob elimina el contenido de un propietario borrado. Es el Handler de
+// la cola de borrados, que se abre con ErasureRetryOptions.
+func (s *FileService) EraseJob(ctx context.Context, job queue.Job, _ bool) error {
+	var j erasureJob
+	if err := json.Unmarshal(job.Payload, &j); err != nil {
+		slog.ErrorContext(ctx, "Discarding invalid erasure job", "job_id", job.ID, "error", err)
+		return nil
+	}
+	// Solo se borra dentro de erasedDir, aunque el payload diga otra cosa
+	if filepath.Dir(j.Dir) != filepath.Join(storageRoot, erasedDir) {
+		slog.ErrorContext(ctx, "Discarding erasure job outside the erased directory", "job_id", job.ID, "dir", j.Dir)
+		return nil
+	}
+	if err := os.RemoveAll(j.Dir); err != nil {
+		metrics.ErasureDeletionFailed()
+		slog.ErrorContext(ctx, "Failed to delete erased owner data", "owner_id", j.OwnerID, "receipt_id", j.ReceiptID, "dir", j.Dir, "attempts", job.Attempts+1, "error", err)
+		return fmt.Errorf("failed to delete erased owner data: %w", err)
+	}
+	slog.InfoContext(ctx, "Erased owner data deleted", "owner_id", j.OwnerID, "receipt_id", j.ReceiptID)
+	return nil
+}
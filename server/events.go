@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/webhook"
+)
+
+// Los eventos de webhooks se guardan como pendientes en la misma transacción
+// que el cambio del archivo (ver metadata.PendingEvents) y después se pasan
+// al outbox de los webhooks. Así una caída entre el cambio y el outbox no
+// pierde el evento: RelayEvents lo pasa al arrancar.
+
+// Eventos pendientes que se leen por vez
+const relayBatch = 100
+
+// events retorna los tipos de evento que se guardan con un cambio: ninguno
+// si no hay webhooks configurados.
+func (s *FileService) events(types ...string) []string {
+	if s.webhooks == nil {
+		return nil
+	}
+	return types
+}
+
+// RelayEvents pasa los eventos pendientes al outbox de los webhooks. Se llama
+// después de cada cambio que guarda eventos y al arrancar el servidor. Un
+// fallo solo se registra: los eventos siguen pendientes y se pasan la
+// próxima vez.
+func (s *FileService) RelayEvents(ctx context.Context) {
+	if s.webhooks == nil {
+		return
+	}
+	// Dos llamadas a la vez entregarían dos veces los mismos eventos
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+	for {
+		events, err := s.store.PendingEvents(relayBatch)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read pending webhook events", "error", err)
+			return
+		}
+		for _, e := range events {
+			if err := s.webhooks.Publish(webhookEvent(e)); err != nil {
+				slog.ErrorContext(ctx, "Failed to publish webhook event", "type", e.Type, "owner_id", e.File.OwnerID, "file_id", e.File.FileID, "error", err)
+				return
+			}
+			if err := s.store.DeleteEvent(e.Seq); err != nil {
+				slog.ErrorContext(ctx, "Failed to delete published webhook event", "event_id", e.ID, "error", err)
+				return
+			}
+		}
+		if len(events) < relayBatch {
+			return
+		}
+	}
+}
+
+func webhookEvent(e *metadata.Event) webhook.Event {
+	f := e.File
+	contentType := f.DetectedContentType
+	if contentType == "" {
+		contentType = f.ContentType
+	}
+	return webhook.Event{
+		ID:      e.ID,
+		Type:    e.Type,
+		Time:    e.Time,
+		OwnerID: f.OwnerID,
+		FileID:  f.FileID,
+		File: &webhook.File{
+			Name:        f.Name,
+			Path:        e.Path,
+			Size:        f.Size,
+			ContentType: contentType,
+			SHA256:      f.SHA256,
+		},
+	}
+}
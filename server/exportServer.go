@@ -0,0 +1,316 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Exportación de todos los datos de un propietario en un paquete portable e
+// importación en otro servidor o propietario. El paquete es un archivo de
+// DownloadArchive con el árbol del propietario bajo files/ y un manifiesto
+// que además describe el registro de cada archivo (nombre original, tipo,
+// metadatos, etiquetas y fechas) y cada carpeta (id y fechas). La papelera
+// no se exporta.
+//
+// La importación es una extracción (ver ExtractArchive) en la raíz del
+// destino que toma los registros del manifiesto. Cada archivo y carpeta
+// conserva su id salvo que ya esté en uso en el destino: entonces recibe uno
+// nuevo y la respuesta informa el cambio. Las carpetas que ya existen en el
+// destino se reutilizan sin cambios.
+
+// Versión del formato de los paquetes, en manifest.json
+const exportFormat = "fileserver-export/1"
+
+// Directorio del paquete con el árbol del propietario
+const exportFilesDir = "files"
+
+// Tamaño máximo de manifest.json al importar
+const maxManifestSize = 64 << 20
+
+func (s *FileService) ExportOwner(req *pb.ExportOwnerRequest, stream pb.FileService_ExportOwnerServer) error {
+	ctx := stream.Context()
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId))
+
+	if err := validateIDs(req.OwnerId); err != nil {
+		return err
+	}
+	format, err := archiveFormat(req.Format)
+	if err != nil {
+		return err
+	}
+	_, entries, err := s.folderEntries(req.OwnerId, metadata.RootID, "")
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		entries[i].name = path.Join(exportFilesDir, entries[i].name)
+	}
+	a := &archive{
+		owner:   req.OwnerId,
+		format:  format,
+		name:    req.OwnerId + "-export." + format,
+		entries: entries,
+		export:  true,
+	}
+	return s.sendArchive(ctx, a, stream)
+}
+
+// describeExported agrega al manifiesto el registro del archivo.
+func describeExported(entry *manifestEntry, f *metadata.File) {
+	created, modified := f.CreatedAt, f.ModifiedAt
+	entry.OriginalName = f.OriginalName
+	entry.ContentType = f.ContentType
+	entry.Metadata = f.Metadata
+	entry.Tags = f.Tags
+	entry.CreatedAt = &created
+	entry.ModifiedAt = &modified
+}
+
+func (s *FileService) ImportOwner(stream pb.FileService_ImportOwnerServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive import request: %w", err)
+	}
+
+	ctx := stream.Context()
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId))
+
+	if err := validateIDs(req.OwnerId); err != nil {
+		return err
+	}
+	format, err := extractFormat(req.Format, req.FileName)
+	if err != nil {
+		return err
+	}
+	destPath, err := s.store.FolderPath(req.OwnerId, metadata.RootID)
+	if err != nil {
+		return storeError(err)
+	}
+
+	x := &extraction{
+		s:        s,
+		owner:    req.OwnerId,
+		dest:     metadata.RootID,
+		destPath: destPath,
+		replace:  req.ReplaceExisting,
+		limits:   s.extractLimits,
+		folders:  make(map[string]string),
+		resp:     &pb.ExtractArchiveResponse{},
+	}
+	tmpPath, err := x.receive(ctx, newImportReader(req, stream))
+	if tmpPath != "" {
+		defer s.partials.remove(tmpPath)
+		defer os.Remove(tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+	if x.bundle, err = readBundle(tmpPath, format); err != nil {
+		return err
+	}
+	if err := x.run(ctx, "import", tmpPath, format); err != nil {
+		return err
+	}
+
+	resp := &pb.ImportOwnerResponse{
+		Entries:    x.resp.Entries,
+		Imported:   x.resp.Extracted,
+		Failed:     x.resp.Failed,
+		Aborted:    x.aborted,
+		RenamedIds: x.bundle.renamed,
+	}
+	if err := stream.SendAndClose(resp); err != nil {
+		return fmt.Errorf("failed to send import response: %w", err)
+	}
+	return nil
+}
+
+// exportBundle es el manifiesto de un paquete que se está importando.
+type exportBundle struct {
+	// Archivos y carpetas del manifiesto, por su ruta en el paquete
+	files   map[string]*manifestEntry
+	folders map[string]*manifestFolder
+	// Ids originales que ya estaban en uso -> ids nuevos
+	renamed map[string]string
+}
+
+// readBundle lee el manifiesto del paquete guardado en archivePath.
+func readBundle(archivePath, format string) (*exportBundle, error) {
+	var m *manifest
+	var err error
+	if format == ArchiveZip {
+		m, err = readZipManifest(archivePath)
+	} else {
+		m, err = readTarManifest(archivePath, format == ArchiveTarGz)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "archive is not an owner export: %s is missing", manifestName)
+	}
+	if m.Format != exportFormat {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported export format %q", m.Format)
+	}
+
+	b := &exportBundle{
+		files:   make(map[string]*manifestEntry, len(m.Files)),
+		folders: make(map[string]*manifestFolder, len(m.Folders)),
+		renamed: make(map[string]string),
+	}
+	for i := range m.Files {
+		b.files[m.Files[i].Path] = &m.Files[i]
+	}
+	for i := range m.Folders {
+		b.folders[m.Folders[i].Path] = &m.Folders[i]
+	}
+	return b, nil
+}
+
+func readZipManifest(archivePath string) (*manifest, error) {
+	r, err := zip.OpenReader(archivePath)
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid zip archive: %v", err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != manifestName {
+			continue
+		}
+		content, err := f.Open()
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to read %s: %v", manifestName, err)
+		}
+		defer content.Close()
+		return decodeManifest(content)
+	}
+	return nil, nil
+}
+
+// readTarManifest busca el manifiesto, que ExportOwner escribe al final.
+func readTarManifest(archivePath string, compressed bool) (*manifest, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrOpen)
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid tar archive: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg && hdr.Name == manifestName {
+			return decodeManifest(tr)
+		}
+	}
+}
+
+func decodeManifest(r io.Reader) (*manifest, error) {
+	m := new(manifest)
+	if err := json.NewDecoder(io.LimitReader(r, maxManifestSize)).Decode(m); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid %s: %v", manifestName, err)
+	}
+	return m, nil
+}
+
+// contains indica si la entrada es parte del árbol exportado. El resto del
+// paquete (el manifiesto) no se importa como archivo.
+func (b *exportBundle) contains(name string) bool {
+	rest, ok := strings.CutPrefix(name, exportFilesDir+"/")
+	return ok && strings.Trim(rest, "/") != ""
+}
+
+// describe completa el registro de un archivo por importar con el del
+// manifiesto y retorna este último, o nil si el archivo no figura en él.
+func (b *exportBundle) describe(store *metadata.Store, owner, name string, record *metadata.File) (*manifestEntry, error) {
+	entry := b.files[name]
+	if entry == nil {
+		return nil, nil
+	}
+	if err := metadata.ValidateAttributes(entry.Metadata, entry.Tags); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid attributes in %s: %v", manifestName, err)
+	}
+	if validateIDs(entry.FileID) == nil {
+		if _, err := store.LoadFile(owner, entry.FileID); errors.Is(err, metadata.ErrNotFound) {
+			record.FileID = entry.FileID
+		}
+	}
+	if entry.OriginalName != "" {
+		record.OriginalName = entry.OriginalName
+	}
+	record.ContentType = entry.ContentType
+	record.Metadata = entry.Metadata
+	record.Tags = metadata.NormalizeTags(entry.Tags)
+	return entry, nil
+}
+
+// imported registra el id con el que se importó el archivo y le devuelve
+// sus fechas originales.
+func (b *exportBundle) imported(ctx context.Context, store *metadata.Store, entry *manifestEntry, record *metadata.File) {
+	if entry.FileID != record.FileID {
+		b.renamed[entry.FileID] = record.FileID
+	}
+	if entry.CreatedAt == nil || entry.ModifiedAt == nil {
+		return
+	}
+	err := store.UpdateFile(record.OwnerID, record.FileID, func(f *metadata.File) error {
+		f.CreatedAt, f.ModifiedAt = *entry.CreatedAt, *entry.ModifiedAt
+		return nil
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to restore imported file dates", "owner_id", record.OwnerID, "file_id", record.FileID, "error", err)
+	}
+}
+
+// createFolder crea la carpeta con la ruta rel dentro del árbol del paquete,
+// con el id y las fechas del manifiesto si figura en él.
+func (b *exportBundle) createFolder(store *metadata.Store, owner, parentID, rel, name string) (*metadata.Folder, error) {
+	entry := b.folders[path.Join(exportFilesDir, rel)]
+	if entry == nil {
+		return store.CreateFolder(owner, parentID, name)
+	}
+	from := metadata.Folder{CreatedAt: entry.CreatedAt, ModifiedAt: entry.ModifiedAt}
+	if validateIDs(entry.FolderID) == nil {
+		from.FolderID = entry.FolderID
+	}
+	folder, err := store.ImportFolder(owner, parentID, name, from)
+	if err != nil {
+		return nil, err
+	}
+	if entry.FolderID != "" && entry.FolderID != folder.FolderID {
+		b.renamed[entry.FolderID] = folder.FolderID
+	}
+	return folder, nil
+}
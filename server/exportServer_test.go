@@ -0,0 +1,122 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+)
+
+func exportOwner(ctx context.Context, c pb.FileServiceClient, owner, format string) ([]byte, error) {
+	stream, err := c.ExportOwner(ctx, &pb.ExportOwnerRequest{OwnerId: owner, Format: format})
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(resp.BinaryFileResponse)
+	}
+}
+
+func importOwner(ctx context.Context, c pb.FileServiceClient, owner, format string, data []byte) (*pb.ImportOwnerResponse, error) {
+	stream, err := c.ImportOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.ImportOwnerRequest{OwnerId: owner, Format: format}
+	for first := true; first || len(data) > 0; first = false {
+		n := min(len(data), 64<<10)
+		req.BinaryFile, data = data[:n], data[n:]
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		req = &pb.ImportOwnerRequest{}
+	}
+	return stream.CloseAndRecv()
+}
+
+// Las carpetas importadas conservan su id y sus fechas, salvo el id que ya
+// está en uso en el destino.
+func TestImportRestoresFolders(t *testing.T) {
+	ctx := context.Background()
+	store := servertest.OpenStore(t)
+	c := newStoreClient(t, store)
+
+	const src = "export-src"
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	modified := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	dates := metadata.Folder{CreatedAt: created, ModifiedAt: modified}
+	docs, err := store.ImportFolder(src, metadata.RootID, "docs", dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := store.ImportFolder(src, docs.FolderID, "sub", dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := store.ImportFolder(src, metadata.RootID, "empty", dates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: src, FileId: "f", FileName: "f.txt", FolderId: sub.FolderID}, []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+		t.Run(format, func(t *testing.T) {
+			bundle, err := exportOwner(ctx, c, src, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := "import-" + format
+			// El id de docs ya está en uso en el destino
+			if _, err := store.ImportFolder(dst, metadata.RootID, "taken", metadata.Folder{FolderID: docs.FolderID}); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := importOwner(ctx, c, dst, format, bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Failed != 0 || resp.Aborted != "" {
+				t.Fatalf("import failed: %+v", resp)
+			}
+
+			folder := func(path string) *metadata.Folder {
+				t.Helper()
+				item, err := store.Resolve(dst, path)
+				if err != nil || item.Folder == nil {
+					t.Fatalf("Resolve(%s) = %+v, %v", path, item, err)
+				}
+				if !item.Folder.CreatedAt.Equal(created) || !item.Folder.ModifiedAt.Equal(modified) {
+					t.Errorf("%s dates = %s, %s, want %s, %s", path, item.Folder.CreatedAt, item.Folder.ModifiedAt, created, modified)
+				}
+				return item.Folder
+			}
+			importedDocs := folder("/docs")
+			if importedDocs.FolderID == docs.FolderID || resp.RenamedIds[docs.FolderID] != importedDocs.FolderID {
+				t.Errorf("docs imported as %s, renamed ids %v", importedDocs.FolderID, resp.RenamedIds)
+			}
+			for path, want := range map[string]string{"/docs/sub": sub.FolderID, "/empty": empty.FolderID} {
+				if got := folder(path).FolderID; got != want {
+					t.Errorf("%s imported as %s, want %s", path, got, want)
+				}
+			}
+			item, err := store.Resolve(dst, "/docs/sub/f.txt")
+			if err != nil || item.File == nil || item.File.FolderID != sub.FolderID {
+				t.Errorf("Resolve file = %+v, %v", item.File, err)
+			}
+		})
+	}
+}
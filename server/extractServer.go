@@ -0,0 +1,506 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Extracción de un zip, tar o tar.gz subido en archivos y carpetas del
+// propietario. El archivo comprimido se guarda en un temporal (zip necesita
+// acceso aleatorio) y cada entrada se guarda como una subida independiente:
+// pasa por la cuota, validate, el antivirus y el resto del pipeline. Un
+// rechazo solo afecta a su entrada; superar los límites de descompresión
+// detiene la extracción.
+
+// Formato tar sin comprimir, solo para ExtractArchive
+const ArchiveTar = "tar"
+
+// ExtractLimits protege ExtractArchive de archivos comprimidos maliciosos
+// (zip bombs). 0 desactiva cada límite.
+type ExtractLimits struct {
+	// Cantidad máxima de entradas
+	MaxEntries int
+	// Tamaño máximo del archivo comprimido y del contenido extraído en total
+	MaxTotalSize int64
+	// Relación máxima entre el contenido extraído y el comprimido, en total
+	// y en cada entrada de un zip
+	MaxRatio int64
+}
+
+var DefaultExtractLimits = ExtractLimits{
+	MaxEntries:   10000,
+	MaxTotalSize: 4 << 30, // 4 GB
+	MaxRatio:     100,
+}
+
+// La relación de compresión solo se comprueba a partir de este tamaño: los
+// archivos pequeños y repetitivos se comprimen mucho sin ser un ataque
+const ratioMinSize = 1 << 20 // 1 MB
+
+// extractEntry es una entrada del archivo comprimido.
+type extractEntry struct {
+	name string
+	dir  bool
+	// Motivo por el que no se extrae (enlaces, dispositivos...)
+	unsupported string
+	// Tamaños declarados; compressed solo se conoce en zip
+	size       int64
+	compressed int64
+	open       func() (io.ReadCloser, error)
+}
+
+// extraction es el estado de una llamada a ExtractArchive.
+type extraction struct {
+	s        *FileService
+	owner    string
+	dest     string
+	destPath string
+	replace  bool
+	limits   ExtractLimits
+	// Tamaño del archivo comprimido y bytes extraídos hasta ahora
+	archiveSize int64
+	extracted   int64
+	// Carpetas ya resueltas, por ruta relativa a la carpeta destino
+	folders map[string]string
+	// Motivo por el que se detuvo la extracción
+	aborted string
+	resp    *pb.ExtractArchiveResponse
+	// Paquete de ImportOwner (nil en ExtractArchive)
+	bundle *exportBundle
+}
+
+func (s *FileService) ExtractArchive(stream pb.FileService_ExtractArchiveServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return fmt.Errorf("failed to receive extract request: %w", err)
+	}
+
+	ctx := stream.Context()
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId))
+
+	// Comprobar el formato y la carpeta destino antes de recibir el contenido
+	if err := validateIDs(req.OwnerId); err != nil {
+		return err
+	}
+	format, err := extractFormat(req.Format, req.FileName)
+	if err != nil {
+		return err
+	}
+	dest, err := s.folderRef(req.OwnerId, req.FolderId, req.FolderPath)
+	if err != nil {
+		return err
+	}
+	if dest != metadata.RootID {
+		if _, err := s.store.GetFolder(req.OwnerId, dest); err != nil {
+			return storeError(err)
+		}
+	}
+	destPath, err := s.store.FolderPath(req.OwnerId, dest)
+	if err != nil {
+		return storeError(err)
+	}
+
+	x := &extraction{
+		s:        s,
+		owner:    req.OwnerId,
+		dest:     dest,
+		destPath: destPath,
+		replace:  req.ReplaceExisting,
+		limits:   s.extractLimits,
+		folders:  make(map[string]string),
+		resp:     &pb.ExtractArchiveResponse{},
+	}
+	tmpPath, err := x.receive(ctx, newExtractReader(req, stream))
+	if tmpPath != "" {
+		defer s.partials.remove(tmpPath)
+		defer os.Remove(tmpPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := x.run(ctx, "extract", tmpPath, format); err != nil {
+		return err
+	}
+	x.resp.Aborted = x.aborted
+
+	if err := stream.SendAndClose(x.resp); err != nil {
+		return fmt.Errorf("failed to send extract response: %w", err)
+	}
+	return nil
+}
+
+// run extrae las entradas del archivo comprimido guardado en archivePath.
+func (x *extraction) run(ctx context.Context, op, archivePath, format string) (err error) {
+	ctx, span := startStorageSpan(ctx, op, attrPath.String(archivePath), attrFileSize.Int64(x.archiveSize))
+	defer func() {
+		span.SetAttributes(attrFileCount.Int(int(x.resp.Extracted)))
+		endSpan(span, err)
+	}()
+	if format == ArchiveZip {
+		return x.extractZip(ctx, archivePath)
+	}
+	return x.extractTar(ctx, archivePath, format == ArchiveTarGz)
+}
+
+// extractFormat retorna el formato indicado o, si está vacío, el que
+// corresponde a la extensión del nombre.
+func extractFormat(format, fileName string) (string, error) {
+	if format == "" {
+		name := strings.ToLower(fileName)
+		switch {
+		case strings.HasSuffix(name, ".zip"):
+			format = ArchiveZip
+		case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+			format = ArchiveTarGz
+		case strings.HasSuffix(name, ".tar"):
+			format = ArchiveTar
+		default:
+			return "", status.Error(codes.InvalidArgument, "format is required when file_name has no archive extension")
+		}
+	}
+	switch format {
+	case ArchiveZip, ArchiveTar, ArchiveTarGz:
+		return format, nil
+	}
+	return "", status.Errorf(codes.InvalidArgument, "unsupported archive format %q", format)
+}
+
+// receive guarda el archivo comprimido en un temporal del directorio del
+// propietario y retorna su ruta.
+func (x *extraction) receive(ctx context.Context, content *uploadReader) (string, error) {
+	userPath := filepath.Join(storageRoot, x.owner)
+	if err := os.MkdirAll(userPath, 0755); err != nil {
+		metrics.StorageError(metrics.StorageErrMkdir)
+		return "", fmt.Errorf("failed to create user directory: %w", err)
+	}
+	_, span := startStorageSpan(ctx, "create", attrPath.String(userPath))
+	tmp, err := os.CreateTemp(userPath, partialPrefix+"*")
+	endSpan(span, err)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrCreate)
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer tmp.Close()
+	x.s.partials.add(tmp.Name())
+
+	var r io.Reader = content
+	if x.limits.MaxTotalSize > 0 {
+		r = io.LimitReader(content, x.limits.MaxTotalSize+1)
+	}
+	_, span = startStorageSpan(ctx, "write", attrPath.String(tmp.Name()))
+	x.archiveSize, err = io.Copy(tmp, r)
+	span.SetAttributes(attrFileSize.Int64(x.archiveSize), attrChunkCount.Int(content.chunks))
+	endSpan(span, err)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrWrite)
+		return tmp.Name(), fmt.Errorf("failed to write archive: %w", err)
+	}
+	if x.limits.MaxTotalSize > 0 && x.archiveSize > x.limits.MaxTotalSize {
+		return tmp.Name(), status.Errorf(codes.InvalidArgument, "archive exceeds the maximum size of %d bytes", x.limits.MaxTotalSize)
+	}
+	return tmp.Name(), nil
+}
+
+func (x *extraction) extractZip(ctx context.Context, archivePath string) error {
+	r, err := zip.OpenReader(archivePath)
+	// Las rutas inseguras se rechazan por entrada en entryPath
+	if err != nil && !errors.Is(err, zip.ErrInsecurePath) {
+		return status.Errorf(codes.InvalidArgument, "invalid zip archive: %v", err)
+	}
+	defer r.Close()
+
+	// El directorio central declara todas las entradas: los límites se
+	// comprueban antes de extraer nada
+	if x.limits.MaxEntries > 0 && len(r.File) > x.limits.MaxEntries {
+		return status.Errorf(codes.InvalidArgument, "archive has more than %d entries", x.limits.MaxEntries)
+	}
+	var declared uint64
+	for _, f := range r.File {
+		declared += f.UncompressedSize64
+	}
+	if x.limits.MaxTotalSize > 0 && declared > uint64(x.limits.MaxTotalSize) {
+		return status.Errorf(codes.InvalidArgument, "archive exceeds the maximum extracted size of %d bytes", x.limits.MaxTotalSize)
+	}
+
+	for _, f := range r.File {
+		if x.stopped(ctx) {
+			break
+		}
+		e := extractEntry{
+			name:       f.Name,
+			dir:        f.FileInfo().IsDir(),
+			size:       int64(f.UncompressedSize64),
+			compressed: int64(f.CompressedSize64),
+			open:       f.Open,
+		}
+		switch mode := f.Mode(); {
+		case mode&os.ModeSymlink != 0:
+			e.unsupported = "symbolic links are not extracted"
+		case !e.dir && !mode.IsRegular():
+			e.unsupported = "special files are not extracted"
+		}
+		x.add(ctx, e)
+	}
+	return nil
+}
+
+func (x *extraction) extractTar(ctx context.Context, archivePath string, compressed bool) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrOpen)
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if compressed {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid gzip archive: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	entries := 0
+	for !x.stopped(ctx) {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && !errors.Is(err, tar.ErrInsecurePath) {
+			// Las entradas anteriores ya se guardaron: se informa como una
+			// extracción detenida
+			x.aborted = fmt.Sprintf("invalid tar archive: %v", err)
+			break
+		}
+		if hdr.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+		if entries++; x.limits.MaxEntries > 0 && entries > x.limits.MaxEntries {
+			x.aborted = fmt.Sprintf("archive has more than %d entries", x.limits.MaxEntries)
+			break
+		}
+		e := extractEntry{
+			name: hdr.Name,
+			dir:  hdr.Typeflag == tar.TypeDir,
+			size: hdr.Size,
+			open: func() (io.ReadCloser, error) { return io.NopCloser(tr), nil },
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+		case tar.TypeSymlink, tar.TypeLink:
+			e.unsupported = "symbolic and hard links are not extracted"
+		default:
+			e.unsupported = "special files are not extracted"
+		}
+		x.add(ctx, e)
+	}
+	return nil
+}
+
+// stopped indica si la extracción debe detenerse.
+func (x *extraction) stopped(ctx context.Context) bool {
+	if x.aborted == "" && ctx.Err() != nil {
+		x.aborted = "extraction was canceled"
+	}
+	return x.aborted != ""
+}
+
+// add extrae una entrada y agrega su resultado a la respuesta.
+func (x *extraction) add(ctx context.Context, e extractEntry) {
+	if x.bundle != nil && !x.bundle.contains(e.name) {
+		return
+	}
+	result := &pb.ExtractedEntry{Name: e.name, Folder: e.dir}
+	err := x.extract(ctx, e, result)
+	if err != nil {
+		st, _ := status.FromError(err)
+		result.Error = st.Message()
+		result.Code = st.Code().String()
+		x.resp.Failed++
+		metrics.ObserveExtractedEntry(metrics.ExtractFailed)
+	} else {
+		x.resp.Extracted++
+		metrics.ObserveExtractedEntry(metrics.ExtractDone)
+	}
+	x.resp.Entries = append(x.resp.Entries, result)
+}
+
+func (x *extraction) extract(ctx context.Context, e extractEntry, result *pb.ExtractedEntry) error {
+	parts, err := entryPath(e.name)
+	if err != nil {
+		return err
+	}
+	if x.bundle != nil {
+		if parts = parts[1:]; len(parts) == 0 {
+			return status.Error(codes.InvalidArgument, "invalid entry name")
+		}
+	}
+	result.Path = joinTreePath(x.destPath, strings.Join(parts, "/"))
+	if e.unsupported != "" {
+		return status.Error(codes.InvalidArgument, e.unsupported)
+	}
+	if e.dir {
+		id, err := x.folder(parts)
+		result.FolderId = id
+		return err
+	}
+
+	// Una entrada que se expande demasiado respecto a su tamaño comprimido
+	// es una zip bomb: se detiene todo el archivo
+	if x.limits.MaxRatio > 0 && e.compressed > 0 && e.size > ratioMinSize && e.size/e.compressed > x.limits.MaxRatio {
+		x.aborted = fmt.Sprintf("entry exceeds the maximum compression ratio of %d", x.limits.MaxRatio)
+		return status.Error(codes.InvalidArgument, x.aborted)
+	}
+
+	parentID, err := x.folder(parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	name := parts[len(parts)-1]
+	record := &metadata.File{
+		OwnerID:      x.owner,
+		FileID:       metadata.NewID(),
+		Name:         name,
+		OriginalName: name,
+		FolderID:     parentID,
+	}
+	var exported *manifestEntry
+	if x.bundle != nil {
+		if exported, err = x.bundle.describe(x.s.store, x.owner, e.name, record); err != nil {
+			return err
+		}
+	}
+	if x.replace {
+		item, err := x.s.store.Resolve(x.owner, result.Path)
+		if err == nil && item.File != nil {
+			record.FileID = item.File.FileID
+		}
+	}
+	if err := x.s.store.ValidateFile(record); err != nil {
+		return storeError(err)
+	}
+
+	content, err := e.open()
+	if err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to read entry: %v", err)
+	}
+	defer content.Close()
+	err = x.s.storeFile(ctx, record, &extractLimiter{r: content, x: x})
+	if err != nil {
+		if st, ok := unwrapStatus(err); ok {
+			return st.Err()
+		}
+		if x.aborted != "" {
+			return status.Error(codes.InvalidArgument, x.aborted)
+		}
+		return status.Error(codes.Internal, err.Error())
+	}
+	result.FileId = record.FileID
+	result.Size = record.Size
+	if exported != nil {
+		x.bundle.imported(ctx, x.s.store, exported, record)
+	}
+	return nil
+}
+
+// folder retorna la carpeta con esa ruta relativa a la carpeta destino,
+// creando las que falten. Las carpetas que ya existen se reutilizan.
+func (x *extraction) folder(parts []string) (string, error) {
+	id := x.dest
+	for i := range parts {
+		rel := strings.Join(parts[:i+1], "/")
+		if cached, ok := x.folders[rel]; ok {
+			id = cached
+			continue
+		}
+		item, err := x.s.store.Resolve(x.owner, joinTreePath(x.destPath, rel))
+		switch {
+		case err == nil && item.Folder != nil:
+			id = item.Folder.FolderID
+		case err == nil:
+			return "", status.Errorf(codes.AlreadyExists, "%s is a file", joinTreePath(x.destPath, rel))
+		case errors.Is(err, metadata.ErrNotFound):
+			var folder *metadata.Folder
+			if x.bundle != nil {
+				folder, err = x.bundle.createFolder(x.s.store, x.owner, id, rel, parts[i])
+			} else {
+				folder, err = x.s.store.CreateFolder(x.owner, id, parts[i])
+			}
+			if err != nil {
+				return "", storeError(err)
+			}
+			id = folder.FolderID
+		default:
+			return "", storeError(err)
+		}
+		x.folders[rel] = id
+	}
+	return id, nil
+}
+
+// entryPath valida el nombre de una entrada y lo separa en componentes.
+// Rechaza las rutas absolutas y las que salen de la carpeta destino con ".."
+// (zip slip).
+func entryPath(name string) ([]string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return nil, status.Error(codes.InvalidArgument, "absolute paths are not extracted")
+	}
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		switch {
+		case p == "" || p == ".":
+			continue
+		case p == "..":
+			return nil, status.Error(codes.InvalidArgument, "paths outside the destination folder are not extracted")
+		case strings.ContainsRune(p, 0):
+			return nil, status.Error(codes.InvalidArgument, "invalid entry name")
+		}
+		parts = append(parts, p)
+	}
+	if len(parts) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid entry name")
+	}
+	return parts, nil
+}
+
+// extractLimiter cuenta los bytes extraídos y detiene la lectura al superar
+// el tamaño total o la relación de compresión permitidos.
+type extractLimiter struct {
+	r io.Reader
+	x *extraction
+}
+
+func (l *extractLimiter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	x := l.x
+	x.extracted += int64(n)
+	switch {
+	case x.limits.MaxTotalSize > 0 && x.extracted > x.limits.MaxTotalSize:
+		x.aborted = fmt.Sprintf("archive exceeds the maximum extracted size of %d bytes", x.limits.MaxTotalSize)
+	case x.limits.MaxRatio > 0 && x.extracted > ratioMinSize && x.extracted > x.limits.MaxRatio*x.archiveSize:
+		x.aborted = fmt.Sprintf("archive exceeds the maximum compression ratio of %d", x.limits.MaxRatio)
+	default:
+		return n, err
+	}
+	return n, errors.New(x.aborted)
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEntryPath(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		// Rechazada con InvalidArgument
+		invalid bool
+	}{
+		{name: "a.txt", want: "a.txt"},
+		{name: "dir/sub/a.txt", want: "dir/sub/a.txt"},
+		{name: "./dir//a.txt", want: "dir/a.txt"},
+		{name: `dir\a.txt`, want: "dir/a.txt"},
+		{name: "dir/", want: "dir"},
+		{name: "../x", invalid: true},
+		{name: "dir/../../x", invalid: true},
+		{name: `a\..\b`, invalid: true},
+		{name: "/x", invalid: true},
+		{name: `\x`, invalid: true},
+		{name: "C:x", invalid: true},
+		{name: `C:\x`, invalid: true},
+		{name: "a\x00b", invalid: true},
+		{name: "", invalid: true},
+		{name: "./", invalid: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := entryPath(tt.name)
+			if tt.invalid {
+				if status.Code(err) != codes.InvalidArgument {
+					t.Errorf("entryPath(%q) = %q, %v; want InvalidArgument", tt.name, parts, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("entryPath(%q): %v", tt.name, err)
+			}
+			if got := strings.Join(parts, "/"); got != tt.want {
+				t.Errorf("entryPath(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+// archiveFile es una entrada de un archivo comprimido de prueba.
+type archiveFile struct {
+	name, content string
+	// Destino de un enlace
+	link     string
+	typeflag byte
+}
+
+func buildZip(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTar(t *testing.T, files []archiveFile, compressed bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var gz *gzip.Writer
+	tw := tar.NewWriter(&buf)
+	if compressed {
+		gz = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gz)
+	}
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Typeflag: f.typeflag, Linkname: f.link, Mode: 0o644}
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(f.content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(f.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// extractArchive sube data en fragmentos de 64 KB.
+func extractArchive(ctx context.Context, c pb.FileServiceClient, owner, fileName string, data []byte) (*pb.ExtractArchiveResponse, error) {
+	stream, err := c.ExtractArchive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := &pb.ExtractArchiveRequest{OwnerId: owner, FileName: fileName}
+	for first := true; first || len(data) > 0; first = false {
+		n := min(len(data), 64<<10)
+		req.BinaryFile, data = data[:n], data[n:]
+		if err := stream.Send(req); err != nil {
+			return nil, err
+		}
+		req = &pb.ExtractArchiveRequest{}
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestExtractArchive(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+	// 8 MB de ceros: se comprimen a unos pocos KB
+	bomb := strings.Repeat("\x00", 8<<20)
+	links := []archiveFile{
+		{name: "a.txt", content: "alpha"},
+		{name: "symlink", link: "a.txt", typeflag: tar.TypeSymlink},
+		{name: "hardlink", link: "a.txt", typeflag: tar.TypeLink},
+		{name: "escape", link: "../../../etc/passwd", typeflag: tar.TypeSymlink},
+	}
+
+	tests := []struct {
+		name     string
+		fileName string
+		data     func(t *testing.T) []byte
+		// Entradas extraídas y rechazadas, por nombre
+		extracted []string
+		failed    map[string]string
+		aborted   string
+	}{
+		{
+			name:     "zip",
+			fileName: "docs.zip",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []archiveFile{{name: "a.txt", content: "alpha"}, {name: "dir/b.txt", content: "bravo"}})
+			},
+			extracted: []string{"a.txt", "dir/b.txt"},
+		},
+		{
+			name:     "zip slip",
+			fileName: "slip.zip",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []archiveFile{{name: "../evil.txt", content: "x"}, {name: "/abs.txt", content: "x"}, {name: "ok.txt", content: "x"}})
+			},
+			extracted: []string{"ok.txt"},
+			failed:    map[string]string{"../evil.txt": "outside the destination", "/abs.txt": "absolute paths"},
+		},
+		{
+			name:     "zip bomb",
+			fileName: "bomb.zip",
+			data: func(t *testing.T) []byte {
+				return buildZip(t, []archiveFile{{name: "first.txt", content: "x"}, {name: "zeros.bin", content: bomb}, {name: "after.txt", content: "x"}})
+			},
+			extracted: []string{"first.txt"},
+			failed:    map[string]string{"zeros.bin": "compression ratio"},
+			aborted:   "compression ratio",
+		},
+		{
+			name:     "tar.gz bomb",
+			fileName: "bomb.tar.gz",
+			data:     func(t *testing.T) []byte { return buildTar(t, []archiveFile{{name: "zeros.bin", content: bomb}}, true) },
+			failed:   map[string]string{"zeros.bin": "compression ratio"},
+			aborted:  "compression ratio",
+		},
+		{
+			name:      "tar links",
+			fileName:  "links.tar",
+			data:      func(t *testing.T) []byte { return buildTar(t, links, false) },
+			extracted: []string{"a.txt"},
+			failed: map[string]string{
+				"symlink":  "links are not extracted",
+				"hardlink": "links are not extracted",
+				"escape":   "links are not extracted",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := "extract-" + strings.NewReplacer(" ", "-", ".", "-").Replace(tt.name)
+			resp, err := extractArchive(ctx, c, owner, tt.fileName, tt.data(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(resp.Aborted, tt.aborted) || (tt.aborted == "") != (resp.Aborted == "") {
+				t.Errorf("Aborted = %q, want %q", resp.Aborted, tt.aborted)
+			}
+			var extracted []string
+			for _, e := range resp.Entries {
+				if e.Error == "" {
+					extracted = append(extracted, e.Name)
+					continue
+				}
+				want, ok := tt.failed[e.Name]
+				if !ok || !strings.Contains(e.Error, want) || e.Code != codes.InvalidArgument.String() {
+					t.Errorf("entry %s failed with %s: %s", e.Name, e.Code, e.Error)
+				}
+			}
+			if strings.Join(extracted, ",") != strings.Join(tt.extracted, ",") {
+				t.Errorf("extracted %v, want %v", extracted, tt.extracted)
+			}
+			if int(resp.Failed) != len(tt.failed) {
+				t.Errorf("Failed = %d, want %d", resp.Failed, len(tt.failed))
+			}
+
+			// Nada queda fuera del directorio del propietario ni a medias
+			for _, name := range []string{"evil.txt", "abs.txt"} {
+				if _, err := os.Stat(filepath.Join(storageRoot, name)); err == nil {
+					t.Errorf("%s written outside the owner directory", name)
+				}
+			}
+			partials, _ := filepath.Glob(filepath.Join(storageRoot, owner, partialPrefix+"*"))
+			if len(partials) > 0 {
+				t.Errorf("temporary files left: %v", partials)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Manejo del árbol virtual de carpetas. Las carpetas solo existen en el
+// almacén de metadatos: los archivos siguen guardados en
+// ./nfs/files/<owner>/<file_id><ext>, así que mover o renombrar nunca toca el NFS.
+
+func (s *FileService) CreateFolder(ctx context.Context, req *pb.CreateFolderRequest) (*pb.Folder, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	parentID, err := s.folderRef(req.OwnerId, req.ParentId, req.ParentPath)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.store.CreateFolder(req.OwnerId, parentID, req.Name)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return s.folderProto(folder)
+}
+
+func (s *FileService) Move(ctx context.Context, req *pb.MoveRequest) (*pb.ItemResponse, error) {
+	ref, err := s.itemRef(req.OwnerId, req.GetFileId(), req.GetFolderId(), req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	destID, err := s.folderRef(req.OwnerId, req.DestFolderId, req.DestPath)
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.store.Move(req.OwnerId, ref, destID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return s.itemProto(item)
+}
+
+func (s *FileService) Rename(ctx context.Context, req *pb.RenameRequest) (*pb.ItemResponse, error) {
+	ref, err := s.itemRef(req.OwnerId, req.GetFileId(), req.GetFolderId(), req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.store.Rename(req.OwnerId, ref, req.NewName)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return s.itemProto(item)
+}
+
+func (s *FileService) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.ItemResponse, error) {
+	ref, err := s.itemRef(req.OwnerId, req.GetFileId(), req.GetFolderId(), req.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	item, err := s.store.Trash(req.OwnerId, ref, s.events(webhook.FileDeleted)...)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	files := item.Descendants
+	if item.File != nil {
+		files = []*metadata.File{item.File}
+	}
+	for _, f := range files {
+		s.unindexFile(ctx, req.OwnerId, f.FileID)
+		s.removeThumbnails(ctx, f)
+	}
+	if len(files) > 0 {
+		s.RelayEvents(ctx)
+	}
+	return s.itemProto(item)
+}
+
+func (s *FileService) Restore(ctx context.Context, req *pb.RestoreRequest) (*pb.ItemResponse, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	ref := metadata.Ref{FileID: req.GetFileId(), FolderID: req.GetFolderId()}
+	if ref.FileID == "" && ref.FolderID == "" {
+		return nil, status.Error(codes.InvalidArgument, "file_id or folder_id is required")
+	}
+	item, err := s.store.Restore(req.OwnerId, ref)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	files := item.Descendants
+	if item.File != nil {
+		files = []*metadata.File{item.File}
+	}
+	for _, f := range files {
+		s.indexFile(ctx, f)
+		s.regenerateThumbnails(ctx, f)
+	}
+	return s.itemProto(item)
+}
+
+func (s *FileService) ListFolder(ctx context.Context, req *pb.ListFolderRequest) (*pb.ListFolderResponse, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	folderID, err := s.folderRef(req.OwnerId, req.FolderId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	folder, err := s.store.GetFolder(req.OwnerId, folderID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	folders, files, err := s.store.List(req.OwnerId, folderID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	dir, err := s.store.FolderPath(req.OwnerId, folderID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	resp := &pb.ListFolderResponse{Folder: newFolderProto(folder, dir)}
+	for _, f := range folders {
+		resp.Folders = append(resp.Folders, newFolderProto(f, joinTreePath(dir, f.Name)))
+	}
+	for _, f := range files {
+		resp.Files = append(resp.Files, newFileEntryProto(f, joinTreePath(dir, f.Name)))
+	}
+	return resp, nil
+}
+
+func (s *FileService) ListTrash(ctx context.Context, req *pb.ListTrashRequest) (*pb.ListFolderResponse, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	folders, files, err := s.store.ListTrash(req.OwnerId)
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	// Las rutas de la papelera son las ubicaciones originales
+	resp := &pb.ListFolderResponse{}
+	for _, f := range folders {
+		dir, _ := s.store.FolderPath(req.OwnerId, f.ParentID)
+		resp.Folders = append(resp.Folders, newFolderProto(f, joinTreePath(dir, f.Name)))
+	}
+	for _, f := range files {
+		dir, _ := s.store.FolderPath(req.OwnerId, f.FolderID)
+		resp.Files = append(resp.Files, newFileEntryProto(f, joinTreePath(dir, f.Name)))
+	}
+	return resp, nil
+}
+
+// itemRef identifica el elemento de una petición por id de archivo, id de
+// carpeta o ruta.
+func (s *FileService) itemRef(owner, fileID, folderID, path string) (metadata.Ref, error) {
+	if err := validateIDs(owner); err != nil {
+		return metadata.Ref{}, err
+	}
+	switch {
+	case fileID != "":
+		return metadata.Ref{FileID: fileID}, nil
+	case folderID != "":
+		return metadata.Ref{FolderID: folderID}, nil
+	case path != "":
+		item, err := s.store.Resolve(owner, path)
+		if err != nil {
+			return metadata.Ref{}, storeError(err)
+		}
+		if item.File != nil {
+			return metadata.Ref{FileID: item.File.FileID}, nil
+		}
+		if item.Folder.FolderID == metadata.RootID {
+			return metadata.Ref{}, status.Error(codes.InvalidArgument, "the root folder cannot be modified")
+		}
+		return metadata.Ref{FolderID: item.Folder.FolderID}, nil
+	}
+	return metadata.Ref{}, status.Error(codes.InvalidArgument, "file_id, folder_id or path is required")
+}
+
+// folderRef resuelve una carpeta por id o por ruta. Ambos vacíos es la raíz.
+func (s *FileService) folderRef(owner, folderID, path string) (string, error) {
+	if folderID != "" || path == "" {
+		return folderID, nil
+	}
+	item, err := s.store.Resolve(owner, path)
+	if err != nil {
+		return "", storeError(err)
+	}
+	if item.Folder == nil {
+		return "", status.Errorf(codes.InvalidArgument, "%s is not a folder", path)
+	}
+	return item.Folder.FolderID, nil
+}
+
+func (s *FileService) itemProto(item metadata.Item) (*pb.ItemResponse, error) {
+	if item.Folder != nil {
+		folder, err := s.folderProto(item.Folder)
+		if err != nil {
+			return nil, err
+		}
+		return &pb.ItemResponse{Item: &pb.ItemResponse_Folder{Folder: folder}}, nil
+	}
+	path, err := s.store.FilePath(item.File)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return &pb.ItemResponse{Item: &pb.ItemResponse_File{File: newFileEntryProto(item.File, path)}}, nil
+}
+
+func (s *FileService) folderProto(f *metadata.Folder) (*pb.Folder, error) {
+	path, err := s.store.FolderPath(f.OwnerID, f.FolderID)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return newFolderProto(f, path), nil
+}
+
+func newFolderProto(f *metadata.Folder, path string) *pb.Folder {
+	folder := &pb.Folder{
+		FolderId: f.FolderID,
+		Name:     f.Name,
+		ParentId: f.ParentID,
+		Path:     path,
+	}
+	if !f.CreatedAt.IsZero() {
+		folder.CreatedAt = timestamppb.New(f.CreatedAt)
+		folder.ModifiedAt = timestamppb.New(f.ModifiedAt)
+	}
+	return folder
+}
+
+func newFileEntryProto(f *metadata.File, path string) *pb.FileEntry {
+	return &pb.FileEntry{
+		FileId:     f.FileID,
+		Name:       f.Name,
+		FolderId:   f.FolderID,
+		Path:       path,
+		Size:       f.Size,
+		CreatedAt:  timestamppb.New(f.CreatedAt),
+		ModifiedAt: timestamppb.New(f.ModifiedAt),
+
+		OriginalName:        f.OriginalName,
+		ContentType:         f.ContentType,
+		DetectedContentType: f.DetectedContentType,
+		Metadata:            f.Metadata,
+		Tags:                f.Tags,
+		Media:               newMediaProto(f.Media),
+		ScanStatus:          f.ScanStatus,
+		ScanSignature:       f.ScanSignature,
+		Sha256:              f.SHA256,
+		StoredSize:          f.StoredSize,
+		Compression:         f.Compression,
+	}
+}
+
+func joinTreePath(dir, name string) string {
+	return strings.TrimSuffix(dir, "/") + "/" + name
+}
+
+// validateIDs rechaza ids vacíos o que puedan salirse del directorio del
+// propietario, ya que se usan para construir rutas en el NFS. Tampoco admite
+// comodines de glob, para que ningún id nombre más de un archivo, ni
+// caracteres de control: las claves de metadatos separan propietario e id
+// con un NUL, y "victim\x00x" recorrería los registros de victim.
+func validateIDs(ids ...string) error {
+	for _, id := range ids {
+		if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\*?[`) || strings.HasPrefix(id, ".") ||
+			strings.ContainsFunc(id, unicode.IsControl) {
+			return status.Errorf(codes.InvalidArgument, "invalid id %q", id)
+		}
+	}
+	return nil
+}
+
+// storeError traduce los errores del almacén de metadatos a códigos gRPC.
+func storeError(err error) error {
+	switch {
+	case errors.Is(err, metadata.ErrNotFound), errors.Is(err, metadata.ErrTrashed):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, metadata.ErrExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, metadata.ErrInvalidName), errors.Is(err, metadata.ErrInvalidMove),
+		errors.Is(err, metadata.ErrInvalidAttribute):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, metadata.ErrNotInTrash):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, metadata.ErrCursorExpired):
+		return status.Error(codes.OutOfRange, err.Error())
+	}
+	return status.Errorf(codes.Internal, "metadata store error: %v", err)
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"github.com/Districorp-UPB/FileServer/search"
+	"github.com/Districorp-UPB/FileServer/webhook"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateIDs(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"owner-1", true},
+		{"file.txt", true},
+		{"", false},
+		{".", false},
+		{"..", false},
+		{".hidden", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"a*", false},
+		{"a?", false},
+		{"a[", false},
+		{"victim\x00x", false},
+		{"a\nb", false},
+		{"a\x7fb", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			err := validateIDs(tt.id)
+			if tt.valid && err != nil {
+				t.Errorf("validateIDs(%q) = %v, want nil", tt.id, err)
+			}
+			if !tt.valid && status.Code(err) != codes.InvalidArgument {
+				t.Errorf("validateIDs(%q) = %v, want InvalidArgument", tt.id, err)
+			}
+		})
+	}
+}
+
+// Un propietario "victim\x00x" compartiría el prefijo de las claves de
+// victim: no puede crear nada que aparezca en sus listados.
+func TestOwnerWithNULRejected(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	_, err := c.CreateFolder(ctx, &pb.CreateFolderRequest{OwnerId: "victim\x00x", Name: "planted"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("CreateFolder code = %s, want InvalidArgument (%v)", status.Code(err), err)
+	}
+	if _, err := c.Delete(ctx, &pb.DeleteRequest{OwnerId: "victim\x00x", Item: &pb.DeleteRequest_Path{Path: "/planted"}}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Delete code = %s, want InvalidArgument (%v)", status.Code(err), err)
+	}
+
+	list, err := c.ListFolder(ctx, &pb.ListFolderRequest{OwnerId: "victim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Folders) != 0 || len(list.Files) != 0 {
+		t.Errorf("victim root lists %d folders and %d files, want none", len(list.Folders), len(list.Files))
+	}
+	trash, err := c.ListTrash(ctx, &pb.ListTrashRequest{OwnerId: "victim"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash.Folders) != 0 || len(trash.Files) != 0 {
+		t.Errorf("victim trash lists %d folders and %d files, want none", len(trash.Folders), len(trash.Files))
+	}
+}
+
+// Mover una carpeta a la papelera produce un file.deleted por cada archivo
+// visible dentro de ella y los saca del índice; restaurarla los indexa de
+// nuevo.
+func TestDeleteFolderDescendants(t *testing.T) {
+	ctx := context.Background()
+	ix, err := search.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ix.Close()
+	outbox, err := queue.Open(filepath.Join(t.TempDir(), "webhooks.db"), queue.Options{MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outbox.Close()
+	// Sin Run: las entregas quedan pendientes en el outbox
+	notifier := webhook.NewNotifier([]webhook.Endpoint{{URL: "http://127.0.0.1:1", Secret: "s"}}, outbox)
+	c := newTestClient(t, WithSearchIndex(ix), WithWebhooks(notifier))
+
+	const owner = "descendants"
+	docs, err := c.CreateFolder(ctx, &pb.CreateFolderRequest{OwnerId: owner, Name: "docs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := c.CreateFolder(ctx, &pb.CreateFolderRequest{OwnerId: owner, ParentId: docs.FolderId, Name: "sub"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploads := []struct {
+		fileID, folderID, content string
+	}{
+		{"a", docs.FolderId, "alpha"},
+		{"b", sub.FolderId, "bravo"},
+		{"c", "", "charlie"},
+	}
+	for _, up := range uploads {
+		req := &pb.FileUploadRequest{OwnerId: owner, FileId: up.fileID, FileName: up.fileID + ".txt", FolderId: up.folderID}
+		if _, err := servertest.Upload(ctx, c, req, []byte(up.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := func() map[string]string {
+		t.Helper()
+		deliveries, err := notifier.Deliveries(false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := map[string]string{}
+		for _, d := range deliveries {
+			if d.Event.Type == webhook.FileDeleted {
+				paths[d.Event.FileID] = d.Event.File.Path
+			}
+		}
+		return paths
+	}
+	indexed := func(term string) bool {
+		t.Helper()
+		matches, err := ix.Match(owner, term)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(matches) > 0
+	}
+
+	if _, err := c.Delete(ctx, &pb.DeleteRequest{OwnerId: owner, Item: &pb.DeleteRequest_FolderId{FolderId: docs.FolderId}}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": "/docs/a.txt", "b": "/docs/sub/b.txt"}
+	if got := deleted(); !maps.Equal(got, want) {
+		t.Errorf("file.deleted events = %v, want %v", got, want)
+	}
+	for term, want := range map[string]bool{"alpha": false, "bravo": false, "charlie": true} {
+		if got := indexed(term); got != want {
+			t.Errorf("%q indexed = %v after delete, want %v", term, got, want)
+		}
+	}
+
+	if _, err := c.Restore(ctx, &pb.RestoreRequest{OwnerId: owner, Item: &pb.RestoreRequest_FolderId{FolderId: docs.FolderId}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, term := range []string{"alpha", "bravo", "charlie"} {
+		if !indexed(term) {
+			t.Errorf("%q not indexed after restore", term)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthCheckFunc retorna un error si el componente revisado no está sano.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthChecker ejecuta periódicamente las revisiones registradas y publica el
+// resultado en el servidor estándar grpc.health.v1.
+type HealthChecker struct {
+	server   *health.Server
+	interval time.Duration
+
+	mu       sync.Mutex
+	names    []string
+	checks   map[string]HealthCheckFunc
+	draining bool
+}
+
+func NewHealthChecker(server *health.Server, interval time.Duration) *HealthChecker {
+	// No reportar SERVING hasta que pase la primera revisión
+	server.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	server.SetServingStatus(pb.FileService_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return &HealthChecker{
+		server:   server,
+		interval: interval,
+		checks:   make(map[string]HealthCheckFunc),
+	}
+}
+
+// AddCheck registra una revisión. Todas deben pasar para reportar SERVING.
+func (h *HealthChecker) AddCheck(name string, check HealthCheckFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.checks[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.checks[name] = check
+}
+
+// Run ejecuta las revisiones hasta que se cancele el contexto.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.CheckNow(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckNow ejecuta todas las revisiones una vez y actualiza el estado.
+func (h *HealthChecker) CheckNow(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	h.mu.Lock()
+	if h.draining {
+		h.mu.Unlock()
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	names := append([]string(nil), h.names...)
+	checks := make([]HealthCheckFunc, len(names))
+	for i, name := range names {
+		checks[i] = h.checks[name]
+	}
+	h.mu.Unlock()
+
+	status := healthpb.HealthCheckResponse_SERVING
+	for i, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, h.interval)
+		err := check(checkCtx)
+		cancel()
+		if err != nil {
+			slog.WarnContext(ctx, "Health check failed", "check", names[i], "error", err)
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		return healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	h.server.SetServingStatus("", status)
+	h.server.SetServingStatus(pb.FileService_ServiceDesc.ServiceName, status)
+	return status
+}
+
+// Drain reporta NOT_SERVING para todos los servicios e ignora cualquier
+// revisión posterior. Se usa al inicio del apagado.
+func (h *HealthChecker) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.draining = true
+	h.server.Shutdown()
+}
+
+// StorageCheck verifica que la raíz de almacenamiento exista, sea escribible
+// y, si requireMount es verdadero, que sea un punto de montaje (el NFS).
+func StorageCheck(requireMount bool) HealthCheckFunc {
+	return func(ctx context.Context) error {
+		info, err := os.Stat(storageRoot)
+		if err != nil {
+			return fmt.Errorf("storage root unavailable: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("storage root %s is not a directory", storageRoot)
+		}
+
+		if requireMount {
+			mounted, err := isMountPoint(storageRoot)
+			if err != nil {
+				return fmt.Errorf("failed to check storage mount: %w", err)
+			}
+			if !mounted {
+				return fmt.Errorf("storage root %s is not mounted", storageRoot)
+			}
+		}
+
+		// Escribir y borrar un archivo de prueba
+		probe, err := os.CreateTemp(storageRoot, ".healthcheck-*")
+		if err != nil {
+			return fmt.Errorf("storage root not writable: %w", err)
+		}
+		defer os.Remove(probe.Name())
+		if _, err := probe.Write([]byte("ok")); err != nil {
+			probe.Close()
+			return fmt.Errorf("storage root not writable: %w", err)
+		}
+		return probe.Close()
+	}
+}
+
+// DiskSpaceCheck falla cuando el espacio libre de la raíz de almacenamiento
+// es menor que minFree bytes. En las plataformas donde no se puede leer el
+// uso del disco no comprueba nada.
+func DiskSpaceCheck(minFree uint64) HealthCheckFunc {
+	return diskSpaceCheck(minFree, StorageUsage)
+}
+
+func diskSpaceCheck(minFree uint64, storageUsage func() (DiskUsage, error)) HealthCheckFunc {
+	var warnOnce sync.Once
+	return func(ctx context.Context) error {
+		usage, err := storageUsage()
+		if errors.Is(err, errDiskUsageUnsupported) {
+			warnOnce.Do(func() {
+				slog.WarnContext(ctx, "Disk space health check disabled", "error", err)
+			})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read disk usage: %w", err)
+		}
+		if usage.Free < minFree {
+			return fmt.Errorf("free disk space %d bytes below threshold %d bytes", usage.Free, minFree)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestDiskSpaceCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		usage   DiskUsage
+		err     error
+		wantErr bool
+	}{
+		{name: "enough space", usage: DiskUsage{Total: 100, Free: 50}},
+		{name: "below threshold", usage: DiskUsage{Total: 100, Free: 5}, wantErr: true},
+		{name: "statfs error", err: errors.New("permission denied"), wantErr: true},
+		// Sin forma de leer el disco, el chequeo no puede dejar el servidor
+		// en NOT_SERVING para siempre
+		{name: "unsupported platform", err: errDiskUsageUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := diskSpaceCheck(10, func() (DiskUsage, error) { return tt.usage, tt.err })
+			if err := check(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("check error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
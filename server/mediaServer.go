@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/Districorp-UPB/FileServer/media"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// StatFile retorna el registro de un archivo con sus metadatos técnicos.
+func (s *FileService) StatFile(ctx context.Context, req *pb.StatFileRequest) (*pb.FileEntry, error) {
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if record.CreatedAt.IsZero() {
+		// Archivo sin registro: los datos se toman del disco
+		filePath := filepath.Join(storageRoot, record.OwnerID, record.StorageName)
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return nil, status.Errorf(codes.NotFound, "file not found: %v", err)
+		}
+		record.Size = info.Size()
+		record.ModifiedAt = info.ModTime()
+		s.extractMedia(ctx, record, filePath)
+		return newFileEntryProto(record, ""), nil
+	}
+
+	path, err := s.store.FilePath(record)
+	if err != nil {
+		return nil, storeError(err)
+	}
+	return newFileEntryProto(record, path), nil
+}
+
+// extractMedia guarda en el registro los metadatos técnicos del archivo. Un
+// archivo dañado no impide la subida: solo queda sin metadatos.
+func (s *FileService) extractMedia(ctx context.Context, f *metadata.File, filePath string) {
+	_, span := startStorageSpan(ctx, "extract_media", attrPath.String(filePath))
+	info, err := media.Extract(filePath)
+	if errors.Is(err, media.ErrUnsupported) {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		slog.InfoContext(ctx, "Skipping media metadata extraction", "owner_id", f.OwnerID, "file_id", f.FileID, "reason", err.Error())
+		return
+	}
+	f.Media = info
+}
+
+// mediaStage extrae los metadatos técnicos del archivo. Los formatos no
+// soportados y los archivos dañados se omiten sin reintentar.
+func (s *FileService) mediaStage(ctx context.Context, f *metadata.File, filePath string) error {
+	file, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := media.ExtractFrom(file, file.Size())
+	if errors.Is(err, media.ErrUnsupported) || errors.Is(err, media.ErrMalformed) {
+		return skip(err)
+	}
+	if err != nil {
+		return err
+	}
+	f.Media = info
+	return nil
+}
+
+func newMediaProto(m *media.Info) *pb.MediaInfo {
+	if m == nil {
+		return nil
+	}
+	info := &pb.MediaInfo{
+		Format:      m.Format,
+		Width:       int32(m.Width),
+		Height:      int32(m.Height),
+		DurationMs:  m.DurationMs,
+		Orientation: int32(m.Orientation),
+		Codecs:      m.Codecs,
+		BitrateKbps: int32(m.BitrateKbps),
+		SampleRate:  int32(m.SampleRate),
+		Channels:    int32(m.Channels),
+		Tags:        m.Tags,
+	}
+	if m.Camera != nil {
+		info.CameraMake = m.Camera.Make
+		info.CameraModel = m.Camera.Model
+		info.Lens = m.Camera.Lens
+		info.ExposureTime = m.Camera.ExposureTime
+		info.FNumber = m.Camera.FNumber
+		info.Iso = int32(m.Camera.ISO)
+		info.FocalLengthMm = m.Camera.FocalLengthMm
+	}
+	if !m.TakenAt.IsZero() {
+		info.TakenAt = timestamppb.New(m.TakenAt)
+	}
+	if m.GPS != nil {
+		info.Location = &pb.GeoLocation{
+			Latitude:  m.GPS.Latitude,
+			Longitude: m.GPS.Longitude,
+			Altitude:  m.GPS.Altitude,
+		}
+	}
+	return info
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/audit"
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"github.com/Districorp-UPB/FileServer/scan"
+	"github.com/Districorp-UPB/FileServer/search"
+	"github.com/Districorp-UPB/FileServer/thumbnail"
+	"github.com/Districorp-UPB/FileServer/webhook"
+)
+
+// Option configura componentes opcionales de FileService.
+type Option func(*FileService)
+
+// WithSearchIndex habilita la búsqueda de texto completo con el índice dado.
+func WithSearchIndex(index *search.Index) Option {
+	return func(s *FileService) {
+		s.index = index
+	}
+}
+
+// WithThumbnails genera miniaturas de las imágenes subidas.
+func WithThumbnails(generator *thumbnail.Generator) Option {
+	return func(s *FileService) {
+		s.thumbnails = generator
+	}
+}
+
+// WithMetadataStripping elimina los metadatos EXIF, XMP e IPTC (incluida la
+// ubicación GPS) de las imágenes antes de guardarlas.
+func WithMetadataStripping() Option {
+	return func(s *FileService) {
+		s.stripMetadata = true
+	}
+}
+
+// WithScanner analiza cada subida antes de que se pueda descargar. Los
+// archivos infectados se mueven a cuarentena.
+func WithScanner(scanner scan.Scanner) Option {
+	return func(s *FileService) {
+		s.scanner = scanner
+	}
+}
+
+// WithPipeline configura las etapas que procesan cada subida (ver
+// ParsePipeline). Las asíncronas se agendan en jobs; si jobs es nil se
+// ejecutan antes de responder, como las demás. Sin esta opción se usa
+// DefaultPipeline.
+func WithPipeline(stages []StageConfig, jobs *queue.Queue) Option {
+	return func(s *FileService) {
+		s.stageConfigs = stages
+		s.jobs = jobs
+	}
+}
+
+// WithValidation define las reglas de la etapa validate.
+func WithValidation(rules ValidationRules) Option {
+	return func(s *FileService) {
+		s.validation = rules
+	}
+}
+
+// WithWebhooks publica los cambios en los archivos con el notificador dado.
+func WithWebhooks(notifier *webhook.Notifier) Option {
+	return func(s *FileService) {
+		s.webhooks = notifier
+	}
+}
+
+// WithWatchHeartbeat cambia el intervalo de los heartbeats que WatchFiles
+// envía cuando no hay cambios.
+func WithWatchHeartbeat(interval time.Duration) Option {
+	return func(s *FileService) {
+		s.watchHeartbeat = interval
+	}
+}
+
+// WithQuota limita los bytes que puede ocupar cada propietario, contando los
+// archivos en la papelera. Las subidas que la superarían se rechazan con
+// ResourceExhausted.
+func WithQuota(bytes int64) Option {
+	return func(s *FileService) {
+		s.quota = bytes
+	}
+}
+
+// WithExtractLimits cambia los límites de ExtractArchive. Sin esta opción se
+// usa DefaultExtractLimits.
+func WithExtractLimits(limits ExtractLimits) Option {
+	return func(s *FileService) {
+		s.extractLimits = limits
+	}
+}
+
+// WithEncryption cifra el contenido de cada subida con una clave de datos
+// propia, envuelta con la clave maestra activa del KMS.
+func WithEncryption(kms encryption.KMS) Option {
+	return func(s *FileService) {
+		s.kms = kms
+	}
+}
+
+// WithCompression guarda comprimidas las subidas que lo valen según policy.
+func WithCompression(policy CompressionPolicy) Option {
+	return func(s *FileService) {
+		s.compression = policy
+	}
+}
+
+// WithResponseCompression comprime con gRPC las descargas que lo valen,
+// con zstd o gzip según lo que anuncie el cliente.
+func WithResponseCompression() Option {
+	return func(s *FileService) {
+		s.responseCompression = true
+	}
+}
+
+// WithErasure habilita EraseOwner: el contenido de los propietarios borrados
+// se elimina del NFS con los trabajos de jobs (ver FileService.EraseJob) y
+// los comprobantes se firman con signer.
+func WithErasure(jobs *queue.Queue, signer *audit.Signer) Option {
+	return func(s *FileService) {
+		s.erasures = jobs
+		s.signer = signer
+	}
+}
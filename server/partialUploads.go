@@ -0,0 +1,133 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	pb "github.com/Districorp-UPB/FileServer/proto"
+)
+
+// Prefijo de los archivos temporales. Empieza con "." para que getFilePath
+// nunca los confunda con un archivo ya subido.
+const partialPrefix = ".upload-"
+
+// partialUploads lleva el registro de los archivos temporales que pertenecen
+// a subidas en curso en este proceso.
+type partialUploads struct {
+	mu    sync.Mutex
+	paths map[string]struct{}
+}
+
+func (p *partialUploads) add(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.paths == nil {
+		p.paths = make(map[string]struct{})
+	}
+	p.paths[path] = struct{}{}
+}
+
+func (p *partialUploads) remove(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.paths, path)
+}
+
+// cleanup borra todos los archivos temporales registrados y retorna cuántos
+// se eliminaron.
+func (p *partialUploads) cleanup() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	removed := 0
+	for path := range p.paths {
+		if err := os.Remove(path); err == nil {
+			removed++
+		}
+		delete(p.paths, path)
+	}
+	return removed
+}
+
+// RemoveStalePartialUploads borra los archivos temporales de subidas,
+// extracciones e importaciones que una caída dejó en los directorios de los
+// propietarios, y retorna cuántos se eliminaron. Solo borra los que no se
+// modificaron en grace: otra instancia que comparte el NFS puede estar
+// escribiéndolos. Se llama al arrancar, antes de aceptar subidas.
+func RemoveStalePartialUploads(grace time.Duration) (int, error) {
+	paths, err := filepath.Glob(filepath.Join(storageRoot, "*", partialPrefix+"*"))
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-grace)
+	removed := 0
+	var errs []error
+	for _, path := range paths {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// uploadReader expone los fragmentos de un stream de subida como un io.Reader,
+// empezando por el primer mensaje ya recibido.
+type uploadReader struct {
+	// recv recibe el siguiente fragmento del stream
+	recv func() ([]byte, error)
+	buf  []byte
+
+	// Bytes y fragmentos recibidos hasta ahora
+	bytes  int64
+	chunks int
+}
+
+func newUploadReader(first *pb.FileUploadRequest, stream pb.FileService_UploadServer) *uploadReader {
+	recv := func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetBinaryFile(), err
+	}
+	return &uploadReader{recv: recv, buf: first.BinaryFile, chunks: 1}
+}
+
+func newExtractReader(first *pb.ExtractArchiveRequest, stream pb.FileService_ExtractArchiveServer) *uploadReader {
+	recv := func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetBinaryFile(), err
+	}
+	return &uploadReader{recv: recv, buf: first.BinaryFile, chunks: 1}
+}
+
+func newImportReader(first *pb.ImportOwnerRequest, stream pb.FileService_ImportOwnerServer) *uploadReader {
+	recv := func() ([]byte, error) {
+		req, err := stream.Recv()
+		return req.GetBinaryFile(), err
+	}
+	return &uploadReader{recv: recv, buf: first.BinaryFile, chunks: 1}
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk
+		r.chunks++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.bytes += int64(n)
+	return n, nil
+}
+
+var _ io.Reader = (*uploadReader)(nil)
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStalePartialUploads(t *testing.T) {
+	ownerDir := filepath.Join(storageRoot, "stale-partials")
+	if err := os.MkdirAll(ownerDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	files := []struct {
+		name    string
+		old     bool
+		removed bool
+	}{
+		{name: partialPrefix + "crashed", old: true, removed: true},
+		{name: partialPrefix + "in-progress"},
+		{name: "f1.txt", old: true},
+		{name: ".healthcheck-1", old: true},
+	}
+	for _, f := range files {
+		path := filepath.Join(ownerDir, f.name)
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if f.old {
+			if err := os.Chtimes(path, old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	removed, err := RemoveStalePartialUploads(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != 1 {
+		t.Errorf("removed %d files, want 1", removed)
+	}
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(ownerDir, f.name))
+		if gone := os.IsNotExist(err); gone != f.removed {
+			t.Errorf("%s removed = %v, want %v", f.name, gone, f.removed)
+		}
+	}
+}
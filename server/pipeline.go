@@ -0,0 +1,480 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Etapas del pipeline de procesamiento de las subidas
+const (
+	StageValidate  = "validate"
+	StageSniff     = "sniff"
+	StageHash      = "hash"
+	StageScan      = "scan"
+	StageMedia     = "media"
+	StageIndex     = "index"
+	StageThumbnail = "thumbnail"
+)
+
+var stageNames = []string{StageValidate, StageSniff, StageHash, StageScan, StageMedia, StageIndex, StageThumbnail}
+
+// DefaultPipeline procesa todo antes de responder a Upload salvo las
+// miniaturas, que se generan en segundo plano.
+const DefaultPipeline = "validate,sniff,hash,scan,media,index,thumbnail:async"
+
+// StageConfig es una etapa configurada del pipeline.
+type StageConfig struct {
+	Name  string
+	Async bool
+}
+
+// ParsePipeline interpreta una lista de etapas separadas por comas, como
+// "validate,sniff,scan,thumbnail:async". Las etapas síncronas se ejecutan en
+// orden antes de responder a Upload y las marcadas con ":async" después, en
+// segundo plano. validate se aplica antes de guardar el archivo y no puede
+// ser asíncrona.
+func ParsePipeline(list string) ([]StageConfig, error) {
+	stages := []StageConfig{}
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		name, mode, _ := strings.Cut(field, ":")
+		if !slices.Contains(stageNames, name) {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate stage %q", name)
+		}
+		seen[name] = true
+		switch mode {
+		case "", "sync":
+		case "async":
+			if name == StageValidate {
+				return nil, errors.New("stage validate cannot be async")
+			}
+		default:
+			return nil, fmt.Errorf("invalid mode %q for stage %s", mode, name)
+		}
+		stages = append(stages, StageConfig{Name: name, Async: mode == "async"})
+	}
+	return stages, nil
+}
+
+// ValidationRules son las comprobaciones de la etapa validate.
+type ValidationRules struct {
+	// Tamaño máximo del archivo guardado (0 = sin límite)
+	MaxSize int64
+	// Extensiones rechazadas, en minúsculas y con punto (".exe")
+	BlockedExtensions []string
+}
+
+// stage es una etapa activa del pipeline. run modifica el registro en
+// memoria; el pipeline se encarga de guardarlo.
+type stage struct {
+	name  string
+	async bool
+	// Si una etapa requerida falla se omiten las siguientes; el fallo de una
+	// opcional solo queda registrado
+	required bool
+	run      func(ctx context.Context, f *metadata.File, filePath string) error
+	// abandon deja el registro en un estado seguro cuando la etapa no se va
+	// a completar
+	abandon func(f *metadata.File)
+}
+
+// pipeline son las etapas activas: primero las síncronas, después las
+// asíncronas, cada grupo en el orden configurado.
+type pipeline struct {
+	validate bool
+	stages   []stage
+}
+
+// stage retorna la etapa activa con ese nombre.
+func (p *pipeline) stage(name string) (stage, bool) {
+	i := slices.IndexFunc(p.stages, func(st stage) bool { return st.name == name })
+	if i < 0 {
+		return stage{}, false
+	}
+	return p.stages[i], true
+}
+
+func (p *pipeline) hasAsync() bool {
+	return slices.ContainsFunc(p.stages, func(st stage) bool { return st.async })
+}
+
+// buildPipeline activa las etapas configuradas. Se omiten las que dependen
+// de un componente deshabilitado (antivirus, índice o miniaturas) y, sin cola
+// de trabajos, las asíncronas se ejecutan de forma síncrona.
+func (s *FileService) buildPipeline(configs []StageConfig) {
+	var syncStages, asyncStages []stage
+	for _, c := range configs {
+		st := stage{name: c.Name, async: c.Async && s.jobs != nil}
+		switch c.Name {
+		case StageValidate:
+			s.pipeline.validate = true
+			continue
+		case StageSniff:
+			st.run = s.sniffStage
+		case StageHash:
+			st.run = s.hashStage
+		case StageScan:
+			if s.scanner == nil {
+				continue
+			}
+			st.run, st.required, st.abandon = s.scanStage, true, abandonScan
+		case StageMedia:
+			st.run = s.mediaStage
+		case StageIndex:
+			if s.index == nil {
+				continue
+			}
+			st.run = s.indexStage
+		case StageThumbnail:
+			if s.thumbnails == nil {
+				continue
+			}
+			st.run = s.thumbnailStage
+		}
+		if st.async {
+			asyncStages = append(asyncStages, st)
+		} else {
+			syncStages = append(syncStages, st)
+		}
+	}
+	s.pipeline.stages = append(syncStages, asyncStages...)
+}
+
+// newProcessing crea el estado inicial del pipeline para una subida.
+func (p *pipeline) newProcessing() *metadata.Processing {
+	var id [16]byte
+	rand.Read(id[:])
+	proc := &metadata.Processing{UploadID: hex.EncodeToString(id[:])}
+	now := time.Now().UTC()
+	if p.validate {
+		proc.Stages = append(proc.Stages, metadata.StageState{Name: StageValidate, Status: metadata.StagePending, UpdatedAt: now})
+	}
+	for _, st := range p.stages {
+		proc.Stages = append(proc.Stages, metadata.StageState{Name: st.name, Async: st.async, Status: metadata.StagePending, UpdatedAt: now})
+	}
+	return proc
+}
+
+// skipError indica que la etapa no aplica al archivo.
+type skipError struct{ reason error }
+
+func (e *skipError) Error() string { return e.reason.Error() }
+
+func skip(reason error) error { return &skipError{reason} }
+
+// permanentError es un fallo que no se resuelve reintentando, como un
+// archivo infectado.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func permanent(err error) error { return &permanentError{err} }
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// unwrapStatus busca un error de gRPC dentro de err, para usarlo sin los
+// prefijos que se le agregaron al envolverlo.
+func unwrapStatus(err error) (*status.Status, bool) {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus(), true
+	}
+	return nil, false
+}
+
+// errorMessage retorna el mensaje que se guarda en el estado de una etapa.
+func errorMessage(err error) string {
+	if st, ok := unwrapStatus(err); ok {
+		return st.Message()
+	}
+	return err.Error()
+}
+
+// errStaleJob indica que el archivo se volvió a subir después de agendar el
+// trabajo: su resultado ya no corresponde al contenido guardado.
+var errStaleJob = errors.New("file was uploaded again")
+
+// runStage ejecuta una etapa y registra el resultado en el estado del
+// pipeline. last indica que no habrá otro intento.
+func runStage(ctx context.Context, st stage, f *metadata.File, filePath string, last bool) error {
+	ctx, span := tracer.Start(ctx, "pipeline."+st.name, trace.WithAttributes(attrOwner.String(f.OwnerID), attrFileID.String(f.FileID)))
+	err := st.run(ctx, f, filePath)
+
+	state := f.Processing.Stage(st.name)
+	state.UpdatedAt = time.Now().UTC()
+	var skipped *skipError
+	if errors.As(err, &skipped) {
+		span.SetAttributes(attrSkipReason.String(err.Error()))
+		span.End()
+		state.Status, state.Error = metadata.StageSkipped, errorMessage(err)
+		metrics.ObservePipelineStage(st.name, metrics.StageSkipped)
+		return nil
+	}
+	endSpan(span, err)
+	switch {
+	case err == nil:
+		state.Status, state.Error = metadata.StageDone, ""
+		metrics.ObservePipelineStage(st.name, metrics.StageDone)
+	case !last && !isPermanent(err):
+		state.Attempts++
+		state.Error = errorMessage(err)
+		metrics.ObservePipelineStage(st.name, metrics.StageRetry)
+	default:
+		state.Attempts++
+		state.Status, state.Error = metadata.StageFailed, errorMessage(err)
+		metrics.ObservePipelineStage(st.name, metrics.StageFailed)
+	}
+	return err
+}
+
+// runStages ejecuta las etapas pendientes del grupo indicado (síncronas o
+// asíncronas), llamando a save después de cada una si no es nil. Ante un
+// fallo que se puede reintentar retorna enseguida y deja la etapa pendiente.
+// Si falla una etapa requerida, o el fallo es permanente, las etapas que
+// quedan se marcan omitidas y se retorna el error; el de una etapa opcional
+// solo queda registrado.
+func (s *FileService) runStages(ctx context.Context, f *metadata.File, filePath string, async, last bool, save func() error) error {
+	for _, st := range s.pipeline.stages {
+		state := f.Processing.Stage(st.name)
+		if st.async != async || state == nil || state.Status != metadata.StagePending {
+			continue
+		}
+		err := runStage(ctx, st, f, filePath, last)
+		stop := err != nil && (state.Status == metadata.StagePending || st.required || isPermanent(err))
+		if stop && state.Status == metadata.StageFailed {
+			s.abandonStages(f, err)
+		}
+		if save != nil {
+			if saveErr := save(); saveErr != nil {
+				return saveErr
+			}
+		}
+		if stop {
+			return err
+		}
+	}
+	return nil
+}
+
+// abandonStages marca como omitidas las etapas pendientes después de un
+// fallo que detiene el pipeline.
+func (s *FileService) abandonStages(f *metadata.File, cause error) {
+	now := time.Now().UTC()
+	for _, st := range s.pipeline.stages {
+		if st.abandon != nil {
+			st.abandon(f)
+		}
+		state := f.Processing.Stage(st.name)
+		if state != nil && state.Status == metadata.StagePending {
+			state.Status = metadata.StageSkipped
+			state.Error = "previous stage failed: " + errorMessage(cause)
+			state.UpdatedAt = now
+		}
+	}
+}
+
+// processingJob es el trabajo que ejecuta las etapas asíncronas de una subida.
+type processingJob struct {
+	OwnerID  string `json:"owner_id"`
+	FileID   string `json:"file_id"`
+	UploadID string `json:"upload_id"`
+}
+
+// enqueueProcessing agenda las etapas asíncronas de una subida ya guardada.
+// Si no se puede, las etapas quedan como fallidas.
+func (s *FileService) enqueueProcessing(ctx context.Context, f *metadata.File) {
+	if !s.pipeline.hasAsync() {
+		return
+	}
+	_, err := s.jobs.Enqueue(processingJob{OwnerID: f.OwnerID, FileID: f.FileID, UploadID: f.Processing.UploadID})
+	if err == nil {
+		return
+	}
+	slog.ErrorContext(ctx, "Failed to enqueue upload processing", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+	now := time.Now().UTC()
+	for i := range f.Processing.Stages {
+		if state := &f.Processing.Stages[i]; state.Async && state.Status == metadata.StagePending {
+			state.Status, state.Error, state.UpdatedAt = metadata.StageFailed, err.Error(), now
+		}
+	}
+	for _, st := range s.pipeline.stages {
+		if st.async && st.abandon != nil {
+			st.abandon(f)
+		}
+	}
+	if err := s.saveProcessing(f); err != nil {
+		slog.ErrorContext(ctx, "Failed to save upload processing status", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+	}
+}
+
+// ProcessJob ejecuta las etapas asíncronas de una subida. Es el Handler de la
+// cola de trabajos.
+func (s *FileService) ProcessJob(ctx context.Context, job queue.Job, last bool) error {
+	var j processingJob
+	if err := json.Unmarshal(job.Payload, &j); err != nil {
+		slog.ErrorContext(ctx, "Discarding invalid processing job", "job_id", job.ID, "error", err)
+		return nil
+	}
+	f, err := s.store.LoadFile(j.OwnerID, j.FileID)
+	if errors.Is(err, metadata.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if f.Processing == nil || f.Processing.UploadID != j.UploadID {
+		return nil
+	}
+
+	filePath := filepath.Join(storageRoot, f.OwnerID, f.StorageName)
+	err = s.runStages(ctx, f, filePath, true, last, func() error { return s.saveProcessing(f) })
+	if errors.Is(err, errStaleJob) || isPermanent(err) {
+		return nil
+	}
+	return err
+}
+
+// saveProcessing guarda los campos que escriben las etapas, sin pisar los
+// cambios hechos mientras tanto al registro (nombre, carpeta, atributos).
+func (s *FileService) saveProcessing(f *metadata.File) error {
+	return s.store.UpdateFile(f.OwnerID, f.FileID, func(cur *metadata.File) error {
+		if cur.Processing == nil || cur.Processing.UploadID != f.Processing.UploadID {
+			return errStaleJob
+		}
+		cur.StorageName = f.StorageName
+		cur.DetectedContentType = f.DetectedContentType
+		cur.SHA256 = f.SHA256
+		cur.Media = f.Media
+		cur.ScanStatus = f.ScanStatus
+		cur.ScanSignature = f.ScanSignature
+		cur.Processing = f.Processing
+		return nil
+	})
+}
+
+// validateUpload aplica la etapa validate a un archivo ya escrito pero
+// todavía no visible.
+func (s *FileService) validateUpload(f *metadata.File) error {
+	err := s.validation.check(f)
+	state := f.Processing.Stage(StageValidate)
+	state.UpdatedAt = time.Now().UTC()
+	if err != nil {
+		state.Status, state.Error = metadata.StageFailed, errorMessage(err)
+		metrics.ObservePipelineStage(StageValidate, metrics.StageFailed)
+		return err
+	}
+	state.Status = metadata.StageDone
+	metrics.ObservePipelineStage(StageValidate, metrics.StageDone)
+	return nil
+}
+
+func (r ValidationRules) check(f *metadata.File) error {
+	if r.MaxSize > 0 && f.Size > r.MaxSize {
+		return status.Errorf(codes.InvalidArgument, "file exceeds the maximum size of %d bytes", r.MaxSize)
+	}
+	if ext := strings.ToLower(filepath.Ext(f.OriginalName)); ext != "" && slices.Contains(r.BlockedExtensions, ext) {
+		return status.Errorf(codes.InvalidArgument, "files with extension %s are not allowed", ext)
+	}
+	return nil
+}
+
+// Cantidad de bytes que usa http.DetectContentType
+const sniffLen = 512
+
+// sniffStage detecta el tipo MIME por los bytes mágicos del archivo.
+func (s *FileService) sniffStage(ctx context.Context, f *metadata.File, filePath string) error {
+	file, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		metrics.StorageError(metrics.StorageErrRead)
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	f.DetectedContentType = http.DetectContentType(head[:n])
+	return nil
+}
+
+// hashStage calcula el SHA-256 del contenido guardado, sin cifrar.
+func (s *FileService) hashStage(ctx context.Context, f *metadata.File, filePath string) error {
+	file, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		metrics.StorageError(metrics.StorageErrRead)
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	f.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+// GetProcessingStatus retorna el estado de cada etapa del pipeline para la
+// última subida de un archivo.
+func (s *FileService) GetProcessingStatus(ctx context.Context, req *pb.GetProcessingStatusRequest) (*pb.GetProcessingStatusResponse, error) {
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+	resp := &pb.GetProcessingStatusResponse{FileId: record.FileID, Status: metadata.StageDone}
+	if record.Processing == nil {
+		return resp, nil
+	}
+	resp.UploadId = record.Processing.UploadID
+	for _, st := range record.Processing.Stages {
+		switch {
+		case st.Status == metadata.StagePending:
+			resp.Status = metadata.StagePending
+		case st.Status == metadata.StageFailed && resp.Status != metadata.StagePending:
+			resp.Status = metadata.StageFailed
+		}
+		resp.Stages = append(resp.Stages, &pb.ProcessingStage{
+			Name:      st.Name,
+			Async:     st.Async,
+			Status:    st.Status,
+			Attempts:  int32(st.Attempts),
+			Error:     st.Error,
+			UpdatedAt: timestamppb.New(st.UpdatedAt),
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Subdirectorio oculto del propietario donde se aíslan los archivos infectados
+const quarantineDir = ".quarantine"
+
+// scanStage analiza un archivo recién guardado, o el temporal de una subida
+// que todavía no es visible. Si está infectado lo mueve a cuarentena y falla
+// de forma permanente con FailedPrecondition.
+func (s *FileService) scanStage(ctx context.Context, f *metadata.File, filePath string) error {
+	_, span := startStorageSpan(ctx, "scan", attrPath.String(filePath))
+	file, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		endSpan(span, err)
+		return fmt.Errorf("failed to open file to scan: %w", err)
+	}
+	result, err := s.scanner.Scan(ctx, file)
+	file.Close()
+	endSpan(span, err)
+
+	switch {
+	case err != nil:
+		// El archivo sigue pendiente hasta el próximo intento o hasta que el
+		// pipeline lo abandone
+		metrics.ObserveScan(metrics.ScanError)
+		return status.Errorf(codes.Unavailable, "malware scan failed: %v", err)
+
+	case result.Infected:
+		metrics.ObserveScan(metrics.ScanInfected)
+		slog.WarnContext(ctx, "Malware detected in upload, quarantining file",
+			"owner_id", f.OwnerID, "file_id", f.FileID, "signature", result.Signature)
+		// Un archivo ya guardado pudo haberse indexado antes del análisis
+		if filepath.Base(filePath) == f.StorageName {
+			s.unindexFile(ctx, f.OwnerID, f.FileID)
+		}
+		f.StorageName = quarantine(ctx, f.OwnerID, filePath, f.StorageName)
+		f.ScanStatus = metadata.ScanInfected
+		f.ScanSignature = result.Signature
+		return permanent(status.Errorf(codes.FailedPrecondition, "file rejected: malware detected (%s)", result.Signature))
+	}
+
+	metrics.ObserveScan(metrics.ScanClean)
+	f.ScanStatus = metadata.ScanClean
+	return nil
+}
+
+// scanUpload ejecuta la etapa scan síncrona sobre el archivo temporal de una
+// subida, antes de hacerlo visible. Si se rechaza, solo un archivo nuevo
+// queda registrado como infectado: al volver a subir uno existente se
+// conservan la versión anterior y su registro.
+func (s *FileService) scanUpload(ctx context.Context, st stage, f, previous *metadata.File, tmpPath string) error {
+	err := runStage(ctx, st, f, tmpPath, true)
+	if err == nil {
+		return nil
+	}
+	s.abandonStages(f, err)
+	if f.ScanStatus == metadata.ScanInfected && previous == nil {
+		if err := s.store.PutFile(f); err != nil {
+			return storeError(err)
+		}
+	}
+	return err
+}
+
+// abandonScan deja sin descargar un archivo cuyo análisis no se completó.
+func abandonScan(f *metadata.File) {
+	if f.ScanStatus == metadata.ScanPending {
+		f.ScanStatus = metadata.ScanFailed
+	}
+}
+
+// quarantine mueve el archivo filePath al directorio de cuarentena del
+// propietario con el nombre storageName y retorna su nuevo nombre relativo.
+// Si no puede moverlo, lo elimina: el registro ya impide descargarlo, pero no
+// debe quedar a la vista en el NFS.
+func quarantine(ctx context.Context, owner, filePath, storageName string) string {
+	ownerDir := filepath.Join(storageRoot, owner)
+	name := filepath.Join(quarantineDir, storageName)
+	err := os.MkdirAll(filepath.Join(ownerDir, quarantineDir), 0700)
+	if err == nil {
+		err = os.Rename(filePath, filepath.Join(ownerDir, name))
+	}
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrRename)
+		slog.ErrorContext(ctx, "Failed to quarantine file, removing it", "owner_id", owner, "file", storageName, "error", err)
+		os.Remove(filePath)
+	}
+	return name
+}
+
+// pendingScans son las subidas cuyo contenido nuevo ya está en su ruta final
+// pero cuyo registro, pendiente del análisis asíncrono, todavía no se guardó.
+type pendingScans struct {
+	mu sync.Mutex
+	// Subidas en curso de cada archivo
+	files map[string]int
+}
+
+func (p *pendingScans) add(owner, fileID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.files == nil {
+		p.files = make(map[string]int)
+	}
+	p.files[owner+"/"+fileID]++
+}
+
+// remove deshace un add.
+func (p *pendingScans) remove(owner, fileID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := owner + "/" + fileID
+	if p.files[key] <= 1 {
+		delete(p.files, key)
+		return
+	}
+	p.files[key]--
+}
+
+func (p *pendingScans) has(owner, fileID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.files[owner+"/"+fileID] > 0
+}
+
+// checkScanStatus impide entregar archivos que no pasaron el análisis de
+// malware. Los archivos sin estado se subieron sin análisis y se permiten.
+func (s *FileService) checkScanStatus(f *metadata.File) error {
+	if s.scanning.has(f.OwnerID, f.FileID) {
+		return status.Error(codes.FailedPrecondition, "file is pending malware scan")
+	}
+	switch f.ScanStatus {
+	case metadata.ScanPending:
+		return status.Error(codes.FailedPrecondition, "file is pending malware scan")
+	case metadata.ScanFailed:
+		return status.Error(codes.FailedPrecondition, "file could not be scanned for malware")
+	case metadata.ScanInfected:
+		return status.Errorf(codes.FailedPrecondition, "file is quarantined: malware detected (%s)", f.ScanSignature)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/scan"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Archivo de prueba EICAR, partido para que este archivo no lo contenga
+var eicar = []byte(`X5O!P%@AP[4\PZX54(P^)7CC)7}$` + `EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`)
+
+// fakeClamd atiende PING e INSTREAM como clamd y detecta solo la firma
+// EICAR. Retorna la dirección para scan.NewClamd.
+func fakeClamd(t *testing.T, network string) string {
+	t.Helper()
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveClamd(conn)
+		}
+	}()
+	return network + "://" + ln.Addr().String()
+}
+
+func serveClamd(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	cmd, err := r.ReadString(0)
+	if err != nil {
+		return
+	}
+	switch cmd {
+	case "zPING\x00":
+		conn.Write([]byte("PONG\x00"))
+	case "zINSTREAM\x00":
+		var data []byte
+		for {
+			var size uint32
+			if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+				return
+			}
+			if size == 0 {
+				break
+			}
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return
+			}
+			data = append(data, chunk...)
+		}
+		if bytes.Contains(data, eicar) {
+			conn.Write([]byte("stream: " + scan.EICARName + " FOUND\x00"))
+		} else {
+			conn.Write([]byte("stream: OK\x00"))
+		}
+	}
+}
+
+func clamdScanner(t *testing.T, addr string) scan.Scanner {
+	t.Helper()
+	c, err := scan.NewClamd(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestScanOnUpload(t *testing.T) {
+	ctx := context.Background()
+	scanners := []struct {
+		name    string
+		scanner func(t *testing.T) scan.Scanner
+	}{
+		{"eicar", func(*testing.T) scan.Scanner { return scan.EICAR{} }},
+		{"clamd tcp", func(t *testing.T) scan.Scanner { return clamdScanner(t, fakeClamd(t, "tcp")) }},
+		{"clamd unix", func(t *testing.T) scan.Scanner { return clamdScanner(t, fakeClamd(t, "unix")) }},
+	}
+	uploads := []struct {
+		name    string
+		content []byte
+		// Código de Upload y de Download después de subirlo
+		uploadCode, downloadCode codes.Code
+		quarantined              bool
+	}{
+		{name: "clean", content: []byte("just text"), uploadCode: codes.OK, downloadCode: codes.OK},
+		{name: "eicar", content: eicar, uploadCode: codes.FailedPrecondition, downloadCode: codes.FailedPrecondition, quarantined: true},
+		{name: "eicar inside", content: append(append([]byte("prefix "), eicar...), " suffix"...), uploadCode: codes.FailedPrecondition, downloadCode: codes.FailedPrecondition, quarantined: true},
+	}
+	for i, sc := range scanners {
+		t.Run(sc.name, func(t *testing.T) {
+			c := newTestClient(t, WithScanner(sc.scanner(t)))
+			// Cada escáner usa su propio propietario: el NFS es compartido
+			owner := fmt.Sprint("scan", i)
+			for j, up := range uploads {
+				t.Run(up.name, func(t *testing.T) {
+					fileID := fmt.Sprint("f", j)
+					_, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: fileID, FileName: fileID + ".txt"}, up.content)
+					if got := status.Code(err); got != up.uploadCode {
+						t.Fatalf("Upload code = %s, want %s (%v)", got, up.uploadCode, err)
+					}
+					content, err := servertest.Download(ctx, c, &pb.FileDownloadRequest{OwnerId: owner, FileId: fileID})
+					if got := status.Code(err); got != up.downloadCode {
+						t.Fatalf("Download code = %s, want %s (%v)", got, up.downloadCode, err)
+					}
+					if err == nil && !bytes.Equal(content, up.content) {
+						t.Errorf("Download = %q, want %q", content, up.content)
+					}
+
+					ownerDir := filepath.Join(storageRoot, owner)
+					_, errStored := os.Stat(filepath.Join(ownerDir, fileID+".txt"))
+					_, errQuarantined := os.Stat(filepath.Join(ownerDir, quarantineDir, fileID+".txt"))
+					if up.quarantined && (errStored == nil || errQuarantined != nil) {
+						t.Errorf("infected file not moved to quarantine (stored: %v, quarantined: %v)", errStored, errQuarantined)
+					}
+					if !up.quarantined && (errStored != nil || errQuarantined == nil) {
+						t.Errorf("clean file not stored (stored: %v, quarantined: %v)", errStored, errQuarantined)
+					}
+				})
+			}
+		})
+	}
+}
+
+// Si clamd no responde, la subida falla sin guardar el archivo.
+func TestScanUnavailable(t *testing.T) {
+	ctx := context.Background()
+	addr := fakeClamd(t, "tcp")
+	scanner := clamdScanner(t, addr)
+	// Cerrar el listener deja la dirección sin nadie escuchando
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down := clamdScanner(t, "tcp://"+ln.Addr().String())
+	ln.Close()
+
+	tests := []struct {
+		name                     string
+		scanner                  scan.Scanner
+		uploadCode, downloadCode codes.Code
+	}{
+		{"reachable", scanner, codes.OK, codes.OK},
+		{"down", down, codes.Unavailable, codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, WithScanner(tt.scanner))
+			owner := "unavailable-" + tt.name
+			_, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: "f", FileName: "f.txt"}, []byte("content"))
+			if got := status.Code(err); got != tt.uploadCode {
+				t.Fatalf("Upload code = %s, want %s (%v)", got, tt.uploadCode, err)
+			}
+			_, err = servertest.Download(ctx, c, &pb.FileDownloadRequest{OwnerId: owner, FileId: "f"})
+			if got := status.Code(err); got != tt.downloadCode {
+				t.Fatalf("Download code = %s, want %s (%v)", got, tt.downloadCode, err)
+			}
+		})
+	}
+}
+
+// Una versión nueva infectada se rechaza antes de reemplazar la anterior,
+// tenga o no la misma extensión.
+func TestScanRejectedReupload(t *testing.T) {
+	ctx := context.Background()
+	store := servertest.OpenStore(t)
+	c := newStoreClient(t, store, WithScanner(scan.EICAR{}))
+	clean := []byte("first version")
+
+	tests := []struct {
+		name string
+		// Nombre de la versión infectada
+		fileName string
+	}{
+		{"same extension", "f.txt"},
+		{"other extension", "f.bin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner := "reupload-" + strings.ReplaceAll(tt.name, " ", "-")
+			if _, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: "f", FileName: "f.txt"}, clean); err != nil {
+				t.Fatal(err)
+			}
+			_, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: "f", FileName: tt.fileName}, eicar)
+			if got := status.Code(err); got != codes.FailedPrecondition {
+				t.Fatalf("Upload code = %s, want FailedPrecondition (%v)", got, err)
+			}
+
+			content, err := servertest.Download(ctx, c, &pb.FileDownloadRequest{OwnerId: owner, FileId: "f"})
+			if err != nil {
+				t.Fatalf("previous version not downloadable: %v", err)
+			}
+			if !bytes.Equal(content, clean) {
+				t.Errorf("Download = %q, want %q", content, clean)
+			}
+			ownerDir := filepath.Join(storageRoot, owner)
+			if _, err := os.Stat(filepath.Join(ownerDir, tt.fileName)); tt.fileName != "f.txt" && err == nil {
+				t.Errorf("infected version stored as %s", tt.fileName)
+			}
+			if _, err := os.Stat(filepath.Join(ownerDir, quarantineDir, tt.fileName)); err != nil {
+				t.Errorf("infected version not quarantined: %v", err)
+			}
+			// Solo la primera subida modifica el árbol, una sola vez
+			changes, err := store.Changes(owner, 0, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != 1 {
+				t.Errorf("%d changes logged, want 1", len(changes))
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/search"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Cantidad de resultados por defecto y máxima de SearchFiles
+const (
+	defaultSearchLimit = 50
+	maxSearchLimit     = 500
+)
+
+var errNotIndexable = errors.New("file is not a text document")
+
+// SearchFiles busca entre los archivos visibles del propietario. Como no hay
+// archivos compartidos, el alcance es siempre el árbol de owner_id.
+func (s *FileService) SearchFiles(ctx context.Context, req *pb.SearchFilesRequest) (*pb.SearchFilesResponse, error) {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return nil, err
+	}
+	if req.Text != "" && s.index == nil {
+		return nil, status.Error(codes.FailedPrecondition, "full-text search is not enabled")
+	}
+	folderID, err := s.folderRef(req.OwnerId, req.FolderId, req.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentScores map[string]float64
+	if req.Text != "" {
+		contentScores, err = s.index.Match(req.OwnerId, req.Text)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to query search index: %v", err)
+		}
+	}
+
+	files, err := s.store.FindFiles(req.OwnerId, metadata.Query{
+		FolderID:  folderID,
+		Recursive: true,
+		Tags:      req.Tags,
+	})
+	if err != nil {
+		return nil, storeError(err)
+	}
+
+	var results []*pb.SearchResult
+	for _, f := range files {
+		if !matchesSearchFilters(f, req) {
+			continue
+		}
+		result := &pb.SearchResult{}
+		if req.Name != "" {
+			score, ok := search.MatchName(f.Name, req.Name, search.NameMode(req.NameMatch))
+			if !ok {
+				continue
+			}
+			result.Score += score
+			result.NameMatched = true
+		}
+		if req.Text != "" {
+			score, ok := contentScores[f.FileID]
+			if !ok {
+				continue
+			}
+			result.Score += score
+			result.ContentMatched = true
+		}
+
+		path, err := s.store.FilePath(f)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		result.File = newFileEntryProto(f, path)
+		results = append(results, result)
+	}
+
+	// Mejor puntaje primero; a igual puntaje, el más reciente
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].File.ModifiedAt.AsTime().After(results[j].File.ModifiedAt.AsTime())
+	})
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	limit = min(limit, maxSearchLimit)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return &pb.SearchFilesResponse{Results: results}, nil
+}
+
+func matchesSearchFilters(f *metadata.File, req *pb.SearchFilesRequest) bool {
+	if f.Size < req.MinSize || (req.MaxSize > 0 && f.Size > req.MaxSize) {
+		return false
+	}
+	if req.ContentType != "" &&
+		!strings.HasPrefix(f.ContentType, req.ContentType) &&
+		!strings.HasPrefix(f.DetectedContentType, req.ContentType) {
+		return false
+	}
+	if req.ModifiedAfter != nil && f.ModifiedAt.Before(req.ModifiedAfter.AsTime()) {
+		return false
+	}
+	if req.ModifiedBefore != nil && !f.ModifiedAt.Before(req.ModifiedBefore.AsTime()) {
+		return false
+	}
+	return true
+}
+
+// indexFile agrega el contenido de un archivo de texto al índice. Los errores
+// no afectan la operación: el archivo simplemente no aparece en búsquedas de
+// contenido.
+func (s *FileService) indexFile(ctx context.Context, f *metadata.File) {
+	if s.index == nil {
+		return
+	}
+	var skipped *skipError
+	if err := s.indexContent(ctx, f); err != nil && !errors.As(err, &skipped) {
+		slog.WarnContext(ctx, "Failed to index file", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+	}
+}
+
+// indexStage indexa el contenido de un archivo recién subido.
+func (s *FileService) indexStage(ctx context.Context, f *metadata.File, filePath string) error {
+	if f.Trashed() {
+		return skip(metadata.ErrTrashed)
+	}
+	return s.indexContent(ctx, f)
+}
+
+// indexContent reemplaza el contenido indexado del archivo. Los archivos que
+// no son de texto se quitan del índice.
+func (s *FileService) indexContent(ctx context.Context, f *metadata.File) error {
+	if !search.Indexable(f.OriginalName, f.DetectedContentType) && !search.Indexable(f.OriginalName, f.ContentType) {
+		if err := s.index.Remove(f.OwnerID, f.FileID); err != nil {
+			return fmt.Errorf("failed to remove file from search index: %w", err)
+		}
+		return skip(errNotIndexable)
+	}
+
+	_, span := startStorageSpan(ctx, "index", attrOwner.String(f.OwnerID), attrFileID.String(f.FileID))
+	defer span.End()
+
+	file, err := s.openContent(ctx, f, filepath.Join(storageRoot, f.OwnerID, f.StorageName))
+	if err != nil {
+		return fmt.Errorf("failed to open file for indexing: %w", err)
+	}
+	defer file.Close()
+
+	text, err := search.ExtractText(file, f.OriginalName, f.DetectedContentType)
+	if err != nil {
+		return err
+	}
+	return s.index.Put(f.OwnerID, f.FileID, text)
+}
+
+// unindexFile quita un archivo del índice de texto completo.
+func (s *FileService) unindexFile(ctx context.Context, owner, fileID string) {
+	if s.index == nil {
+		return
+	}
+	if err := s.index.Remove(owner, fileID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove file from search index", "owner_id", owner, "file_id", fileID, "error", err)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(servertest.Main(m))
+}
+
+// newTestClient levanta un FileService con las opciones dadas sobre una
+// conexión en memoria.
+func newTestClient(t *testing.T, opts ...Option) pb.FileServiceClient {
+	t.Helper()
+	return newStoreClient(t, servertest.OpenStore(t), opts...)
+}
+
+// newStoreClient es newTestClient sobre un almacén de metadatos dado, para
+// inspeccionarlo en la prueba.
+func newStoreClient(t *testing.T, store *metadata.Store, opts ...Option) pb.FileServiceClient {
+	t.Helper()
+	conn := servertest.Dial(t, func(s *grpc.Server) {
+		pb.RegisterFileServiceServer(s, NewFileService(store, opts...))
+	})
+	return pb.NewFileServiceClient(conn)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"errors"
+	"os"
+)
+
+// errDiskUsageUnsupported indica que la plataforma no permite leer el uso del
+// disco.
+var errDiskUsageUnsupported = errors.New("disk usage is only supported on linux")
+
+// DiskUsage contiene el espacio total, libre y usado de un sistema de archivos.
+type DiskUsage struct {
+	Total uint64
+	Free  uint64
+	Used  uint64
+}
+
+// StorageUsage retorna el espacio total, libre y usado de la raíz de almacenamiento.
+func StorageUsage() (DiskUsage, error) {
+	return diskUsageOf(storageRoot)
+}
+
+// EnsureStorageRoot crea la raíz de almacenamiento si no existe.
+func EnsureStorageRoot() error {
+	return os.MkdirAll(storageRoot, 0755)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/thumbnail"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func (s *FileService) GetThumbnail(ctx context.Context, req *pb.GetThumbnailRequest) (*pb.GetThumbnailResponse, error) {
+	if s.thumbnails == nil {
+		return nil, status.Error(codes.FailedPrecondition, "thumbnails are not enabled")
+	}
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkScanStatus(record); err != nil {
+		return nil, err
+	}
+
+	size := thumbnailSize(s.thumbnails.Sizes(), int(req.Size))
+	ownerDir := filepath.Join(storageRoot, record.OwnerID)
+	path, contentType, ok := thumbnail.Find(ownerDir, record.FileID, size)
+	if !ok {
+		return nil, missingThumbnail(record)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to read thumbnail: %v", err)
+	}
+	if record.Encryption != nil {
+		data, err = s.decrypt(ctx, record, data)
+		// Una miniatura que no se descifra con la clave del archivo es de
+		// una versión anterior que todavía no se borró. No se borra acá: el
+		// registro leído también puede ser el anterior a la miniatura.
+		if status.Code(err) == codes.DataLoss {
+			slog.WarnContext(ctx, "Ignoring stale thumbnail", "owner_id", record.OwnerID, "file_id", record.FileID, "size", size, "error", err)
+			return nil, missingThumbnail(record)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &pb.GetThumbnailResponse{
+		FileId:      record.FileID,
+		Size:        int32(size),
+		ContentType: contentType,
+		Data:        data,
+	}, nil
+}
+
+// missingThumbnail es el error de GetThumbnail cuando el archivo no tiene
+// miniatura: Unavailable si todavía se está generando, NotFound si no.
+func missingThumbnail(f *metadata.File) error {
+	if st := f.Processing.Stage(StageThumbnail); st != nil && st.Status == metadata.StagePending {
+		return status.Error(codes.Unavailable, "thumbnail is still being generated")
+	}
+	return status.Error(codes.NotFound, "no thumbnail available for this file")
+}
+
+// thumbnailSize elige el menor tamaño configurado que no sea menor que el
+// pedido, o el mayor si se pidió más de lo disponible.
+func thumbnailSize(sizes []int, requested int) int {
+	for _, size := range sizes {
+		if size >= requested {
+			return size
+		}
+	}
+	return sizes[len(sizes)-1]
+}
+
+// thumbnailStage genera las miniaturas de una imagen subida.
+func (s *FileService) thumbnailStage(ctx context.Context, f *metadata.File, filePath string) error {
+	if !strings.HasPrefix(f.DetectedContentType, "image/") {
+		return skip(thumbnail.ErrNotImage)
+	}
+	file, err := s.openContent(ctx, f, filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// Las de otra versión ya se borraron al guardarla, pero una en otro
+	// formato quedaría y Find podría elegirla
+	if err := thumbnail.Remove(filepath.Join(storageRoot, f.OwnerID), f.FileID); err != nil {
+		return fmt.Errorf("failed to remove old thumbnails: %w", err)
+	}
+	// Las miniaturas de un archivo cifrado se cifran con su misma clave
+	var seal thumbnail.Seal
+	if f.Encryption != nil {
+		key, err := s.dataKey(ctx, f)
+		if err != nil {
+			return err
+		}
+		seal = func(w io.Writer) (io.WriteCloser, error) { return encryption.NewWriter(w, key) }
+	}
+	err = s.thumbnails.Process(file, filepath.Join(storageRoot, f.OwnerID), f.FileID, seal)
+	if errors.Is(err, thumbnail.ErrNotImage) || errors.Is(err, thumbnail.ErrTooLarge) {
+		return skip(err)
+	}
+	return err
+}
+
+// removeThumbnails borra las miniaturas de un archivo cuando dejan de
+// corresponder a su contenido: al guardar una versión nueva y al moverlo a la
+// papelera, solo o con su carpeta (Restore las genera de nuevo). Las de
+// EraseOwner se van con el directorio del propietario.
+func (s *FileService) removeThumbnails(ctx context.Context, f *metadata.File) {
+	if err := thumbnail.Remove(filepath.Join(storageRoot, f.OwnerID), f.FileID); err != nil {
+		slog.WarnContext(ctx, "Failed to remove thumbnails", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+	}
+}
+
+// regenerateThumbnails vuelve a generar las miniaturas de un archivo
+// restaurado de la papelera, si las tenía.
+func (s *FileService) regenerateThumbnails(ctx context.Context, f *metadata.File) {
+	state := f.Processing.Stage(StageThumbnail)
+	if state == nil || state.Status != metadata.StageDone {
+		return
+	}
+	i := slices.IndexFunc(s.pipeline.stages, func(st stage) bool { return st.name == StageThumbnail })
+	if i < 0 {
+		return
+	}
+	state.Status, state.UpdatedAt = metadata.StagePending, time.Now().UTC()
+	if err := s.saveProcessing(f); err != nil {
+		slog.WarnContext(ctx, "Failed to schedule thumbnail generation", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+		return
+	}
+	if s.pipeline.stages[i].async {
+		s.enqueueProcessing(ctx, f)
+		return
+	}
+	filePath := filepath.Join(storageRoot, f.OwnerID, f.StorageName)
+	err := s.runStages(ctx, f, filePath, false, true, func() error { return s.saveProcessing(f) })
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to generate thumbnails", "owner_id", f.OwnerID, "file_id", f.FileID, "error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/Districorp-UPB/FileServer/server")
+
+// Atributos comunes de los spans
+var (
+	attrOwner      = attribute.Key("fileserver.owner_id")
+	attrFileID     = attribute.Key("fileserver.file_id")
+	attrFileSize   = attribute.Key("fileserver.file_size")
+	attrChunkCount = attribute.Key("fileserver.chunk_count")
+	attrPath       = attribute.Key("fileserver.path")
+	attrSkipReason = attribute.Key("fileserver.skip_reason")
+	attrFileCount  = attribute.Key("fileserver.file_count")
+)
+
+// startStorageSpan inicia un span hijo para una operación de almacenamiento.
+func startStorageSpan(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "storage."+op, trace.WithAttributes(attrs...))
+}
+
+// endSpan marca el span como fallido si hubo error y lo cierra.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
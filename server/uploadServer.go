@@ -1,16 +1,103 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"mime"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Districorp-UPB/FileServer/audit"
+	"github.com/Districorp-UPB/FileServer/compression"
+	"github.com/Districorp-UPB/FileServer/encryption"
+	"github.com/Districorp-UPB/FileServer/media"
+	"github.com/Districorp-UPB/FileServer/metadata"
+	"github.com/Districorp-UPB/FileServer/metrics"
 	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/queue"
+	"github.com/Districorp-UPB/FileServer/scan"
+	"github.com/Districorp-UPB/FileServer/search"
+	"github.com/Districorp-UPB/FileServer/thumbnail"
+	"github.com/Districorp-UPB/FileServer/webhook"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Directorio raíz donde se montan los archivos del NFS
+const storageRoot = "./nfs/files"
+
 type FileService struct {
 	pb.UnimplementedFileServiceServer
+
+	// Registros de archivos y carpetas
+	store *metadata.Store
+	// Índice de texto completo (opcional)
+	index *search.Index
+	// Generador de miniaturas (opcional)
+	thumbnails *thumbnail.Generator
+	// Eliminar EXIF y GPS de las imágenes antes de guardarlas
+	stripMetadata bool
+	// Antivirus que analiza las subidas (opcional)
+	scanner scan.Scanner
+	// Etapas de procesamiento de las subidas y cola de las asíncronas
+	stageConfigs []StageConfig
+	pipeline     pipeline
+	jobs         *queue.Queue
+	validation   ValidationRules
+	// Notificación de eventos a webhooks (opcional)
+	webhooks *webhook.Notifier
+	// Intervalo entre heartbeats de WatchFiles y aviso de apagado
+	watchHeartbeat time.Duration
+	watchStop      chan struct{}
+	stopWatches    sync.Once
+
+	// Bytes que puede ocupar cada propietario (0 = sin límite)
+	quota int64
+	// Límites de ExtractArchive
+	extractLimits ExtractLimits
+	// KMS de las claves de datos del contenido cifrado (opcional)
+	kms encryption.KMS
+	// Qué subidas se guardan comprimidas (Codec vacío = ninguna)
+	compression CompressionPolicy
+	// Elegir la compresión gRPC de cada descarga
+	responseCompression bool
+	// Cola de borrados del NFS y firma de sus comprobantes (EraseOwner)
+	erasures *queue.Queue
+	signer   *audit.Signer
+
+	// Archivos temporales de subidas en curso
+	partials partialUploads
+	// Subidas visibles en el NFS cuyo registro pendiente de análisis todavía
+	// no se guardó
+	scanning pendingScans
+	// Evita que dos RelayEvents entreguen los mismos eventos
+	relayMu sync.Mutex
+}
+
+func NewFileService(store *metadata.Store, opts ...Option) *FileService {
+	s := &FileService{
+		store:          store,
+		watchHeartbeat: DefaultWatchHeartbeat,
+		watchStop:      make(chan struct{}),
+		extractLimits:  DefaultExtractLimits,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.stageConfigs == nil {
+		s.stageConfigs, _ = ParsePipeline(DefaultPipeline)
+	}
+	s.buildPipeline(s.stageConfigs)
+	return s
 }
 
 // Manejo de la subida de archivos
@@ -20,10 +107,42 @@ func (s *FileService) Upload(stream pb.FileService_UploadServer) error {
 		return fmt.Errorf("failed to receive upload request: %w", err)
 	}
 
-	// Subir el archivo al NFS
-	_, err = uploadToNFS(req)
+	ctx := stream.Context()
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attrOwner.String(req.OwnerId), attrFileID.String(req.FileId))
+
+	if err := validateIDs(req.OwnerId, req.FileId); err != nil {
+		return err
+	}
+
+	// Comprobar la carpeta destino y el nombre antes de recibir el contenido
+	record := &metadata.File{
+		OwnerID:      req.OwnerId,
+		FileID:       req.FileId,
+		Name:         req.FileName,
+		OriginalName: req.FileName,
+		ContentType:  req.ContentType,
+		FolderID:     req.FolderId,
+	}
+	if record.Name == "" {
+		record.Name = req.FileId
+	}
+	if len(req.Metadata) > 0 || len(req.Tags) > 0 {
+		record.Metadata = req.Metadata
+		record.Tags = metadata.NormalizeTags(req.Tags)
+		if err := metadata.ValidateAttributes(record.Metadata, record.Tags); err != nil {
+			return storeError(err)
+		}
+	}
+	if err := s.store.ValidateFile(record); err != nil {
+		return storeError(err)
+	}
+
+	content := newUploadReader(req, stream)
+	err = s.storeFile(ctx, record, content)
+	span.SetAttributes(attrFileSize.Int64(content.bytes), attrChunkCount.Int(content.chunks))
 	if err != nil {
-		return fmt.Errorf("failed to upload file to NFS: %w", err)
+		return err
 	}
 
 	// Enviar la respuesta al cliente
@@ -36,91 +155,445 @@ func (s *FileService) Upload(stream pb.FileService_UploadServer) error {
 
 	return nil
 }
+
+// storeFile guarda el contenido de un archivo ya comprobado con
+// ValidateFile, lo registra en el árbol del propietario con el resultado de
+// las etapas síncronas y el evento, y publica el evento. La usan Upload y ExtractArchive.
+func (s *FileService) storeFile(ctx context.Context, record *metadata.File, content io.Reader) error {
+	// Subir de nuevo un archivo existente crea una versión nueva
+	event := webhook.FileCreated
+	previous, err := s.store.LoadFile(record.OwnerID, record.FileID)
+	if err == nil {
+		event = webhook.FileVersionCreated
+	} else {
+		previous = nil
+	}
+
+	// Subir el archivo al NFS. La cuota, validate y el análisis síncrono se
+	// aplican con el contenido escrito pero todavía no visible, para que un
+	// rechazo deje intactos la versión anterior y su registro.
+	record.Processing = s.pipeline.newProcessing()
+	pendingScan := false
+	beforeCommit := func(tmpPath, filePath string, size int64) error {
+		record.StorageName = filepath.Base(filePath)
+		record.Size = size
+		if err := s.checkQuota(record, previous); err != nil {
+			return err
+		}
+		if s.pipeline.validate {
+			if err := s.validateUpload(record); err != nil {
+				return err
+			}
+		}
+		if st, ok := s.pipeline.stage(StageScan); ok {
+			record.ScanStatus = metadata.ScanPending
+			if !st.async {
+				return s.scanUpload(ctx, st, record, previous, tmpPath)
+			}
+			// El registro pendiente se guarda después de hacer visible el
+			// contenido: hasta entonces Download lo rechaza igual
+			s.scanning.add(record.OwnerID, record.FileID)
+			pendingScan = true
+		}
+		return nil
+	}
+	defer func() {
+		if pendingScan {
+			s.scanning.remove(record.OwnerID, record.FileID)
+		}
+	}()
+	filePath, size, err := s.uploadToNFS(ctx, record, content, beforeCommit)
+	if err != nil {
+		// Los rechazos de la cuota, validate y del análisis conservan su código
+		if st, ok := unwrapStatus(err); ok {
+			return st.Err()
+		}
+		return fmt.Errorf("failed to upload file to NFS: %w", err)
+	}
+
+	// El tamaño es el guardado, que difiere del recibido si se eliminaron
+	// metadatos
+	record.StorageName = filepath.Base(filePath)
+	record.Size = size
+	// Las miniaturas de la versión anterior no corresponden al contenido
+	// nuevo, aunque sea otra imagen: se borran antes de generar las nuevas
+	if previous != nil {
+		s.removeThumbnails(ctx, record)
+	}
+	stageErr := s.runStages(ctx, record, filePath, false, true, nil)
+	// Una subida rechazada por una etapa no produce evento
+	var events []string
+	if stageErr == nil {
+		events = s.events(event)
+	}
+	if err := s.store.PutFile(record, events...); err != nil {
+		return storeError(err)
+	}
+	// Con otra extensión la versión nueva se guardó con otro nombre: la
+	// anterior ya no tiene registro y la cuota no la cuenta
+	if previous != nil && previous.StorageName != "" && previous.StorageName != filepath.Base(filePath) {
+		s.removeStored(ctx, previous)
+	}
+	if stageErr != nil {
+		if st, ok := unwrapStatus(stageErr); ok {
+			return st.Err()
+		}
+		return status.Errorf(codes.Internal, "upload processing failed: %v", stageErr)
+	}
+	s.enqueueProcessing(ctx, record)
+	s.RelayEvents(ctx)
+	return nil
+}
+
+// removeStored borra el contenido guardado de una versión reemplazada. Un
+// fallo solo se registra: la versión nueva ya está guardada.
+func (s *FileService) removeStored(ctx context.Context, f *metadata.File) {
+	filePath := filepath.Join(storageRoot, f.OwnerID, f.StorageName)
+	_, span := startStorageSpan(ctx, "remove", attrPath.String(filePath))
+	err := os.Remove(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrRemove)
+		slog.WarnContext(ctx, "Failed to remove replaced file version", "owner_id", f.OwnerID, "file_id", f.FileID, "file", f.StorageName, "error", err)
+	}
+}
+
+// checkQuota rechaza el archivo si con su tamaño el propietario supera la
+// cuota. previous es la versión que reemplaza, si existe. Dos subidas
+// simultáneas pueden superar la cuota por el tamaño de una de ellas.
+func (s *FileService) checkQuota(f, previous *metadata.File) error {
+	if s.quota <= 0 {
+		return nil
+	}
+	used, err := s.store.Usage(f.OwnerID)
+	if err != nil {
+		return storeError(err)
+	}
+	if previous != nil {
+		used -= previous.Size
+	}
+	if used+f.Size > s.quota {
+		return status.Errorf(codes.ResourceExhausted, "storage quota of %d bytes exceeded", s.quota)
+	}
+	return nil
+}
+
 func (s *FileService) Download(req *pb.FileDownloadRequest, stream pb.FileService_DownloadServer) error {
-	filePath, err := getFilePath(req.OwnerId, req.FileId)
+	ctx := stream.Context()
+	trace.SpanFromContext(ctx).SetAttributes(attrOwner.String(req.OwnerId), attrFileID.String(req.FileId))
+
+	record, err := s.lookupFile(ctx, req.OwnerId, req.FileId, req.Path)
 	if err != nil {
-		return fmt.Errorf("file not found: %w", err)
+		return err
 	}
+	if err := s.checkScanStatus(record); err != nil {
+		return err
+	}
+	filePath := filepath.Join(storageRoot, record.OwnerID, record.StorageName)
 
-	file, err := os.Open(filePath)
+	content, err := s.openContent(ctx, record, filePath)
 	if err != nil {
-		return fmt.Errorf("failed to open file: %w", err)
+		return err
 	}
-	defer file.Close()
+	defer content.Close()
 
-	const bufferSize = 1024 * 1024 // 1 MB
-	buffer := make([]byte, bufferSize)
+	size := content.Size()
+	if req.Offset < 0 || req.Length < 0 || req.Offset > size {
+		return status.Errorf(codes.OutOfRange, "invalid range: offset %d, length %d for a file of %d bytes", req.Offset, req.Length, size)
+	}
+	length := size - req.Offset
+	if req.Length > 0 {
+		length = min(req.Length, length)
+	}
 
+	// El primer mensaje lleva el nombre original, los tipos de contenido, el
+	// tamaño y la fecha de modificación. Se envía aunque el archivo esté vacío.
+	first := &pb.FileDownloadResponse{
+		FileId:              record.FileID,
+		FileName:            record.OriginalName,
+		ContentType:         record.ContentType,
+		DetectedContentType: record.DetectedContentType,
+		Size:                size,
+		ModifiedAt:          timestamppb.New(content.modTime),
+	}
+	body := io.NewSectionReader(content, req.Offset, length)
+	// El contenido comprimido solo se envía tal cual completo: un rango del
+	// stream comprimido no se puede descomprimir por separado
+	if content.encoding != "" && req.Offset == 0 && req.Length == 0 && slices.Contains(req.AcceptEncoding, content.encoding) {
+		body = content.encoded
+		first.ContentEncoding = content.encoding
+		s.compressResponse(ctx, length, compression.ContentType(content.encoding))
+	} else {
+		s.compressResponse(ctx, length, record.ContentType, record.DetectedContentType)
+	}
+
+	_, span := startStorageSpan(ctx, "read", attrPath.String(filePath))
+	var sent int64
+	chunks := 0
+	defer func() {
+		span.SetAttributes(attrFileSize.Int64(sent), attrChunkCount.Int(chunks))
+		endSpan(span, err)
+	}()
+
+	var readErr, sendErr error
+	sent, chunks, readErr, sendErr = sendChunks(body, func(chunk []byte) error {
+		msg := &pb.FileDownloadResponse{FileId: record.FileID}
+		if first != nil {
+			msg, first = first, nil
+		}
+		msg.BinaryFileResponse = chunk
+		return stream.Send(msg)
+	})
+	switch {
+	case readErr != nil:
+		metrics.StorageError(metrics.StorageErrRead)
+		err = fmt.Errorf("failed to read file: %w", readErr)
+		return err
+	case sendErr != nil:
+		err = fmt.Errorf("failed to send file chunk: %w", sendErr)
+		return err
+	}
+
+	// Archivo vacío: enviar solo los metadatos
+	if first != nil {
+		if sendErr := stream.Send(first); sendErr != nil {
+			err = fmt.Errorf("failed to send file metadata: %w", sendErr)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Contenido máximo de cada mensaje de descarga
+const downloadChunkSize = 1024 * 1024 // 1 MB
+
+// sendChunks lee r hasta el final y pasa el contenido a send en fragmentos de
+// downloadChunkSize (el último puede ser menor), aunque r entregue los datos
+// de a poco como un pipe. El buffer se reutiliza entre llamadas. Retorna los
+// bytes y fragmentos enviados y el error de lectura o de envío.
+func sendChunks(r io.Reader, send func(chunk []byte) error) (sent int64, chunks int, readErr, sendErr error) {
+	buffer := make([]byte, downloadChunkSize)
 	for {
-		n, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return fmt.Errorf("failed to read file: %w", err)
+		n, err := io.ReadFull(r, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return sent, chunks, err, nil
 		}
 		if n == 0 { // Si no hay más datos para leer
-			break
+			return sent, chunks, nil, nil
 		}
 
 		// Enviar fragmento
-		if err := stream.Send(&pb.FileDownloadResponse{
-			FileId:             req.FileId,
-			BinaryFileResponse: buffer[:n],
-		}); err != nil {
-			return fmt.Errorf("failed to send file chunk: %w", err)
+		if err := send(buffer[:n]); err != nil {
+			return sent, chunks, nil, err
 		}
+		sent += int64(n)
+		chunks++
 	}
+}
 
-	return nil
+// CleanupPartialUploads elimina los archivos temporales de las subidas que
+// seguían en curso. Se llama después de detener el servidor a la fuerza.
+func (s *FileService) CleanupPartialUploads() int {
+	return s.partials.cleanup()
 }
 
-func uploadToNFS(req *pb.FileUploadRequest) (string, error) {
-	userPath := fmt.Sprintf("./nfs/files/%s", req.OwnerId)
+// lookupFile retorna el registro de un archivo buscado por id o por ruta.
+// Los archivos subidos antes de existir el árbol de carpetas no tienen
+// registro: se buscan directamente en el directorio del propietario y se
+// describen a partir de su nombre en disco.
+func (s *FileService) lookupFile(ctx context.Context, ownerId, fileId, path string) (*metadata.File, error) {
+	if fileId == "" && path != "" {
+		item, err := s.store.Resolve(ownerId, path)
+		if err != nil {
+			return nil, storeError(err)
+		}
+		if item.File == nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s is a folder", path)
+		}
+		fileId = item.File.FileID
+	}
+	if err := validateIDs(ownerId, fileId); err != nil {
+		return nil, err
+	}
+
+	record, err := s.store.GetFile(ownerId, fileId)
+	switch {
+	case err == nil:
+		return record, nil
+	case errors.Is(err, metadata.ErrNotFound):
+		filePath, err := getFilePath(ctx, ownerId, fileId)
+		if err != nil {
+			metrics.StorageError(metrics.StorageErrNotFound)
+			return nil, status.Errorf(codes.NotFound, "file not found: %v", err)
+		}
+		name := filepath.Base(filePath)
+		return &metadata.File{
+			OwnerID:             ownerId,
+			FileID:              fileId,
+			Name:                name,
+			OriginalName:        name,
+			StorageName:         name,
+			DetectedContentType: mime.TypeByExtension(filepath.Ext(name)),
+		}, nil
+	default:
+		return nil, storeError(err)
+	}
+}
+
+func (s *FileService) uploadToNFS(ctx context.Context, record *metadata.File, content io.Reader, beforeCommit commitHook) (string, int64, error) {
+	userPath := filepath.Join(storageRoot, record.OwnerID)
 	if _, err := os.Stat(userPath); os.IsNotExist(err) {
 		err := os.MkdirAll(userPath, 0755)
 		if err != nil {
-			return "", fmt.Errorf("failed to create user directory: %w", err)
+			metrics.StorageError(metrics.StorageErrMkdir)
+			return "", 0, fmt.Errorf("failed to create user directory: %w", err)
 		}
 	}
 
-	fileExtension := filepath.Ext(req.FileName)
-	fileName := req.FileId + fileExtension
+	fileExtension := filepath.Ext(record.OriginalName)
+	fileName := record.FileID + fileExtension
 	filePath := filepath.Join(userPath, fileName)
 
+	if s.stripMetadata {
+		content = media.StripReader(content)
+	}
+	content = s.compressContent(record, content)
+	seal, err := s.newDataKey(ctx, record)
+	if err != nil {
+		return "", 0, err
+	}
+	// Se comprime antes de cifrar: el contenido cifrado no se puede comprimir
+	seal = compressSeal(record.Compression, seal)
+
 	// Guardar el archivo recibido
-	err := saveFile(filePath, req.BinaryFile)
+	size, stored, err := saveFile(ctx, filePath, content, &s.partials, seal, beforeCommit)
 	if err != nil {
-		return "", fmt.Errorf("failed to upload file: %w", err)
+		return "", 0, fmt.Errorf("failed to upload file: %w", err)
 	}
+	record.StoredSize = stored
 
-	return filePath, nil
+	return filePath, size, nil
 }
 
-func saveFile(filePath string, binaryFile []byte) error {
-	fileUpload, err := os.Create(filePath)
+// commitHook se ejecuta con el contenido ya escrito en tmpPath, justo antes
+// de hacerlo visible en filePath. Si retorna un error, la subida se descarta.
+type commitHook func(tmpPath, filePath string, size int64) error
+
+// saveFile escribe el contenido en un archivo temporal dentro del mismo
+// directorio y solo lo renombra a su nombre final cuando está completo, para
+// que una subida interrumpida nunca deje un archivo a medias visible. Si seal
+// no es nil, el contenido se escribe a través de él (comprimido o cifrado).
+// written es el tamaño del contenido recibido y stored el del archivo escrito.
+func saveFile(ctx context.Context, filePath string, content io.Reader, partials *partialUploads, seal sealFunc, beforeCommit commitHook) (written, stored int64, err error) {
+	_, span := startStorageSpan(ctx, "create", attrPath.String(filePath))
+	fileUpload, err := os.CreateTemp(filepath.Dir(filePath), partialPrefix+"*")
+	endSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		metrics.StorageError(metrics.StorageErrCreate)
+		return 0, 0, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer fileUpload.Close()
+	tmpPath := fileUpload.Name()
+	partials.add(tmpPath)
+	defer partials.remove(tmpPath)
+
+	committed := false
+	defer func() {
+		if !committed {
+			fileUpload.Close()
+			os.Remove(tmpPath)
+		}
+	}()
 
 	// No es necesario decodificar, solo escribir el contenido binario directamente
-	_, err = fileUpload.Write(binaryFile)
+	_, span = startStorageSpan(ctx, "write", attrPath.String(tmpPath))
+	written, err = writeContent(fileUpload, content, seal)
+	span.SetAttributes(attrFileSize.Int64(written))
+	endSpan(span, err)
 	if err != nil {
-		return fmt.Errorf("failed to write binary content to file: %w", err)
+		metrics.StorageError(metrics.StorageErrWrite)
+		return 0, 0, fmt.Errorf("failed to write binary content to file: %w", err)
+	}
+	// os.CreateTemp crea el archivo con permisos 0600
+	if err := fileUpload.Chmod(0644); err != nil {
+		return 0, 0, fmt.Errorf("failed to set file permissions: %w", err)
 	}
 
-	return nil
+	_, span = startStorageSpan(ctx, "fsync", attrPath.String(tmpPath))
+	err = fileUpload.Sync()
+	endSpan(span, err)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrSync)
+		return 0, 0, fmt.Errorf("failed to sync file: %w", err)
+	}
+	info, err := fileUpload.Stat()
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrStat)
+		return 0, 0, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if err := fileUpload.Close(); err != nil {
+		metrics.StorageError(metrics.StorageErrWrite)
+		return 0, 0, fmt.Errorf("failed to close file: %w", err)
+	}
+	if beforeCommit != nil {
+		if err := beforeCommit(tmpPath, filePath, written); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	_, span = startStorageSpan(ctx, "rename", attrPath.String(filePath))
+	err = os.Rename(tmpPath, filePath)
+	endSpan(span, err)
+	if err != nil {
+		metrics.StorageError(metrics.StorageErrRename)
+		return 0, 0, fmt.Errorf("failed to commit file: %w", err)
+	}
+	committed = true
+
+	return written, info.Size(), nil
 }
 
-func getFilePath(ownerId, fileId string) (string, error) {
-	// Directorio donde se almacenan los archivos
-	userPath := fmt.Sprintf("./nfs/files/%s", ownerId)
+func writeContent(dst io.Writer, content io.Reader, seal sealFunc) (int64, error) {
+	if seal == nil {
+		return io.Copy(dst, content)
+	}
+	w, err := seal(dst)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(w, content)
+	if err != nil {
+		return written, err
+	}
+	return written, w.Close()
+}
+
+func getFilePath(ctx context.Context, ownerId, fileId string) (path string, err error) {
+	_, span := startStorageSpan(ctx, "lookup", attrOwner.String(ownerId), attrFileID.String(fileId))
+	defer func() { endSpan(span, err) }()
 
-	// Buscar archivos con el fileId seguido de cualquier extensión
-	filePattern := fmt.Sprintf("%s*", fileId)
-	matchedFiles, err := filepath.Glob(filepath.Join(userPath, filePattern))
-	if err != nil || len(matchedFiles) == 0 {
+	// Directorio donde se almacenan los archivos
+	userPath := filepath.Join(storageRoot, ownerId)
+	entries, err := os.ReadDir(userPath)
+	if err != nil {
 		return "", fmt.Errorf("file does not exist")
 	}
 
-	// Retornar el primer archivo encontrado
-	return matchedFiles[0], nil
+	// Buscar el archivo con el fileId seguido de cualquier extensión,
+	// comparando los nombres: "f1" no debe encontrar "f10.txt". Las entradas
+	// ocultas (subidas en curso, miniaturas, cuarentena) nunca son archivos.
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !entry.Type().IsRegular() {
+			continue
+		}
+		rest, ok := strings.CutPrefix(name, fileId)
+		if ok && (rest == "" || strings.HasPrefix(rest, ".")) {
+			return filepath.Join(userPath, name), nil
+		}
+	}
+	return "", fmt.Errorf("file does not exist")
 }
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metadata"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Observación de cambios. Los eventos salen del registro de cambios del
+// almacén de metadatos, así que un cliente que se desconecta retoma desde su
+// último cursor sin perder nada mientras el registro no se haya podado.
+//
+// Cada observador lee el registro a su propio ritmo: si el cliente consume
+// despacio, Send se bloquea por el control de flujo de HTTP/2 y el servidor
+// deja de leer, sin acumular eventos en memoria. Los avisos de cambios nuevos
+// se agrupan en uno solo mientras tanto.
+
+// DefaultWatchHeartbeat es el intervalo entre heartbeats sin cambios.
+const DefaultWatchHeartbeat = 15 * time.Second
+
+// Cambios leídos del registro en cada consulta
+const watchBatch = 100
+
+// Tipo de los eventos sin cambios, que mantienen viva la conexión y
+// actualizan el cursor
+const eventHeartbeat = "heartbeat"
+
+func (s *FileService) WatchFiles(req *pb.WatchFilesRequest, stream pb.FileService_WatchFilesServer) error {
+	if err := validateIDs(req.OwnerId); err != nil {
+		return err
+	}
+	folderID, err := s.folderRef(req.OwnerId, req.FolderId, req.FolderPath)
+	if err != nil {
+		return err
+	}
+
+	// Suscribirse antes de leer el registro para no perder avisos
+	updates, cancel := s.store.Subscribe(req.OwnerId)
+	defer cancel()
+
+	cursor, err := s.watchCursor(req.SinceCursor)
+	if err != nil {
+		return err
+	}
+	// Rechazar un cursor expirado antes de confirmar la suscripción
+	if _, err := s.store.Changes(req.OwnerId, cursor, 0); err != nil {
+		return storeError(err)
+	}
+	if err := sendHeartbeat(stream, cursor); err != nil {
+		return err
+	}
+
+	heartbeat := time.NewTicker(s.watchHeartbeat)
+	defer heartbeat.Stop()
+	ctx := stream.Context()
+	for {
+		changes, err := s.store.Changes(req.OwnerId, cursor, watchBatch)
+		if err != nil {
+			return storeError(err)
+		}
+		for _, c := range changes {
+			visible, err := s.watchVisible(req.OwnerId, folderID, c)
+			if err != nil {
+				return storeError(err)
+			}
+			if visible {
+				if err := stream.Send(newChangeEventProto(c)); err != nil {
+					return err
+				}
+				heartbeat.Reset(s.watchHeartbeat)
+			}
+			cursor = c.Seq
+		}
+		if len(changes) == watchBatch {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-s.watchStop:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-updates:
+		case <-heartbeat.C:
+			if err := sendHeartbeat(stream, cursor); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// StopWatches termina los WatchFiles en curso, que de otro modo no terminan
+// nunca y demorarían el apagado. Los clientes se reconectan con su cursor.
+func (s *FileService) StopWatches() {
+	s.stopWatches.Do(func() { close(s.watchStop) })
+}
+
+// watchCursor interpreta el cursor del cliente. Sin cursor se observa desde
+// el último cambio registrado.
+func (s *FileService) watchCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		head, err := s.store.ChangeHead()
+		if err != nil {
+			return 0, storeError(err)
+		}
+		return head, nil
+	}
+	seq, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid cursor %q", cursor)
+	}
+	return seq, nil
+}
+
+// watchVisible indica si el cambio afecta a la carpeta observada: el
+// elemento quedó dentro de ella o salió de ella.
+func (s *FileService) watchVisible(owner, folderID string, c *metadata.Change) (bool, error) {
+	inside, err := s.store.InFolder(owner, c.ParentID(), folderID)
+	if err != nil || inside || c.FromFolderID == "" {
+		return inside, err
+	}
+	return s.store.InFolder(owner, c.FromFolderID, folderID)
+}
+
+func sendHeartbeat(stream pb.FileService_WatchFilesServer, cursor uint64) error {
+	return stream.Send(&pb.ChangeEvent{
+		Cursor: strconv.FormatUint(cursor, 10),
+		Type:   eventHeartbeat,
+		Time:   timestamppb.Now(),
+	})
+}
+
+func newChangeEventProto(c *metadata.Change) *pb.ChangeEvent {
+	event := &pb.ChangeEvent{
+		Cursor:       strconv.FormatUint(c.Seq, 10),
+		Type:         c.Type,
+		Time:         timestamppb.New(c.Time),
+		FromFolderId: c.FromFolderID,
+		FromPath:     c.FromPath,
+	}
+	if c.File != nil {
+		event.Item = &pb.ChangeEvent_File{File: newFileEntryProto(c.File, c.Path)}
+	} else {
+		event.Item = &pb.ChangeEvent_Folder{Folder: newFolderProto(c.Folder, c.Path)}
+	}
+	return event
+}
@@ -0,0 +1,27 @@
+package thumbnail
+
+import "io"
+
+// Generator genera las miniaturas de los tamaños configurados. Cuándo se
+// generan (al subir el archivo o en segundo plano) lo decide el pipeline de
+// procesamiento del servidor.
+type Generator struct {
+	sizes  []int
+	limits Limits
+}
+
+// NewGenerator crea un generador para los tamaños dados.
+func NewGenerator(sizes []int, limits Limits) *Generator {
+	return &Generator{sizes: sizes, limits: limits}
+}
+
+// Sizes retorna los tamaños configurados, de menor a mayor.
+func (g *Generator) Sizes() []int {
+	return g.sizes
+}
+
+// Process genera las miniaturas de la imagen src en el directorio de
+// miniaturas de ownerDir.
+func (g *Generator) Process(src io.ReadSeeker, ownerDir, fileID string, seal Seal) error {
+	return Generate(src, ownerDir, fileID, g.sizes, g.limits, seal)
+}
@@ -0,0 +1,40 @@
+package thumbnail
+
+import "image"
+
+// applyOrientation rota o refleja la imagen según el valor EXIF.
+func applyOrientation(src image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Reflejo horizontal
+				dx, dy = w-1-x, y
+			case 3: // Rotación 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // Reflejo vertical
+				dx, dy = x, h-1-y
+			case 5: // Transpuesta
+				dx, dy = y, x
+			case 6: // Rotación 90° horaria
+				dx, dy = h-1-y, x
+			case 7: // Transversa
+				dx, dy = h-1-y, w-1-x
+			case 8: // Rotación 90° antihoraria
+				dx, dy = y, w-1-x
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,212 @@
+// Package thumbnail genera miniaturas de imágenes en Go puro.
+package thumbnail
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Districorp-UPB/FileServer/media"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Solo decodificación
+)
+
+// Dir es el subdirectorio oculto del propietario donde se guardan las miniaturas.
+const Dir = ".thumbnails"
+
+var (
+	ErrNotImage = errors.New("file is not a supported image")
+	ErrTooLarge = errors.New("image dimensions exceed the decompression limit")
+)
+
+// Limits protege contra bombas de descompresión: las dimensiones se leen de
+// la cabecera antes de decodificar la imagen completa.
+type Limits struct {
+	MaxPixels    int
+	MaxDimension int
+}
+
+var DefaultLimits = Limits{MaxPixels: 64_000_000, MaxDimension: 20_000}
+
+// Formats soportados como origen
+var supported = map[string]bool{"jpeg": true, "png": true, "gif": true, "webp": true}
+
+// Path retorna la ruta de la miniatura de un archivo para un tamaño. Las
+// imágenes con transparencia posible (PNG, GIF, WebP) se guardan como PNG.
+func Path(ownerDir, fileID string, size int, format string) string {
+	ext := ".jpg"
+	if format == "png" {
+		ext = ".png"
+	}
+	return filepath.Join(ownerDir, Dir, fileID+"-"+strconv.Itoa(size)+ext)
+}
+
+// Seal envuelve el destino de cada miniatura, por ejemplo para cifrarla.
+// Close debe completar el contenido sin cerrar el destino.
+type Seal func(w io.Writer) (io.WriteCloser, error)
+
+// Generate decodifica la imagen de f y escribe una miniatura por cada tamaño
+// (lado mayor en píxeles) en el directorio de miniaturas de ownerDir. Si
+// seal no es nil, las miniaturas se escriben a través de él.
+func Generate(f io.ReadSeeker, ownerDir, fileID string, sizes []int, limits Limits, seal Seal) error {
+	cfg, format, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil || !supported[format] {
+		return ErrNotImage
+	}
+	if cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension || cfg.Width*cfg.Height > limits.MaxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	if err != nil {
+		return fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		if _, err := f.Seek(0, io.SeekStart); err == nil {
+			orientation = media.Orientation(f)
+		}
+	}
+
+	outFormat := "jpeg"
+	if format != "jpeg" {
+		outFormat = "png"
+	}
+	if err := os.MkdirAll(filepath.Join(ownerDir, Dir), 0755); err != nil {
+		return fmt.Errorf("failed to create thumbnail directory: %w", err)
+	}
+	for _, size := range sizes {
+		thumb := applyOrientation(resize(img, size), orientation)
+		if err := write(Path(ownerDir, fileID, size, outFormat), thumb, outFormat, seal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find busca la miniatura ya generada de un tamaño en cualquiera de los
+// formatos de salida.
+func Find(ownerDir, fileID string, size int) (string, string, bool) {
+	for _, format := range []string{"jpeg", "png"} {
+		path := Path(ownerDir, fileID, size, format)
+		if _, err := os.Stat(path); err == nil {
+			return path, "image/" + format, true
+		}
+	}
+	return "", "", false
+}
+
+// Remove borra las miniaturas de un archivo de todos los tamaños y formatos,
+// incluidos tamaños que ya no estén configurados.
+func Remove(ownerDir, fileID string) error {
+	dir := filepath.Join(ownerDir, Dir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !isThumbnailOf(entry.Name(), fileID) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isThumbnailOf indica si name es "<fileID>-<tamaño>.jpg" o ".png". El resto
+// tiene que ser exacto: los ids pueden contener "-", y las miniaturas de
+// "f1-2" no son de "f1".
+func isThumbnailOf(name, fileID string) bool {
+	rest, ok := strings.CutPrefix(name, fileID+"-")
+	if !ok {
+		return false
+	}
+	ext := filepath.Ext(rest)
+	if ext != ".jpg" && ext != ".png" {
+		return false
+	}
+	size := strings.TrimSuffix(rest, ext)
+	return size != "" && strings.Trim(size, "0123456789") == ""
+}
+
+// resize escala la imagen para que su lado mayor mida size, sin agrandarla.
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+		return dst
+	}
+	if w >= h {
+		h = max(1, h*size/w)
+		w = size
+	} else {
+		w = max(1, w*size/h)
+		h = size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, xdraw.Src, nil)
+	return dst
+}
+
+// write guarda la miniatura con un archivo temporal y rename, para que
+// GetThumbnail nunca lea una miniatura a medias.
+func write(path string, img image.Image, format string, seal Seal) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var dst io.Writer = tmp
+	var sealed io.WriteCloser
+	if seal != nil {
+		if sealed, err = seal(tmp); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to create thumbnail: %w", err)
+		}
+		dst = sealed
+	}
+	w := bufio.NewWriter(dst)
+	if format == "png" {
+		err = png.Encode(w, img)
+	} else {
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: 85})
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && sealed != nil {
+		err = sealed.Close()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,232 @@
+package tracing_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Districorp-UPB/FileServer/internal/servertest"
+	pb "github.com/Districorp-UPB/FileServer/proto"
+	"github.com/Districorp-UPB/FileServer/server"
+	"github.com/Districorp-UPB/FileServer/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	grpcmd "google.golang.org/grpc/metadata"
+)
+
+var (
+	exporter = tracetest.NewInMemoryExporter()
+	provider = tracing.NewProvider(exporter, sdktrace.AlwaysSample())
+)
+
+func TestMain(m *testing.M) {
+	tracing.Install(provider)
+	os.Exit(servertest.Main(m))
+}
+
+// newClient levanta un FileService instrumentado como en main.
+func newClient(t *testing.T) pb.FileServiceClient {
+	conn := servertest.Dial(t, func(s *grpc.Server) {
+		pb.RegisterFileServiceServer(s, server.NewFileService(servertest.OpenStore(t)))
+	}, grpc.StatsHandler(otelgrpc.NewServerHandler()))
+	return pb.NewFileServiceClient(conn)
+}
+
+func upload(ctx context.Context, c pb.FileServiceClient, owner, fileID string, chunks ...string) error {
+	content := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		content[i] = []byte(chunk)
+	}
+	_, err := servertest.Upload(ctx, c, &pb.FileUploadRequest{OwnerId: owner, FileId: fileID, FileName: fileID + ".txt"}, content...)
+	return err
+}
+
+func download(ctx context.Context, c pb.FileServiceClient, owner, fileID string) error {
+	_, err := servertest.Download(ctx, c, &pb.FileDownloadRequest{OwnerId: owner, FileId: fileID})
+	return err
+}
+
+// withRemoteParent agrega a ctx un traceparent como el de un cliente
+// instrumentado y retorna el span que el servidor debe usar como padre.
+func withRemoteParent(ctx context.Context) (context.Context, trace.SpanContext) {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	rand.Read(traceID[:])
+	rand.Read(spanID[:])
+	parent := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled, Remote: true})
+	header := "00-" + hex.EncodeToString(traceID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-01"
+	return grpcmd.AppendToOutgoingContext(ctx, "traceparent", header), parent
+}
+
+func TestRPCSpans(t *testing.T) {
+	c := newClient(t)
+	if err := upload(context.Background(), c, "o1", "existing", "hello ", "world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join("nfs", "files", "o1", "legacy.txt"), []byte("legacy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func(context.Context) error
+		rpc  string
+		// Atributos del span del RPC
+		attrs []attribute.KeyValue
+		// Spans de almacenamiento que cuelgan del span del RPC
+		storage []string
+		// Atributos de alguno de los spans de almacenamiento
+		storageAttrs map[string][]attribute.KeyValue
+	}{
+		{
+			name: "upload",
+			call: func(ctx context.Context) error { return upload(ctx, c, "o1", "f1", "a", "bb", "ccc") },
+			rpc:  "proto.FileService/Upload",
+			attrs: []attribute.KeyValue{
+				attribute.String("fileserver.owner_id", "o1"),
+				attribute.String("fileserver.file_id", "f1"),
+				attribute.Int64("fileserver.file_size", 6),
+				attribute.Int("fileserver.chunk_count", 3),
+			},
+			storage: []string{"storage.create", "storage.write", "storage.fsync", "storage.rename"},
+			storageAttrs: map[string][]attribute.KeyValue{
+				"storage.write": {attribute.Int64("fileserver.file_size", 6)},
+			},
+		},
+		{
+			name: "download",
+			call: func(ctx context.Context) error { return download(ctx, c, "o1", "existing") },
+			rpc:  "proto.FileService/Download",
+			attrs: []attribute.KeyValue{
+				attribute.String("fileserver.owner_id", "o1"),
+				attribute.String("fileserver.file_id", "existing"),
+			},
+			storage: []string{"storage.read"},
+			storageAttrs: map[string][]attribute.KeyValue{
+				"storage.read": {attribute.Int64("fileserver.file_size", 11), attribute.Int("fileserver.chunk_count", 1)},
+			},
+		},
+		{
+			// Archivos previos a los metadatos: se buscan en el directorio
+			name: "legacy download",
+			call: func(ctx context.Context) error { return download(ctx, c, "o1", "legacy") },
+			rpc:  "proto.FileService/Download",
+			attrs: []attribute.KeyValue{
+				attribute.String("fileserver.owner_id", "o1"),
+				attribute.String("fileserver.file_id", "legacy"),
+			},
+			storage: []string{"storage.lookup", "storage.read"},
+			storageAttrs: map[string][]attribute.KeyValue{
+				"storage.lookup": {attribute.String("fileserver.owner_id", "o1"), attribute.String("fileserver.file_id", "legacy")},
+				"storage.read":   {attribute.Int64("fileserver.file_size", 6), attribute.Int("fileserver.chunk_count", 1)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			ctx, parent := withRemoteParent(context.Background())
+			if err := tt.call(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if err := provider.ForceFlush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			spans := map[string]tracetest.SpanStub{}
+			byID := map[trace.SpanID]tracetest.SpanStub{}
+			for _, s := range exporter.GetSpans() {
+				if s.SpanContext.TraceID() != parent.TraceID() {
+					continue
+				}
+				spans[s.Name] = s
+				byID[s.SpanContext.SpanID()] = s
+			}
+
+			rpc, ok := spans[tt.rpc]
+			if !ok {
+				t.Fatalf("no %s span in trace %s", tt.rpc, parent.TraceID())
+			}
+			if rpc.Parent.SpanID() != parent.SpanID() || !rpc.Parent.IsRemote() {
+				t.Errorf("%s parent = %s, want remote %s", tt.rpc, rpc.Parent.SpanID(), parent.SpanID())
+			}
+			checkAttrs(t, tt.rpc, rpc.Attributes, tt.attrs)
+
+			for _, name := range tt.storage {
+				s, ok := spans[name]
+				if !ok {
+					t.Errorf("no %s span", name)
+					continue
+				}
+				if !descends(s, rpc.SpanContext.SpanID(), byID) {
+					t.Errorf("%s does not descend from %s", name, tt.rpc)
+				}
+			}
+			for name, want := range tt.storageAttrs {
+				checkAttrs(t, name, spans[name].Attributes, want)
+			}
+		})
+	}
+}
+
+func TestSetupExporters(t *testing.T) {
+	tests := []struct {
+		exporter string
+		wantErr  bool
+	}{
+		{exporter: ""},
+		{exporter: tracing.ExporterNone},
+		{exporter: tracing.ExporterStdout},
+		{exporter: "jaeger", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.exporter, func(t *testing.T) {
+			shutdown, err := tracing.Setup(context.Background(), tracing.Config{Exporter: tt.exporter, SampleRatio: 1})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Setup succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	// Setup reemplaza el proveedor global
+	tracing.Install(provider)
+}
+
+// descends indica si s cuelga, directamente o no, del span ancestor.
+func descends(s tracetest.SpanStub, ancestor trace.SpanID, byID map[trace.SpanID]tracetest.SpanStub) bool {
+	for {
+		if s.Parent.SpanID() == ancestor {
+			return true
+		}
+		parent, ok := byID[s.Parent.SpanID()]
+		if !ok {
+			return false
+		}
+		s = parent
+	}
+}
+
+func checkAttrs(t *testing.T, span string, got, want []attribute.KeyValue) {
+	t.Helper()
+	set := attribute.NewSet(got...)
+	for _, kv := range want {
+		if v, ok := set.Value(kv.Key); !ok || v != kv.Value {
+			t.Errorf("%s attribute %s = %v, want %v", span, kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+}
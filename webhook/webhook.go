@@ -0,0 +1,274 @@
+// Package webhook notifica los cambios en los archivos a URLs configuradas.
+// Cada evento se guarda en un outbox durable (una cola de trabajos) con una
+// entrega por endpoint, que se reintenta con espera exponencial hasta que el
+// receptor responde 2xx.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/metrics"
+	"github.com/Districorp-UPB/FileServer/queue"
+)
+
+// Tipos de evento. No hay file.shared: el servidor no tiene una operación
+// para compartir archivos.
+const (
+	FileCreated        = "file.created"
+	FileDeleted        = "file.deleted"
+	FileVersionCreated = "file.version_created"
+)
+
+var eventTypes = []string{FileCreated, FileDeleted, FileVersionCreated}
+
+// Cabeceras de cada entrega
+const (
+	HeaderID        = "X-Webhook-Id"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Event es el cuerpo JSON que recibe cada endpoint. ID es el mismo en todos
+// los reintentos, para que el receptor descarte duplicados.
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	OwnerID string    `json:"owner_id"`
+	FileID  string    `json:"file_id"`
+	File    *File     `json:"file,omitempty"`
+}
+
+// File describe el archivo afectado por el evento.
+type File struct {
+	Name        string `json:"name"`
+	Path        string `json:"path,omitempty"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+	SHA256      string `json:"sha256,omitempty"`
+}
+
+// Endpoint es un receptor de eventos. Si Events está vacío recibe todos.
+type Endpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events,omitempty"`
+}
+
+func (e Endpoint) wants(typ string) bool {
+	return len(e.Events) == 0 || slices.Contains(e.Events, typ)
+}
+
+// LoadEndpoints lee la lista de endpoints de un archivo JSON.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+	var endpoints []Endpoint
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return nil, fmt.Errorf("invalid webhook config: %w", err)
+	}
+	for _, e := range endpoints {
+		if e.URL == "" || e.Secret == "" {
+			return nil, errors.New("invalid webhook config: every endpoint needs a url and a secret")
+		}
+		for _, typ := range e.Events {
+			if !slices.Contains(eventTypes, typ) {
+				return nil, fmt.Errorf("invalid webhook config: unknown event %q", typ)
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// RetryOptions reintenta una entrega durante unas ocho horas.
+var RetryOptions = queue.Options{
+	MaxAttempts: 12,
+	BaseDelay:   5 * time.Second,
+	MaxDelay:    time.Hour,
+}
+
+// Tiempo máximo de espera de la respuesta de un endpoint
+const deliveryTimeout = 10 * time.Second
+
+// delivery es el trabajo guardado en el outbox: un evento para un endpoint.
+// El secreto no se guarda; se busca por URL al entregar.
+type delivery struct {
+	URL   string `json:"url"`
+	Event Event  `json:"event"`
+}
+
+// Notifier publica eventos en los endpoints configurados.
+type Notifier struct {
+	endpoints []Endpoint
+	outbox    *queue.Queue
+	client    *http.Client
+}
+
+// NewNotifier crea un notificador que guarda las entregas en outbox.
+func NewNotifier(endpoints []Endpoint, outbox *queue.Queue) *Notifier {
+	return &Notifier{
+		endpoints: endpoints,
+		outbox:    outbox,
+		client:    &http.Client{Timeout: deliveryTimeout},
+	}
+}
+
+// Publish completa el id y la fecha del evento si no los trae y agenda una
+// entrega por cada endpoint suscrito a su tipo. Publicar dos veces un evento
+// con el mismo id le entrega un duplicado al receptor, que lo puede
+// descartar.
+func (n *Notifier) Publish(event Event) error {
+	if event.ID == "" {
+		var id [16]byte
+		rand.Read(id[:])
+		event.ID = hex.EncodeToString(id[:])
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	for _, e := range n.endpoints {
+		if !e.wants(event.Type) {
+			continue
+		}
+		if _, err := n.outbox.Enqueue(delivery{URL: e.URL, Event: event}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run entrega los eventos del outbox hasta que se cancele el contexto.
+func (n *Notifier) Run(ctx context.Context, workers int) {
+	n.outbox.Run(ctx, workers, n.deliver)
+}
+
+func (n *Notifier) deliver(ctx context.Context, job queue.Job, last bool) error {
+	var d delivery
+	if err := json.Unmarshal(job.Payload, &d); err != nil {
+		slog.ErrorContext(ctx, "Discarding invalid webhook delivery", "job_id", job.ID, "error", err)
+		return nil
+	}
+	i := slices.IndexFunc(n.endpoints, func(e Endpoint) bool { return e.URL == d.URL })
+	if i < 0 {
+		// El endpoint se quitó de la configuración
+		slog.InfoContext(ctx, "Dropping webhook delivery for removed endpoint", "url", d.URL, "event_id", d.Event.ID)
+		return nil
+	}
+
+	err := n.post(ctx, n.endpoints[i], d.Event)
+	switch {
+	case err == nil:
+		metrics.ObserveWebhookDelivery(metrics.WebhookDelivered)
+	case last:
+		metrics.ObserveWebhookDelivery(metrics.WebhookFailed)
+	default:
+		metrics.ObserveWebhookDelivery(metrics.WebhookRetry)
+	}
+	return err
+}
+
+// post envía el evento firmado y falla si la respuesta no es 2xx.
+func (n *Notifier) post(ctx context.Context, e Endpoint, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "FileServer-Webhook/1")
+	req.Header.Set(HeaderID, event.ID)
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, Sign(e.Secret, timestamp, body))
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook endpoint responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign calcula la firma de una entrega: "sha256=" seguido del HMAC-SHA256 en
+// hexadecimal de "<timestamp>.<cuerpo>". Incluir la fecha permite al
+// receptor rechazar entregas repetidas por un tercero.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify comprueba la firma de una entrega recibida.
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Delivery describe una entrega del outbox para inspeccionarla.
+type Delivery struct {
+	ID        uint64
+	URL       string
+	Event     Event
+	Attempts  int
+	LastError string
+	NextTry   time.Time
+	CreatedAt time.Time
+}
+
+// Deliveries retorna hasta limit entregas pendientes o, si failed es true,
+// las que agotaron sus reintentos.
+func (n *Notifier) Deliveries(failed bool, limit int) ([]Delivery, error) {
+	jobs, err := n.outbox.List(failed, limit)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]Delivery, 0, len(jobs))
+	for _, job := range jobs {
+		var d delivery
+		if err := json.Unmarshal(job.Payload, &d); err != nil {
+			return nil, fmt.Errorf("failed to decode webhook delivery %d: %w", job.ID, err)
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:        job.ID,
+			URL:       d.URL,
+			Event:     d.Event,
+			Attempts:  job.Attempts,
+			LastError: job.LastError,
+			NextTry:   job.NotBefore,
+			CreatedAt: job.CreatedAt,
+		})
+	}
+	return deliveries, nil
+}
+
+// Replay vuelve a agendar una entrega fallida.
+func (n *Notifier) Replay(id uint64) error {
+	return n.outbox.Retry(id)
+}
@@ -0,0 +1,293 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Districorp-UPB/FileServer/queue"
+)
+
+const testSecret = "s3cret"
+
+// Reintentos rápidos para las pruebas
+var testRetry = queue.Options{MaxAttempts: 3, BaseDelay: 10 * time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+// receiver es un endpoint que comprueba la firma de cada entrega y responde
+// 500 a las primeras failures.
+type receiver struct {
+	*httptest.Server
+	failures atomic.Int32
+	attempts atomic.Int32
+	events   chan Event
+}
+
+func newReceiver(t *testing.T, secret string, failures int) *receiver {
+	t.Helper()
+	r := &receiver{events: make(chan Event, 16)}
+	r.failures.Store(int32(failures))
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.attempts.Add(1)
+		body, _ := io.ReadAll(req.Body)
+		if !Verify(secret, req.Header.Get(HeaderTimestamp), body, req.Header.Get(HeaderSignature)) {
+			t.Errorf("delivery with invalid signature %q", req.Header.Get(HeaderSignature))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.failures.Add(-1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("invalid event body: %v", err)
+		}
+		if req.Header.Get(HeaderID) != event.ID || req.Header.Get(HeaderEvent) != event.Type {
+			t.Errorf("headers %s/%s do not match event %s/%s", req.Header.Get(HeaderID), req.Header.Get(HeaderEvent), event.ID, event.Type)
+		}
+		r.events <- event
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// wait espera una entrega exitosa.
+func (r *receiver) wait(t *testing.T) Event {
+	t.Helper()
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for webhook delivery")
+		return Event{}
+	}
+}
+
+func openOutbox(t *testing.T, path string) *queue.Queue {
+	t.Helper()
+	q, err := queue.Open(path, testRetry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+// run entrega el outbox hasta el final de la prueba.
+func run(t *testing.T, n *Notifier) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n.Run(ctx, 2)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	signature := Sign(testSecret, "1700000000", body)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		want      bool
+	}{
+		{"valid", testSecret, "1700000000", body, signature, true},
+		{"wrong secret", "other", "1700000000", body, signature, false},
+		{"other timestamp", testSecret, "1700000001", body, signature, false},
+		{"modified body", testSecret, "1700000000", []byte(`{"id":"2"}`), signature, false},
+		{"missing signature", testSecret, "1700000000", body, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.timestamp, tt.body, tt.signature); got != tt.want {
+				t.Errorf("Verify = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{name: "all events", config: `[{"url":"http://a","secret":"s"}]`},
+		{name: "filtered", config: `[{"url":"http://a","secret":"s","events":["file.created","file.deleted"]}]`},
+		{name: "missing secret", config: `[{"url":"http://a"}]`, wantErr: true},
+		{name: "missing url", config: `[{"secret":"s"}]`, wantErr: true},
+		{name: "unknown event", config: `[{"url":"http://a","secret":"s","events":["file.shared"]}]`, wantErr: true},
+		{name: "invalid json", config: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "hooks.json")
+			if err := os.WriteFile(path, []byte(tt.config), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := LoadEndpoints(path)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LoadEndpoints error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		failures int
+		// Intentos hasta la entrega; 0 si se agotan los reintentos
+		wantAttempts int
+	}{
+		{name: "first attempt", failures: 0, wantAttempts: 1},
+		{name: "after retries", failures: 2, wantAttempts: 3},
+		{name: "exhausted", failures: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newReceiver(t, testSecret, tt.failures)
+			outbox := openOutbox(t, filepath.Join(t.TempDir(), "webhooks.db"))
+			defer outbox.Close()
+			n := NewNotifier([]Endpoint{{URL: r.URL, Secret: testSecret}}, outbox)
+			run(t, n)
+
+			event := Event{Type: FileCreated, OwnerID: "o", FileID: "f", File: &File{Name: "a.txt", Size: 2}}
+			if err := n.Publish(event); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantAttempts > 0 {
+				got := r.wait(t)
+				if got.ID == "" || got.Time.IsZero() || got.OwnerID != "o" || got.File == nil || got.File.Name != "a.txt" {
+					t.Errorf("delivered event = %+v", got)
+				}
+				if n := int(r.attempts.Load()); n != tt.wantAttempts {
+					t.Errorf("attempts = %d, want %d", n, tt.wantAttempts)
+				}
+				return
+			}
+
+			// Agotados los reintentos queda en la lista de fallidas hasta
+			// que se reenvía
+			failed := waitFailed(t, n)
+			if failed.Attempts != testRetry.MaxAttempts || failed.LastError == "" || failed.Event.FileID != "f" {
+				t.Errorf("failed delivery = %+v", failed)
+			}
+			if err := n.Replay(failed.ID); err != nil {
+				t.Fatal(err)
+			}
+			r.wait(t)
+			if pending, _ := n.Deliveries(true, 0); len(pending) != 0 {
+				t.Errorf("%d failed deliveries after replay", len(pending))
+			}
+		})
+	}
+}
+
+func waitFailed(t *testing.T, n *Notifier) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		failed, err := n.Deliveries(true, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(failed) > 0 {
+			return failed[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timed out waiting for a failed delivery")
+	return Delivery{}
+}
+
+// Cada endpoint recibe solo los tipos a los que se suscribió, y un evento
+// con id y fecha los conserva.
+func TestPublishRouting(t *testing.T) {
+	all := newReceiver(t, "a", 0)
+	deletions := newReceiver(t, "d", 0)
+	outbox := openOutbox(t, filepath.Join(t.TempDir(), "webhooks.db"))
+	defer outbox.Close()
+	n := NewNotifier([]Endpoint{
+		{URL: all.URL, Secret: "a"},
+		{URL: deletions.URL, Secret: "d", Events: []string{FileDeleted}},
+	}, outbox)
+	run(t, n)
+
+	when := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	events := []Event{
+		{ID: "created-1", Time: when, Type: FileCreated, OwnerID: "o", FileID: "f"},
+		{ID: "deleted-1", Time: when, Type: FileDeleted, OwnerID: "o", FileID: "f"},
+	}
+	for _, e := range events {
+		if err := n.Publish(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		receiver *receiver
+		want     []string
+	}{
+		{"all events", all, []string{"created-1", "deleted-1"}},
+		{"deletions only", deletions, []string{"deleted-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]bool{}
+			for range tt.want {
+				e := tt.receiver.wait(t)
+				if !e.Time.Equal(when) {
+					t.Errorf("event %s time = %s, want %s", e.ID, e.Time, when)
+				}
+				got[e.ID] = true
+			}
+			for _, id := range tt.want {
+				if !got[id] {
+					t.Errorf("event %s not delivered", id)
+				}
+			}
+			select {
+			case e := <-tt.receiver.events:
+				t.Errorf("unexpected event %s (%s)", e.ID, e.Type)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+// Un evento publicado sin entregar sobrevive a un reinicio.
+func TestOutboxSurvivesRestart(t *testing.T) {
+	r := newReceiver(t, testSecret, 0)
+	endpoints := []Endpoint{{URL: r.URL, Secret: testSecret}}
+	path := filepath.Join(t.TempDir(), "webhooks.db")
+
+	outbox := openOutbox(t, path)
+	if err := NewNotifier(endpoints, outbox).Publish(Event{Type: FileDeleted, OwnerID: "o", FileID: "f"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	outbox = openOutbox(t, path)
+	defer outbox.Close()
+	run(t, NewNotifier(endpoints, outbox))
+	if e := r.wait(t); e.Type != FileDeleted || e.FileID != "f" {
+		t.Errorf("delivered event = %+v", e)
+	}
+}